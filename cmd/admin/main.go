@@ -0,0 +1,326 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kschaper/auth-static/i18n"
+	"github.com/kschaper/auth-static/mail"
+	"github.com/kschaper/auth-static/services"
+	_ "github.com/mattn/go-sqlite3"
+	uuid "github.com/satori/go.uuid"
+)
+
+var usage = `admin <command> [flags]
+
+commands:
+  audit          show the audit log
+  duplicates     list users whose emails only differ in case or spelling of the domain
+  registrations  list the pending registrations
+  approve        create the user of a registration and print or send the signup URL
+  reject         delete a registration
+  import         create users from a CSV or JSON file and write their signup URLs
+  export         write all users as CSV or JSON without secrets
+  set-admin      grant or revoke a user's access to the admin pages
+
+run "admin <command> -h" for the command's flags`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Printf("error: no command given\n%s\n", usage)
+		return
+	}
+
+	commands := map[string]func(args []string) error{
+		"audit":         audit,
+		"duplicates":    duplicates,
+		"registrations": registrations,
+		"approve":       approve,
+		"reject":        reject,
+		"import":        importUsers,
+		"export":        exportUsers,
+		"set-admin":     setAdmin,
+	}
+
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Printf("error: unknown command %q\n%s\n", os.Args[1], usage)
+		return
+	}
+
+	if err := command(os.Args[2:]); err != nil {
+		fmt.Printf("error: %s\n", err)
+		return
+	}
+}
+
+// openDB opens the database.
+func openDB(dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("no dsn given")
+	}
+	client := &services.DatabaseClient{DSN: dsn}
+	return client.Open()
+}
+
+// parseTime parses a date or date and time in the local time zone. It returns the zero time for an empty string.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected e.g. 2018-09-30 or \"2018-09-30 14:00\"", value)
+}
+
+// audit prints the audit events matching the filter flags.
+func audit(args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	var (
+		dsn   = flags.String("dsn", "prod.db", "data source name")
+		user  = flags.String("user", "", "email or ID of the user")
+		path  = flags.String("path", "", "path prefix, e.g. /private/images/")
+		since = flags.String("since", "", "start time (inclusive), e.g. 2018-09-30 or \"2018-09-30 14:00\"")
+		until = flags.String("until", "", "end time (exclusive), e.g. 2018-10-01")
+		limit = flags.Int("limit", 0, "maximum number of events, 0 for no limit")
+	)
+	flags.Parse(args)
+
+	db, err := openDB(*dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// filter
+	filter := services.AuditFilter{PathPrefix: *path, Limit: *limit}
+	if filter.Since, err = parseTime(*since); err != nil {
+		return err
+	}
+	if filter.Until, err = parseTime(*until); err != nil {
+		return err
+	}
+	if *user != "" {
+		if id, err := uuid.FromString(*user); err == nil {
+			filter.UserID = id
+		} else {
+			// events of failed signins have the email only
+			filter.Email = *user
+			userService := &services.UserService{DB: db}
+			if id, err := userService.GetIDByEmail(*user); err == nil {
+				filter.UserID = id
+			}
+		}
+	}
+
+	// query
+	auditService := &services.AuditService{DB: db}
+	events, err := auditService.Query(filter)
+	if err != nil {
+		return err
+	}
+
+	// print
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tTYPE\tUSER\tEMAIL\tPATH\tIP\tUSER AGENT\tDETAIL")
+	for _, event := range events {
+		userID := ""
+		if event.UserID != uuid.Nil {
+			userID = event.UserID.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", event.Time.Local().Format("2006-01-02 15:04:05"),
+			event.Type, userID, event.Email, event.Path, event.IP, event.UserAgent, event.Detail)
+	}
+	return w.Flush()
+}
+
+// duplicates prints the groups of users whose emails are equal after normalization.
+// The database is opened without migrating it since the migration adding the case-insensitive
+// index fails as long as there are such users.
+func duplicates(args []string) error {
+	flags := flag.NewFlagSet("duplicates", flag.ExitOnError)
+	dsn := flags.String("dsn", "prod.db", "data source name")
+	flags.Parse(args)
+
+	if *dsn == "" {
+		return fmt.Errorf("no dsn given")
+	}
+	db, err := sql.Open("sqlite3", *dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	userService := &services.UserService{DB: db}
+	groups, err := userService.DuplicateEmails()
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		fmt.Println("no duplicates found")
+		return nil
+	}
+
+	// print
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GROUP\tID\tEMAIL\tCREATED\tSTATUS")
+	for i, users := range groups {
+		for _, user := range users {
+			status := "pending"
+			if user.Active {
+				status = "active"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, user.ID, user.Email, user.CreatedAt.Local().Format("2006-01-02 15:04:05"), status)
+		}
+	}
+	return w.Flush()
+}
+
+// registrations prints the pending registrations.
+func registrations(args []string) error {
+	flags := flag.NewFlagSet("registrations", flag.ExitOnError)
+	dsn := flags.String("dsn", "prod.db", "data source name")
+	flags.Parse(args)
+
+	db, err := openDB(*dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	userService := &services.UserService{DB: db}
+	pending, err := userService.Registrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Println("no pending registrations")
+		return nil
+	}
+
+	// print
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tCREATED\tIP\tREASON")
+	for _, registration := range pending {
+		reason := strings.Join(strings.Fields(registration.Reason), " ")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", registration.ID, registration.Email,
+			registration.CreatedAt.Local().Format("2006-01-02 15:04:05"), registration.IP, reason)
+	}
+	return w.Flush()
+}
+
+// approve creates the user of the registration. The signup URL is sent to the user if an SMTP server is given
+// and printed otherwise.
+func approve(args []string) error {
+	flags := flag.NewFlagSet("approve", flag.ExitOnError)
+	var (
+		dsn          = flags.String("dsn", "prod.db", "data source name")
+		id           = flags.String("id", "", "ID of the registration")
+		baseURL      = flags.String("base-url", "", "URL of the app for the signup URL, e.g. https://example.com, only the code is printed if empty")
+		siteName     = flags.String("site-name", "auth-static", "site name in the email's subject")
+		language     = flags.String("language", "en", "language of the email")
+		smtpAddr     = flags.String("smtp-addr", "", "SMTP server, e.g. localhost:25, the signup URL is printed instead of sent if empty")
+		smtpFrom     = flags.String("smtp-from", "", "sender address of the email")
+		smtpUsername = flags.String("smtp-username", "", "SMTP username, authentication is skipped if empty")
+		smtpPassword = flags.String("smtp-password", "", "SMTP password")
+	)
+	flags.Parse(args)
+
+	registrationID, err := uuid.FromString(*id)
+	if err != nil {
+		return fmt.Errorf("invalid registration ID %q", *id)
+	}
+	if *smtpAddr != "" && (*smtpFrom == "" || *baseURL == "") {
+		return fmt.Errorf("sending the signup URL requires -smtp-from and -base-url")
+	}
+
+	db, err := openDB(*dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// create user
+	userService := &services.UserService{DB: db}
+	email, code, err := userService.ApproveRegistration(registrationID)
+	if err != nil {
+		return err
+	}
+	userID, err := userService.GetIDByCode(code)
+	if err != nil {
+		return err
+	}
+	recordAdminEvent(db, services.AuditEvent{Type: services.AuditRegistrationApproved, UserID: userID, Email: email})
+
+	// send or print signup URL
+	if *baseURL == "" {
+		fmt.Printf("approved registration of %q with code %q\n", email, code)
+		return nil
+	}
+	url := strings.TrimSuffix(*baseURL, "/") + "/signup/" + code
+	if *smtpAddr == "" {
+		fmt.Printf("approved registration of %q, signup URL: %s\n", email, url)
+		return nil
+	}
+	l := i18n.NewBundle(*language).Localizer(*language)
+	mailer := &mail.SMTPMailer{Addr: *smtpAddr, From: *smtpFrom, Username: *smtpUsername, Password: *smtpPassword}
+	err = mailer.Send(mail.Message{
+		To:      email,
+		Subject: l.T("registration.approved_subject", *siteName),
+		Body:    l.T("registration.approved_body", url),
+	})
+	if err != nil {
+		return fmt.Errorf("approved registration of %q but sending the signup URL %s failed: %s", email, url, err)
+	}
+	fmt.Printf("approved registration of %q and sent the signup URL\n", email)
+	return nil
+}
+
+// reject deletes the registration. The visitor isn't notified.
+func reject(args []string) error {
+	flags := flag.NewFlagSet("reject", flag.ExitOnError)
+	var (
+		dsn = flags.String("dsn", "prod.db", "data source name")
+		id  = flags.String("id", "", "ID of the registration")
+	)
+	flags.Parse(args)
+
+	registrationID, err := uuid.FromString(*id)
+	if err != nil {
+		return fmt.Errorf("invalid registration ID %q", *id)
+	}
+
+	db, err := openDB(*dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	userService := &services.UserService{DB: db}
+	email, err := userService.RejectRegistration(registrationID)
+	if err != nil {
+		return err
+	}
+	recordAdminEvent(db, services.AuditEvent{Type: services.AuditRegistrationRejected, Email: email})
+
+	fmt.Printf("rejected registration of %q\n", email)
+	return nil
+}
+
+// recordAdminEvent stores the event of an admin command in the database's audit log.
+// Failures are printed but don't fail the command.
+func recordAdminEvent(db *sql.DB, event services.AuditEvent) {
+	event.Time = time.Now()
+	auditService := &services.AuditService{DB: db}
+	if err := auditService.Record(event); err != nil {
+		fmt.Printf("warning: recording audit event: %s\n", err)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+// importUsers creates the users of a CSV or JSON file in one transaction and writes a CSV of their emails
+// and signup URLs. Rejected rows are reported and nothing is created if there's one.
+func importUsers(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	var (
+		dsn             = flags.String("dsn", "prod.db", "data source name")
+		file            = flags.String("file", "", "CSV or JSON file with the users, - for stdin")
+		format          = flags.String("format", "", "csv or json, taken from the file extension if empty")
+		output          = flags.String("output", "-", "file for the CSV of emails and signup URLs, - for stdout")
+		baseURL         = flags.String("base-url", "", "URL of the app for the signup URLs, e.g. https://example.com, only the codes are written if empty")
+		dryRun          = flags.Bool("dry-run", false, "check the rows without creating users")
+		lowercaseEmails = flags.Bool("lowercase-emails", false, "store the emails completely lowercased instead of only their domain")
+		allowedDomains  = flags.String("allowed-email-domains", "", "comma separated domains the emails must belong to including subdomains, any if empty")
+		deniedDomains   = flags.String("denied-email-domains", "", "comma separated domains the emails must not belong to including subdomains")
+	)
+	flags.Parse(args)
+
+	if *file == "" {
+		return fmt.Errorf("no file given")
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+	}
+
+	// read
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	var (
+		users []services.ImportUser
+		err   error
+	)
+	switch *format {
+	case "csv":
+		users, err = readCSV(r)
+	case "json":
+		users, err = readJSON(r)
+	default:
+		return fmt.Errorf("unknown format %q, expected csv or json", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	// open the output before creating users whose codes would be lost otherwise
+	var w io.Writer = os.Stdout
+	if *output != "-" && !*dryRun {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	db, err := openDB(*dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// import
+	userService := &services.UserService{
+		DB:              db,
+		LowercaseEmails: *lowercaseEmails,
+		Emails: &services.EmailPolicy{
+			AllowedDomains: splitList(*allowedDomains),
+			DeniedDomains:  splitList(*deniedDomains),
+		},
+	}
+	results, err := userService.Import(users, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	// report
+	var failed int
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(os.Stderr, "row %d: %s: %s\n", result.Row, result.Email, result.Err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rows rejected, no users created", failed, len(results))
+	}
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "all %d rows valid, no users created (dry run)\n", len(results))
+		return nil
+	}
+
+	// signup URLs
+	out := csv.NewWriter(w)
+	if *baseURL == "" {
+		out.Write([]string{"email", "code"})
+	} else {
+		out.Write([]string{"email", "signup_url"})
+	}
+	for _, result := range results {
+		link := result.Code
+		if *baseURL != "" {
+			link = strings.TrimSuffix(*baseURL, "/") + "/signup/" + result.Code
+		}
+		out.Write([]string{result.Email, link})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "created %d users\n", len(results))
+	return nil
+}
+
+// readCSV reads users from CSV with a header naming the columns email (required), name and groups.
+// Groups are separated by spaces or semicolons. Rows are counted from 1 including the header.
+func readCSV(r io.Reader) ([]services.ImportUser, error) {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = -1
+	in.TrimLeadingSpace = true
+
+	header, err := in.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty CSV")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, fmt.Errorf("CSV header has no email column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var users []services.ImportUser
+	for row := 2; ; row++ {
+		record, err := in.Read()
+		if err == io.EOF {
+			return users, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, services.ImportUser{
+			Row:   row,
+			Email: field(record, "email"),
+			Name:  field(record, "name"),
+			Groups: strings.FieldsFunc(field(record, "groups"), func(r rune) bool {
+				return r == ';' || unicode.IsSpace(r)
+			}),
+		})
+	}
+}
+
+// readJSON reads users from a JSON array of objects like {"email": "...", "name": "...", "groups": ["..."]}.
+// Rows are counted from 1.
+func readJSON(r io.Reader) ([]services.ImportUser, error) {
+	var rows []struct {
+		Email  string   `json:"email"`
+		Name   string   `json:"name"`
+		Groups []string `json:"groups"`
+	}
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, err
+	}
+
+	users := make([]services.ImportUser, len(rows))
+	for i, row := range rows {
+		users[i] = services.ImportUser{Row: i + 1, Email: row.Email, Name: row.Name, Groups: row.Groups}
+	}
+	return users, nil
+}
+
+// exportUser is a user in the JSON export.
+type exportUser struct {
+	ID           string   `json:"id"`
+	Email        string   `json:"email"`
+	Name         string   `json:"name"`
+	Groups       []string `json:"groups"`
+	Status       string   `json:"status"`
+	CreatedAt    string   `json:"created_at"`
+	LastSigninAt string   `json:"last_signin_at,omitempty"`
+}
+
+// exportUsers writes all users with their groups and status as CSV or JSON, without password hashes or codes.
+func exportUsers(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	var (
+		dsn    = flags.String("dsn", "prod.db", "data source name")
+		format = flags.String("format", "csv", "csv or json")
+	)
+	flags.Parse(args)
+
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected csv or json", *format)
+	}
+
+	db, err := openDB(*dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	userService := &services.UserService{DB: db}
+	users, err := userService.Users()
+	if err != nil {
+		return err
+	}
+
+	rows := make([]exportUser, len(users))
+	for i, user := range users {
+		rows[i] = exportUser{
+			ID:        user.ID.String(),
+			Email:     user.Email,
+			Name:      user.Name,
+			Groups:    user.Groups,
+			Status:    "pending",
+			CreatedAt: user.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+		}
+		if rows[i].Groups == nil {
+			rows[i].Groups = []string{}
+		}
+		if user.Active {
+			rows[i].Status = "active"
+		}
+		if user.Disabled {
+			rows[i].Status = "disabled"
+		}
+		if !user.LastSigninAt.IsZero() {
+			rows[i].LastSigninAt = user.LastSigninAt.UTC().Format("2006-01-02T15:04:05Z")
+		}
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	}
+
+	out := csv.NewWriter(os.Stdout)
+	out.Write([]string{"id", "email", "name", "groups", "status", "created_at", "last_signin_at"})
+	for _, row := range rows {
+		out.Write([]string{row.ID, row.Email, row.Name, strings.Join(row.Groups, " "), row.Status, row.CreatedAt, row.LastSigninAt})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// setAdmin grants or revokes the access to the admin pages, e.g. to make the first user an admin.
+func setAdmin(args []string) error {
+	flags := flag.NewFlagSet("set-admin", flag.ExitOnError)
+	var (
+		dsn    = flags.String("dsn", "prod.db", "data source name")
+		email  = flags.String("email", "", "email of the user")
+		revoke = flags.Bool("revoke", false, "revoke instead of grant")
+	)
+	flags.Parse(args)
+
+	db, err := openDB(*dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	userService := &services.UserService{DB: db}
+	id, err := userService.GetIDByEmail(*email)
+	if err != nil {
+		return fmt.Errorf("no user with email %q", *email)
+	}
+	if err := userService.SetAdmin(id, !*revoke); err != nil {
+		return err
+	}
+
+	detail := "granted"
+	if *revoke {
+		detail = "revoked"
+	}
+	recordAdminEvent(db, services.AuditEvent{Type: services.AuditAdminRole, Email: *email, Detail: detail})
+	fmt.Printf("admin access of %q %s\n", *email, detail)
+	return nil
+}
+
+// splitList splits the comma separated list and drops empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
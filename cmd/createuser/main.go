@@ -3,15 +3,21 @@ package main
 import (
 	"flag"
 	"fmt"
+	"strings"
 
 	"github.com/kschaper/auth-static/services"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
-	email = flag.String("email", "", "email of new user")
-	dsn   = flag.String("dsn", "prod.db", "data source name")
-	usage = "createuser -email <email> -dsn <dsn>"
+	email           = flag.String("email", "", "email of new user")
+	dsn             = flag.String("dsn", "prod.db", "data source name")
+	lowercaseEmails = flag.Bool("lowercase-emails", false, "store the email completely lowercased instead of only its domain")
+	allowedDomains  = flag.String("allowed-email-domains", "", "comma separated domains the email must belong to including subdomains, any if empty")
+	deniedDomains   = flag.String("denied-email-domains", "", "comma separated domains the email must not belong to including subdomains")
+	reinvite        = flag.Bool("reinvite", false, "give an existing user a new code, the password stays valid until a new one is set")
+	reset           = flag.Bool("reset", false, "with -reinvite delete the password and end the user's sessions at once")
+	usage           = "createuser -email <email> -dsn <dsn> [-reinvite [-reset]]"
 )
 
 func main() {
@@ -27,6 +33,11 @@ func main() {
 		return
 	}
 
+	if *reset && !*reinvite {
+		fmt.Printf("error: -reset requires -reinvite\n%s\n", usage)
+		return
+	}
+
 	client := &services.DatabaseClient{DSN: *dsn}
 	db, err := client.Open()
 	if err != nil {
@@ -34,12 +45,54 @@ func main() {
 		return
 	}
 
-	userService := &services.UserService{DB: db}
+	emails := &services.EmailPolicy{
+		AllowedDomains: splitList(*allowedDomains),
+		DeniedDomains:  splitList(*deniedDomains),
+	}
+	userService := &services.UserService{DB: db, Emails: emails, LowercaseEmails: *lowercaseEmails}
+	normalized := services.NormalizeEmail(*email, *lowercaseEmails)
+
+	_, err = userService.GetIDByEmail(*email)
+	existed := err == nil
+	if err != nil && err != services.ErrUnknownCode {
+		fmt.Printf("error: %s\n", err)
+		return
+	}
+
+	// pending users just get a new code, users with a password only with -reinvite
 	code, err := userService.Create(*email)
+	active := err == services.ErrUserExists
+	if active {
+		if !*reinvite {
+			fmt.Printf("error: user with email %q already exists, use -reinvite to give the user a new code\n", normalized)
+			return
+		}
+		code, err = userService.Reinvite(*email, *reset)
+	}
 	if err != nil {
 		fmt.Printf("error: %s\n", err)
 		return
 	}
 
-	fmt.Printf("successfully saved user with email %q and code %q\n", *email, code)
+	switch {
+	case !existed:
+		fmt.Printf("successfully created user with email %q and code %q\n", normalized, code)
+	case !active:
+		fmt.Printf("successfully re-invited pending user with email %q and code %q\n", normalized, code)
+	case *reset:
+		fmt.Printf("successfully re-invited user with email %q and code %q, the password has been deleted\n", normalized, code)
+	default:
+		fmt.Printf("successfully re-invited user with email %q and code %q, the current password stays valid until a new one is set\n", normalized, code)
+	}
+}
+
+// splitList splits the comma separated list and drops empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -1,24 +1,47 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"flag"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 
+	"golang.org/x/crypto/bcrypt"
+
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/kschaper/auth-static/config"
 	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/i18n"
+	"github.com/kschaper/auth-static/logging"
+	"github.com/kschaper/auth-static/mail"
+	"github.com/kschaper/auth-static/metrics"
 	"github.com/kschaper/auth-static/services"
+	"github.com/kschaper/auth-static/systemd"
 )
 
 var (
+	// config file
+	configFile = flag.String("config", "", "config file with `name = value` lines named like the flags, reloaded on SIGHUP")
+
 	// web server
-	host = flag.String("host", "localhost", "the host the server listens to")
-	port = flag.Int("port", 9000, "the port the server listens to")
+	host            = flag.String("host", "localhost", "the host the server listens to")
+	port            = flag.Int("port", 9000, "the port the server listens to")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "time to wait for in-flight requests on shutdown")
+
+	// admin listener, changes require a restart
+	adminAddr = flag.String("admin-addr", "", "address of the admin listener serving /metrics, e.g. localhost:9100, disabled if empty")
 
 	// database
 	dsn = flag.String("dsn", "prod.db", "data source name")
@@ -28,19 +51,102 @@ var (
 	blockKey  = flag.String("blockkey", "", "cookie encryption key")
 	keylength = 32
 	secure    = flag.Bool("secure", false, "cookie secure flag")
+	sameSite  = flag.String("same-site", "lax", "cookie SameSite attribute: lax, strict or none, none requires -secure")
+
+	// CSRF
+	trustedOrigins = flag.String("trusted-origins", "", "comma separated hosts accepted in the Origin and Referer headers besides the request's host")
+
+	// logging
+	logLevel  = flag.String("log-level", "info", "minimum log level: debug, info, warn or error")
+	logFormat = flag.String("log-format", "logfmt", "log format: logfmt or json")
+
+	// audit log, changes require a restart
+	auditDB     = flag.Bool("audit-db", true, "record audit events in the database")
+	auditFile   = flag.String("audit-file", "", "append audit events as JSON lines to the given file")
+	auditSyslog = flag.Bool("audit-syslog", false, "send audit events to syslog")
+
+	// client IP
+	realIPHeader = flag.String("real-ip-header", "", "request header with the client's IP set by the web server, e.g. X-Real-IP")
 
 	// paths
-	external = flag.String("external", "/private/", "protected area external dir")
-	internal = flag.String("internal", "/internal/", "protected area internal dir")
-	home     = flag.String("home", "main.html", "protected area home, default: main.html")
+	external  = flag.String("external", "/private/", "protected area external dir")
+	internal  = flag.String("internal", "/internal/", "protected area internal dir")
+	home      = flag.String("home", "main.html", "protected area home, default: main.html")
+	root      = flag.String("root", "", "protected area absolute filesystem path, required for X-Sendfile, X-LIGHTTPD-send-file and -serve")
+	passQuery = flag.Bool("pass-query", false, "pass the query string through to the internal URL")
+	public    = flag.String("public", "", "public site filesystem path, served by the app if given")
+
+	// content type
+	mimeTypes       = flag.String("mimetypes", "", "file in /etc/mime.types format with additional MIME types")
+	attachmentTypes = flag.String("attachment-types", "", "comma separated MIME types served as download, e.g. application/pdf,video/*")
+	attachmentPaths = flag.String("attachment-paths", "", "comma separated path prefixes within the protected area served as download, e.g. downloads/")
+
+	// password policy
+	passwordMinLength   = flag.Int("password-min-length", services.PasswordMinLen, "minimum password length in characters")
+	passwordMaxLength   = flag.Int("password-max-length", services.PasswordMaxBytes, "maximum password length in bytes, at most 72 with bcrypt")
+	passwordMinClasses  = flag.Int("password-min-classes", 0, "minimum number of character classes: lowercase, uppercase, digits, other")
+	passwordRejectEmail = flag.Bool("password-reject-email", true, "reject passwords containing the email address")
+	breachedPasswords   = flag.String("breached-passwords", "", "directory with breached password hashes in the Have I Been Pwned range format")
+
+	// users
+	lowercaseEmails     = flag.Bool("lowercase-emails", false, "store emails completely lowercased instead of only their domain")
+	allowedEmailDomains = flag.String("allowed-email-domains", "", "comma separated domains new emails must belong to including subdomains, any if empty")
+	deniedEmailDomains  = flag.String("denied-email-domains", "", "comma separated domains new emails must not belong to including subdomains")
+	registration        = flag.Bool("registration", false, "let visitors ask for an account on /register, approved with as-admin")
+
+	// password hashing
+	passwordHash   = flag.String("password-hash", "bcrypt", "algorithm for new password hashes: bcrypt, argon2id or scrypt, older hashes are upgraded on signin")
+	bcryptCost     = flag.Int("bcrypt-cost", bcrypt.DefaultCost, "bcrypt cost")
+	argon2Time     = flag.Uint("argon2-time", 3, "argon2id iterations")
+	argon2Memory   = flag.Uint("argon2-memory", 64*1024, "argon2id memory in KiB")
+	argon2Threads  = flag.Uint("argon2-threads", 4, "argon2id parallelism")
+	scryptLogN     = flag.Uint("scrypt-ln", 15, "scrypt CPU/memory cost as power of 2")
+	scryptBlocks   = flag.Int("scrypt-r", 8, "scrypt block size")
+	scryptParallel = flag.Int("scrypt-p", 1, "scrypt parallelization")
+
+	// templates
+	siteName        = flag.String("site-name", "auth-static", "site name shown on the pages")
+	branding        = flag.String("branding", "", "comma separated name=value variables for the templates, e.g. logo=/assets/logo.png")
+	templatesDir    = flag.String("templates", "", "directory with templates overriding the built-in ones and an assets directory")
+	templatesReload = flag.Bool("templates-reload", false, "parse the templates on each request while developing")
+
+	// languages
+	defaultLanguage = flag.String("default-language", "en", "language used if none of the user's languages is supported")
+	locales         = flag.String("locales", "", "directory with message catalogs named like de.json adding to the built-in ones")
+
+	// emails
+	baseURL      = flag.String("base-url", "", "URL of the app for links in emails, e.g. https://example.com, required with -smtp-addr")
+	smtpAddr     = flag.String("smtp-addr", "", "SMTP server, e.g. localhost:25, emails are logged instead of sent if empty")
+	smtpFrom     = flag.String("smtp-from", "", "sender address of emails")
+	smtpUsername = flag.String("smtp-username", "", "SMTP username, authentication is skipped if empty")
+	smtpPassword = flag.String("smtp-password", "", "SMTP password")
+
+	// file serving
+	serve = flag.Bool("serve", false, "serve the protected area's files from -root instead of sending a header to the web server")
+
+	// sendfile
+	sendfile       = flag.String("sendfile", config.SendfileAccel, "header telling the web server which file to serve: X-Accel-Redirect, X-Sendfile or X-LIGHTTPD-send-file")
+	accelBuffering = flag.String("accel-buffering", "", "X-Accel-Buffering header value, e.g. no")
+	accelExpires   = flag.String("accel-expires", "", "X-Accel-Expires header value, e.g. 3600")
+	accelLimitRate = flag.String("accel-limit-rate", "", "X-Accel-Limit-Rate header value in bytes per second")
+
+	// cmdline holds the names of the flags given on the command line. They take precedence over the config file.
+	cmdline = map[string]bool{}
 )
 
 func main() {
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) { cmdline[f.Name] = true })
 
-	// validate flags
-	if len(*hashKey) != keylength || len(*blockKey) != keylength {
-		panic(fmt.Sprintf("please provide hashkey and blockkey both with %d chars", keylength))
+	// config file
+	if err := loadConfigFile(); err != nil {
+		panic(err)
+	}
+
+	// logger
+	logger, err := newLogger()
+	if err != nil {
+		panic(err)
 	}
 
 	// database client
@@ -50,34 +156,540 @@ func main() {
 		panic(err)
 	}
 
+	// audit log
+	audit, err := newAuditSink(db)
+	if err != nil {
+		panic(err)
+	}
+
+	// handler, replaced on reload
+	handler, err := newHandler(db, audit)
+	if err != nil {
+		panic(err)
+	}
+	var current atomic.Value
+	current.Store(handler)
+
+	// server
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			current.Load().(http.Handler).ServeHTTP(w, r)
+		}),
+	}
+
+	listener, err := listen()
+	if err != nil {
+		panic(err)
+	}
+
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- srv.Serve(listener)
+	}()
+	fmt.Printf("Server running at http://%s\n", listener.Addr())
+
+	// admin server
+	var adminSrv *http.Server
+	if *adminAddr != "" {
+		adminSrv = newAdminServer(db)
+		adminListener, err := net.Listen("tcp", *adminAddr)
+		if err != nil {
+			panic(err)
+		}
+		go func() {
+			serveErr <- adminSrv.Serve(adminListener)
+		}()
+		fmt.Printf("Admin server running at http://%s\n", adminListener.Addr())
+	}
+
+	// systemd
+	if _, err := systemd.Notify("READY=1"); err != nil {
+		logger.Error("notifying systemd", "error", err)
+	}
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		go watchdog(logger, interval/2)
+	}
+
+	// signals
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	for {
+		select {
+		case err := <-serveErr:
+			logger.Error("serving", "error", err)
+			os.Exit(1)
+
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				systemd.Notify("RELOADING=1")
+				if err := reload(db, &audit, &current); err != nil {
+					logger.Error("reloading config", "error", err)
+				} else {
+					logger.Info("reloaded config")
+				}
+				systemd.Notify("READY=1")
+				continue
+			}
+
+			// shutdown: stop accepting connections and wait for in-flight requests
+			systemd.Notify("STOPPING=1")
+			ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+			err := srv.Shutdown(ctx)
+			if err != nil {
+				logger.Error("shutting down", "error", err)
+			}
+			if adminSrv != nil {
+				if err := adminSrv.Shutdown(ctx); err != nil {
+					logger.Error("shutting down admin server", "error", err)
+				}
+			}
+			cancel()
+			if err := db.Close(); err != nil {
+				logger.Error("closing database", "error", err)
+			}
+			if err := audit.Close(); err != nil {
+				logger.Error("closing audit log", "error", err)
+			}
+			return
+		}
+	}
+}
+
+// newHandler validates the flags and returns the router.
+func newHandler(db *sql.DB, audit services.AuditSink) (http.Handler, error) {
+	// validate flags
+	if len(*hashKey) != keylength || len(*blockKey) != keylength {
+		return nil, fmt.Errorf("please provide hashkey and blockkey both with %d chars", keylength)
+	}
+	switch {
+	case *serve:
+		if *root == "" {
+			return nil, fmt.Errorf("please provide the root path to serve files")
+		}
+	case *sendfile == config.SendfileAccel:
+	case *sendfile == config.SendfileApache, *sendfile == config.SendfileLighttpd:
+		if !filepath.IsAbs(*root) {
+			return nil, fmt.Errorf("please provide the absolute root path for %s", *sendfile)
+		}
+	default:
+		return nil, fmt.Errorf("unknown sendfile header %q", *sendfile)
+	}
+
 	// session
+	var sameSiteMode http.SameSite
+	switch *sameSite {
+	case "lax":
+		sameSiteMode = http.SameSiteLaxMode
+	case "strict":
+		sameSiteMode = http.SameSiteStrictMode
+	case "none":
+		if !*secure {
+			return nil, fmt.Errorf("SameSite none requires the secure flag")
+		}
+		sameSiteMode = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("unknown SameSite mode %q", *sameSite)
+	}
 	store := sessions.NewCookieStore([]byte(*hashKey), []byte(*blockKey))
 	store.Options = &sessions.Options{
 		Path:     "/",
 		HttpOnly: true,
 		Secure:   *secure,
+		SameSite: sameSiteMode,
+	}
+
+	// password policy
+	if *passwordHash == "bcrypt" && *passwordMaxLength > services.PasswordMaxBytes {
+		return nil, fmt.Errorf("the maximum password length with bcrypt is %d bytes", services.PasswordMaxBytes)
+	}
+	if *passwordMinLength > *passwordMaxLength {
+		return nil, fmt.Errorf("the minimum password length %d exceeds the maximum %d", *passwordMinLength, *passwordMaxLength)
+	}
+	policy := &services.PasswordPolicy{
+		MinLength:   *passwordMinLength,
+		MaxLength:   *passwordMaxLength,
+		MinClasses:  *passwordMinClasses,
+		RejectEmail: *passwordRejectEmail,
+	}
+	if *breachedPasswords != "" {
+		policy.Breached = &services.BreachedPasswords{Dir: *breachedPasswords}
+	}
+
+	// password hasher
+	hasher, err := newPasswordHasher()
+	if err != nil {
+		return nil, err
 	}
 
 	// services
-	userService := &services.UserService{DB: db}
+	emails := &services.EmailPolicy{
+		AllowedDomains: splitList(*allowedEmailDomains),
+		DeniedDomains:  splitList(*deniedEmailDomains),
+	}
+	userService := &services.UserService{DB: db, Policy: policy, Hasher: hasher, Emails: emails, LowercaseEmails: *lowercaseEmails}
 
 	// config
 	conf := config.NewConfig()
+	conf.RealIPHeader = *realIPHeader
+	conf.TrustedOrigins = splitList(*trustedOrigins)
 	conf.ProtectedAreaDirExternal = *external
 	conf.ProtectedAreaDirInternal = *internal
 	conf.ProtectedAreaHome = *home
+	conf.ProtectedAreaRoot = *root
+	conf.PassQuery = *passQuery
+	conf.SendfileHeader = *sendfile
+	conf.AccelBuffering = *accelBuffering
+	conf.AccelExpires = *accelExpires
+	conf.AccelLimitRate = *accelLimitRate
+	conf.ServeFiles = *serve
+	conf.AttachmentTypes = splitList(*attachmentTypes)
+	conf.AttachmentPaths = splitList(*attachmentPaths)
+	if *mimeTypes != "" {
+		types, err := config.ReadMIMETypes(*mimeTypes)
+		if err != nil {
+			return nil, err
+		}
+		conf.MIMETypes = types
+	}
+	conf.PublicRoot = *public
+	if conf.PublicRoot != "" {
+		if err := checkPublicRoot(conf.PublicRoot, *root); err != nil {
+			return nil, err
+		}
+		for _, file := range []string{*dsn, *configFile} {
+			if file == "" {
+				continue
+			}
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return nil, err
+			}
+			conf.PublicExclude = append(conf.PublicExclude, abs)
+		}
+	}
+	conf.BaseURL = *baseURL
+	conf.Registration = *registration
+	conf.SiteName = *siteName
+	conf.TemplatesDir = *templatesDir
+	conf.TemplatesReload = *templatesReload
+	conf.Branding = map[string]string{}
+	for _, item := range splitList(*branding) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid branding variable %q", item)
+		}
+		conf.Branding[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	conf.DefaultLanguage = *defaultLanguage
+	conf.LocalesDir = *locales
+
+	// message catalogs
+	bundle := i18n.NewBundle(conf.DefaultLanguage)
+	if conf.LocalesDir != "" {
+		if err := bundle.LoadDir(conf.LocalesDir); err != nil {
+			return nil, err
+		}
+	}
+	if !bundle.Supports(conf.DefaultLanguage) {
+		return nil, fmt.Errorf("no messages for the default language %q", conf.DefaultLanguage)
+	}
+
+	// templates
+	tpl, err := handlers.NewTemplates(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// logger
+	logger, err := newLogger()
+	if err != nil {
+		return nil, err
+	}
+
+	// mailer
+	var mailer mail.Mailer = &mail.LogMailer{Logger: logger}
+	if *smtpAddr != "" {
+		if *smtpFrom == "" {
+			return nil, fmt.Errorf("please provide the sender address with -smtp-from")
+		}
+		// the request's Host header can be forged to send links to another site
+		if *baseURL == "" {
+			return nil, fmt.Errorf("please provide the app's URL for links in emails with -base-url")
+		}
+		mailer = &mail.SMTPMailer{Addr: *smtpAddr, From: *smtpFrom, Username: *smtpUsername, Password: *smtpPassword}
+	}
+
+	// readiness checks
+	checks := []handlers.ReadinessCheck{
+		{Name: "database", Check: db.PingContext},
+		{Name: "schema", Check: func(ctx context.Context) error { return services.CheckSchema(ctx, db) }},
+		{Name: "keys", Check: func(ctx context.Context) error {
+			if len(store.Codecs) == 0 {
+				return fmt.Errorf("no cookie keys loaded")
+			}
+			return nil
+		}},
+	}
 
 	// routes
 	r := mux.NewRouter()
-	r.HandleFunc("/signup/{code:[a-z0-9]{32}}", handlers.SignupFormHandler(conf, store)).Methods("GET")
-	r.HandleFunc("/signup/{code:[a-z0-9]{32}}", handlers.SignupHandler(conf, store, userService)).Methods("POST")
-	r.HandleFunc("/signin", handlers.SigninFormHandler(conf, store)).Methods("GET")
-	r.HandleFunc("/signin", handlers.SigninHandler(conf, store, userService)).Methods("POST")
-	r.PathPrefix(conf.ProtectedAreaDirExternal).HandlerFunc(handlers.AuthenticationHandler(conf, store, userService))
-	http.Handle("/", r)
+	r.HandleFunc("/healthz", handlers.HealthHandler()).Methods("GET")
+	r.HandleFunc("/readyz", handlers.ReadyHandler(checks...)).Methods("GET")
+	r.HandleFunc("/signup/{code:[a-z0-9]{32}}", handlers.Instrument("signup_form", handlers.SignupFormHandler(conf, store, userService, tpl))).Methods("GET")
+	r.HandleFunc("/signup/{code:[a-z0-9]{32}}", handlers.Instrument("signup", handlers.SignupHandler(conf, store, userService, audit))).Methods("POST")
+	r.HandleFunc("/signin", handlers.Instrument("signin_form", handlers.SigninFormHandler(conf, store, tpl))).Methods("GET")
+	r.HandleFunc("/signin", handlers.Instrument("signin", handlers.SigninHandler(conf, store, userService, audit))).Methods("POST")
+	if conf.Registration {
+		r.HandleFunc("/register", handlers.Instrument("register_form", handlers.RegisterFormHandler(conf, store, tpl))).Methods("GET")
+		r.HandleFunc("/register", handlers.Instrument("register", handlers.RegisterHandler(conf, store, userService, audit))).Methods("POST")
+	}
+	r.HandleFunc("/account", handlers.Instrument("account", handlers.AccountHandler(conf, store, userService, tpl))).Methods("GET")
+	r.HandleFunc("/account/email", handlers.Instrument("email_form", handlers.EmailFormHandler(conf, store, userService, tpl))).Methods("GET")
+	r.HandleFunc("/account/email", handlers.Instrument("email", handlers.EmailHandler(conf, store, userService, mailer))).Methods("POST")
+	r.HandleFunc("/account/email/{code:[a-z0-9]{32}}", handlers.Instrument("email_confirm_form", handlers.EmailConfirmFormHandler(conf, store, userService, tpl))).Methods("GET")
+	r.HandleFunc("/account/email/{code:[a-z0-9]{32}}", handlers.Instrument("email_confirm", handlers.EmailConfirmHandler(conf, store, userService, mailer, audit))).Methods("POST")
+	r.HandleFunc("/account/password", handlers.Instrument("password_form", handlers.PasswordFormHandler(conf, store, userService, tpl))).Methods("GET")
+	r.HandleFunc("/account/password", handlers.Instrument("password", handlers.PasswordHandler(conf, store, userService, audit))).Methods("POST")
+	r.Handle("/admin", http.RedirectHandler("/admin/users", http.StatusFound)).Methods("GET")
+	r.HandleFunc("/admin/users", handlers.Instrument("admin_users", handlers.AdminUsersHandler(conf, store, userService, tpl))).Methods("GET")
+	r.HandleFunc("/admin/users", handlers.Instrument("admin_invite", handlers.AdminInviteHandler(conf, store, userService, mailer, audit))).Methods("POST")
+	r.HandleFunc("/admin/users/{id:[0-9a-f-]{36}}", handlers.Instrument("admin_user", handlers.AdminUserHandler(conf, store, userService, tpl))).Methods("GET")
+	r.HandleFunc("/admin/users/{id:[0-9a-f-]{36}}/{action:groups|invite|admin|signout|disable|enable|delete}", handlers.Instrument("admin_user_action", handlers.AdminUserActionHandler(conf, store, userService, mailer, audit))).Methods("POST")
+	r.HandleFunc("/admin/registrations", handlers.Instrument("admin_registrations", handlers.AdminRegistrationsHandler(conf, store, userService, tpl))).Methods("GET")
+	r.HandleFunc("/admin/registrations/{id:[0-9a-f-]{36}}/{action:approve|reject}", handlers.Instrument("admin_registration_action", handlers.AdminRegistrationActionHandler(conf, store, userService, mailer, audit))).Methods("POST")
+	r.HandleFunc("/admin/rules", handlers.Instrument("admin_rules", handlers.AdminRulesHandler(conf, store, userService, tpl))).Methods("GET")
+	r.HandleFunc("/admin/rules", handlers.Instrument("admin_rule_add", handlers.AdminAddRuleHandler(conf, store, userService, audit))).Methods("POST")
+	r.HandleFunc("/admin/rules/delete", handlers.Instrument("admin_rule_delete", handlers.AdminDeleteRuleHandler(conf, store, userService, audit))).Methods("POST")
+	r.HandleFunc("/admin/sessions", handlers.Instrument("admin_sessions", handlers.AdminSessionsHandler(conf, store, userService, tpl))).Methods("GET")
+	r.HandleFunc("/admin/audit", handlers.Instrument("admin_audit", handlers.AdminAuditHandler(conf, store, userService, &services.AuditService{DB: db}, tpl))).Methods("GET")
+	r.PathPrefix("/assets/").HandlerFunc(handlers.Instrument("assets", handlers.AssetsHandler(conf))).Methods("GET", "HEAD")
+	r.HandleFunc("/language", handlers.Instrument("language", handlers.LanguageHandler(conf, bundle))).Methods("GET")
+	r.HandleFunc("/signout", handlers.Instrument("signout", handlers.SignoutHandler(conf, store, userService, audit))).Methods("POST")
+	r.HandleFunc("/api/csrf", handlers.Instrument("api_csrf", handlers.APICSRFHandler(conf, store))).Methods("GET")
+	r.HandleFunc("/api/signin", handlers.Instrument("api_signin", handlers.APISigninHandler(conf, store, userService, audit))).Methods("POST")
+	r.HandleFunc("/api/signup/{code:[a-z0-9]{32}}", handlers.Instrument("api_signup", handlers.APISignupHandler(conf, store, userService, audit))).Methods("POST")
+	r.HandleFunc("/api/signout", handlers.Instrument("api_signout", handlers.APISignoutHandler(conf, store, userService, audit))).Methods("POST")
+	r.HandleFunc("/api/me", handlers.Instrument("api_me", handlers.APIMeHandler(conf, store, userService))).Methods("GET")
+	r.HandleFunc("/api/account", handlers.Instrument("api_account", handlers.APIAccountHandler(conf, store, userService))).Methods("GET")
+	r.HandleFunc("/auth/verify", handlers.Instrument("verify", handlers.VerifyHandler(conf, store, userService, audit)))
+	r.PathPrefix(conf.ProtectedAreaDirExternal).HandlerFunc(handlers.Instrument("protected", handlers.AuthenticationHandler(conf, store, userService, audit)))
+	if conf.PublicRoot != "" {
+		r.PathPrefix("/").HandlerFunc(handlers.Instrument("public", handlers.PublicHandler(conf)))
+	}
+	return handlers.Logging(conf, logger, handlers.Localize(conf, bundle, handlers.CSRF(conf, store, r))), nil
+}
 
-	// server
-	addr := fmt.Sprintf("%s:%d", *host, *port)
-	fmt.Printf("Server running at http://%s\n", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+// newAdminServer returns the server for the admin listener.
+func newAdminServer(db *sql.DB) *http.Server {
+	userService := &services.UserService{DB: db}
+	metrics.Register(metrics.NewGaugeFunc("auth_static_pending_invitations",
+		"Users who haven't used their signup code yet.", func() (float64, error) {
+			count, err := userService.CountPending()
+			return float64(count), err
+		}))
+	metrics.Register(metrics.NewGaugeFunc("auth_static_active_sessions",
+		"Sessions used within the session lifetime.", func() (float64, error) {
+			count, err := userService.CountSessions()
+			return float64(count), err
+		}))
+
+	r := mux.NewRouter()
+	r.Handle("/metrics", metrics.Default.Handler()).Methods("GET")
+	return &http.Server{Handler: r}
+}
+
+// newPasswordHasher returns the password hasher selected by the flags.
+func newPasswordHasher() (services.PasswordHasher, error) {
+	switch *passwordHash {
+	case "bcrypt":
+		if *bcryptCost < bcrypt.MinCost || *bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return &services.BcryptHasher{Cost: *bcryptCost}, nil
+	case "argon2id":
+		if *argon2Time < 1 || *argon2Threads < 1 || *argon2Threads > 255 || *argon2Memory < 8*(*argon2Threads) {
+			return nil, fmt.Errorf("invalid argon2id parameters")
+		}
+		return &services.Argon2idHasher{Time: uint32(*argon2Time), Memory: uint32(*argon2Memory), Threads: uint8(*argon2Threads), KeyLen: 32}, nil
+	case "scrypt":
+		if *scryptLogN < 1 || *scryptLogN > 30 || *scryptBlocks < 1 || *scryptParallel < 1 {
+			return nil, fmt.Errorf("invalid scrypt parameters")
+		}
+		return &services.ScryptHasher{LogN: uint8(*scryptLogN), R: *scryptBlocks, P: *scryptParallel, KeyLen: 32}, nil
+	}
+	return nil, fmt.Errorf("unknown password hash %q", *passwordHash)
+}
+
+// newLogger returns the logger configured by the flags.
+func newLogger() (*logging.Logger, error) {
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		return nil, err
+	}
+	format, err := logging.ParseFormat(*logFormat)
+	if err != nil {
+		return nil, err
+	}
+	return logging.New(os.Stderr, level, format), nil
+}
+
+// newAuditSink returns the audit log sinks selected by the flags. The caller closes them.
+func newAuditSink(db *sql.DB) (services.AuditSinks, error) {
+	var sinks services.AuditSinks
+	if *auditDB {
+		sinks = append(sinks, &services.AuditService{DB: db})
+	}
+	if *auditFile != "" {
+		file, err := os.OpenFile(*auditFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, &services.JSONAuditSink{W: file})
+	}
+	if *auditSyslog {
+		sink, err := services.NewSyslogAuditSink("auth-static")
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// checkPublicRoot returns an error if the public site's directory contains the protected area's
+// which would serve the protected files without authentication.
+func checkPublicRoot(public, protected string) error {
+	if protected == "" {
+		return nil
+	}
+	publicAbs, err := filepath.Abs(public)
+	if err != nil {
+		return err
+	}
+	protectedAbs, err := filepath.Abs(protected)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(publicAbs, protectedAbs)
+	if err != nil {
+		return err
+	}
+	if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("the public site %s must not contain the protected area %s", public, protected)
+	}
+	return nil
+}
+
+// reload re-reads the config file, reopens the audit log and replaces the current handler and audit log.
+// If the file or the settings are invalid the previous settings stay in effect.
+// Changes of the listener and the database require a restart.
+func reload(db *sql.DB, audit *services.AuditSinks, current *atomic.Value) error {
+	previous := flagValues()
+	if err := loadConfigFile(); err != nil {
+		setFlags(previous)
+		return err
+	}
+	sinks, err := newAuditSink(db)
+	if err != nil {
+		setFlags(previous)
+		return err
+	}
+	handler, err := newHandler(db, sinks)
+	if err != nil {
+		sinks.Close()
+		setFlags(previous)
+		return err
+	}
+	current.Store(handler)
+
+	// requests still running with the previous handler can't record their events anymore
+	previousSinks := *audit
+	*audit = sinks
+	if err := previousSinks.Close(); err != nil {
+		return fmt.Errorf("closing the previous audit log: %s", err)
+	}
+	return nil
+}
+
+// flagValues returns the current values of all flags.
+func flagValues() map[string]string {
+	values := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) { values[f.Name] = f.Value.String() })
+	return values
+}
+
+// setFlags sets the flags to the values returned by flagValues.
+func setFlags(values map[string]string) {
+	for name, value := range values {
+		flag.Set(name, value)
+	}
+}
+
+// loadConfigFile sets the flags not given on the command line to the values from the config file
+// or to their defaults if the file doesn't contain them.
+func loadConfigFile() error {
+	if *configFile == "" {
+		return nil
+	}
+
+	values, err := config.ReadFile(*configFile)
+	if err != nil {
+		return err
+	}
+
+	for name := range values {
+		if flag.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("%s: unknown setting %q", *configFile, name)
+		}
+	}
+
+	var setErr error
+	flag.VisitAll(func(f *flag.Flag) {
+		if cmdline[f.Name] || f.Name == "config" || setErr != nil {
+			return
+		}
+		value, ok := values[f.Name]
+		if !ok {
+			value = f.DefValue
+		}
+		if err := f.Value.Set(value); err != nil {
+			setErr = fmt.Errorf("%s: invalid value %q for %s: %s", *configFile, value, f.Name, err)
+		}
+	})
+	return setErr
+}
+
+// splitList splits the comma separated list and drops empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// listen returns the socket passed by systemd or listens on host and port.
+func listen() (net.Listener, error) {
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) > 0 {
+		return listeners[0], nil
+	}
+	return net.Listen("tcp", fmt.Sprintf("%s:%d", *host, *port))
+}
+
+// watchdog keeps notifying systemd that the process is alive.
+func watchdog(logger *logging.Logger, interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := systemd.Notify("WATCHDOG=1"); err != nil {
+			logger.Error("notifying systemd watchdog", "error", err)
+		}
+	}
 }
@@ -1,5 +1,15 @@
 package config
 
+// Headers telling the web server which file to serve.
+const (
+	// SendfileAccel is nginx' header. Its value is the internal URL path.
+	SendfileAccel = "X-Accel-Redirect"
+	// SendfileApache is mod_xsendfile's header. Its value is the absolute filesystem path.
+	SendfileApache = "X-Sendfile"
+	// SendfileLighttpd is Lighttpd's header. Its value is the absolute filesystem path.
+	SendfileLighttpd = "X-LIGHTTPD-send-file"
+)
+
 // Config provides configuration.
 type Config struct {
 	// SessionName is the cookie name for the session
@@ -7,13 +17,81 @@ type Config struct {
 
 	// UserIDKey is the user_id session key
 	UserIDKey string
+	// SessionIDKey is the session key of the server-side session's ID which can be revoked.
+	SessionIDKey string
+
+	// CSRFTokenKey is the anti-CSRF token's session key.
+	CSRFTokenKey string
+	// CSRFTokenExemptPaths are the URL paths whose unsafe requests don't need a token, only a same-origin Origin or Referer.
+	// The signout form is on static pages which can't include the token.
+	CSRFTokenExemptPaths []string
+	// TrustedOrigins are hosts, e.g. "example.com", accepted in the Origin and Referer headers besides the request's host.
+	TrustedOrigins []string
+
+	// RealIPHeader is the request header with the client's IP set by the web server, e.g. "X-Real-IP".
+	// If empty the IP of the connection is used.
+	RealIPHeader string
 
 	// ProtectedAreaDirExternal is the URL path of the protected area visible to the user.
 	ProtectedAreaDirExternal string
 	// ProtectedAreaDirInternal is the URL path of the protected area not visible to the user.
 	ProtectedAreaDirInternal string
+	// PassQuery passes the query string of the requested URL through to the internal URL.
+	PassQuery bool
 	// ProtectedAreaHome is the URL of the protected area's homepage.
 	ProtectedAreaHome string
+	// ProtectedAreaRoot is the absolute filesystem path of the protected area.
+	// It's required for the SendfileApache and SendfileLighttpd headers and for ServeFiles.
+	ProtectedAreaRoot string
+
+	// ServeFiles makes the app serve the files of the protected area itself instead of sending SendfileHeader.
+	ServeFiles bool
+	// PublicRoot is the filesystem path of the public site served by the app if not empty.
+	PublicRoot string
+	// PublicExclude are absolute filesystem paths within PublicRoot which aren't served, e.g. the database.
+	// Files whose path starts with one of them, e.g. the database's journal, aren't served either.
+	PublicExclude []string
+	// DirectoryIndex is the file served for directory URLs if ServeFiles is set or PublicRoot isn't empty.
+	DirectoryIndex string
+
+	// MIMETypes maps file extensions, e.g. ".jpg", to MIME types. They take precedence over the system's MIME types.
+	MIMETypes map[string]string
+	// AttachmentTypes are the MIME types, e.g. "application/pdf" or "video/*", served as attachment (download).
+	AttachmentTypes []string
+	// AttachmentPaths are the path prefixes relative to the protected area, e.g. "downloads/", served as attachment (download).
+	AttachmentPaths []string
+
+	// BaseURL is the app's URL used for links in emails, e.g. "https://example.com".
+	// If empty the scheme and host of the request are used which can be forged, so it's required when emails are sent.
+	BaseURL string
+
+	// Registration enables the /register page where visitors ask for an account which admins approve.
+	Registration bool
+
+	// SiteName is shown on the pages.
+	SiteName string
+	// Branding holds variables for the templates, e.g. "logo" as {{.Branding.logo}}.
+	Branding map[string]string
+	// TemplatesDir is the directory with templates overriding the built-in ones and an assets directory.
+	TemplatesDir string
+	// TemplatesReload parses the templates on each request, e.g. while developing a theme.
+	TemplatesReload bool
+
+	// DefaultLanguage is used if none of the languages the user prefers is supported.
+	DefaultLanguage string
+	// LanguageCookie is the name of the cookie with the language chosen by the user.
+	LanguageCookie string
+	// LocalesDir is the directory with message catalogs named like "de.json" adding to the built-in ones.
+	LocalesDir string
+
+	// SendfileHeader is the header telling the web server which file to serve.
+	SendfileHeader string
+	// AccelBuffering is the value of the X-Accel-Buffering header sent with SendfileAccel if not empty.
+	AccelBuffering string
+	// AccelExpires is the value of the X-Accel-Expires header sent with SendfileAccel if not empty.
+	AccelExpires string
+	// AccelLimitRate is the value of the X-Accel-Limit-Rate header sent with SendfileAccel if not empty.
+	AccelLimitRate string
 }
 
 // NewConfig returns a new configuration with default values.
@@ -21,8 +99,16 @@ func NewConfig() *Config {
 	return &Config{
 		SessionName:              "auth-static",
 		UserIDKey:                "user_id",
+		SessionIDKey:             "session_id",
+		CSRFTokenKey:             "csrf_token",
+		CSRFTokenExemptPaths:     []string{"/signout"},
 		ProtectedAreaDirExternal: "/private/",
 		ProtectedAreaDirInternal: "/internal/",
 		ProtectedAreaHome:        "main.html",
+		SendfileHeader:           SendfileAccel,
+		DirectoryIndex:           "index.html",
+		SiteName:                 "auth-static",
+		DefaultLanguage:          "en",
+		LanguageCookie:           "lang",
 	}
 }
@@ -0,0 +1,62 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/kschaper/auth-static/config"
+)
+
+func TestReadFile(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			file, err := ioutil.TempFile("", "config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(file.Name())
+
+			content := "# cookie\nhashkey = abc\n\nsecure=true\nhome = main.html\n"
+			if _, err := file.WriteString(content); err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+
+			values, err := config.ReadFile(file.Name())
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+
+			expected := map[string]string{"hashkey": "abc", "secure": "true", "home": "main.html"}
+			if len(values) != len(expected) {
+				t.Fatalf("expected %d values but got %d: %v\n", len(expected), len(values), values)
+			}
+			for name, value := range expected {
+				if values[name] != value {
+					t.Fatalf("expected %s to be %q but got %q\n", name, value, values[name])
+				}
+			}
+		},
+		"invalid line": func(t *testing.T) {
+			file, err := ioutil.TempFile("", "config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(file.Name())
+
+			if _, err := file.WriteString("hashkey abc\n"); err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+
+			if _, err := config.ReadFile(file.Name()); err == nil {
+				t.Fatal("expected error but got none")
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
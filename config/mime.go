@@ -0,0 +1,36 @@
+package config
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// ReadMIMETypes reads a file in the format of `/etc/mime.types` with a MIME type
+// followed by its file extensions per line and returns a map of extension, e.g. ".jpg", to MIME type.
+// Empty lines and lines starting with `#` are ignored.
+func ReadMIMETypes(filename string) (map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	types := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for _, ext := range fields[1:] {
+			types["."+strings.ToLower(strings.TrimPrefix(ext, "."))] = fields[0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return types, nil
+}
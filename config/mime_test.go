@@ -0,0 +1,51 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/kschaper/auth-static/config"
+)
+
+func TestReadMIMETypes(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			file, err := ioutil.TempFile("", "mime.types")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(file.Name())
+
+			content := "# documents\ntext/markdown md markdown\n\napplication/x-custom .CUS\nimage/x-none\n"
+			if _, err := file.WriteString(content); err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+
+			types, err := config.ReadMIMETypes(file.Name())
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+
+			expected := map[string]string{".md": "text/markdown", ".markdown": "text/markdown", ".cus": "application/x-custom"}
+			if len(types) != len(expected) {
+				t.Fatalf("expected %d types but got %d: %v\n", len(expected), len(types), types)
+			}
+			for ext, typ := range expected {
+				if types[ext] != typ {
+					t.Fatalf("expected %s to be %q but got %q\n", ext, typ, types[ext])
+				}
+			}
+		},
+		"missing file": func(t *testing.T) {
+			if _, err := config.ReadMIMETypes("/nonexistent/mime.types"); err == nil {
+				t.Fatal("expected error but got none")
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/services"
+)
+
+type accountTplData struct {
+	layoutData
+	User     *services.User
+	Sessions []accountSession
+	Notices  []string // translated flash messages
+}
+
+// accountSession is a session marked if it's the one of the request.
+type accountSession struct {
+	services.Session
+	Current bool
+}
+
+// accountTpl is the built-in account.html.
+const accountTpl = `{{define "title"}}{{.L.T "account.title"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "account.title"}}</h1>
+  {{range .Notices}}
+    <p class="notice">{{.}}</p>
+  {{end}}
+  <dl>
+    <dt>{{.L.T "account.email"}}</dt>
+    <dd>{{.User.Email}}</dd>
+    <dt>{{.L.T "account.created_at"}}</dt>
+    <dd>{{.User.CreatedAt.Format "2006-01-02 15:04"}} UTC</dd>
+    <dt>{{.L.T "account.last_signin_at"}}</dt>
+    <dd>{{if .User.LastSigninAt.IsZero}}{{.L.T "account.never"}}{{else}}{{.User.LastSigninAt.Format "2006-01-02 15:04"}} UTC{{end}}</dd>
+  </dl>
+  <p>
+    <a href="/account/email">{{.L.T "email_change.title"}}</a>
+    <a href="/account/password">{{.L.T "password_change.title"}}</a>
+  </p>
+  <h2>{{.L.T "account.sessions"}}</h2>
+  <table class="sessions">
+    <tr>
+      <th>{{.L.T "account.device"}}</th>
+      <th>{{.L.T "account.ip"}}</th>
+      <th>{{.L.T "account.signed_in_at"}}</th>
+      <th>{{.L.T "account.last_seen_at"}}</th>
+    </tr>
+    {{range .Sessions}}
+      <tr>
+        <td>{{.UserAgent}}{{if .Current}} ({{$.L.T "account.this_device"}}){{end}}</td>
+        <td>{{.IP}}</td>
+        <td>{{.CreatedAt.Format "2006-01-02 15:04"}} UTC</td>
+        <td>{{.LastSeenAt.Format "2006-01-02 15:04"}} UTC</td>
+      </tr>
+    {{end}}
+  </table>
+{{end}}
+`
+
+// apiAccount is the JSON representation of the signed-in user's account.
+type apiAccount struct {
+	ID           uuid.UUID    `json:"id"`
+	Email        string       `json:"email"`
+	CreatedAt    time.Time    `json:"created_at"`
+	LastSigninAt *time.Time   `json:"last_signin_at"` // null if the user never signed in
+	Sessions     []apiSession `json:"sessions"`
+}
+
+// apiSession is the JSON representation of a session. Its ID isn't exposed.
+type apiSession struct {
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+}
+
+// AccountHandler shows the signed-in user's email, creation date, last signin and active sessions.
+// Users not signed in are redirected to the signin page.
+func AccountHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// ensure user is signed in
+		id, err := signedInUserID(conf, store, userService, r)
+		if err != nil {
+			serverError(w, r, "getting signed-in user", err)
+			return
+		}
+		if id == uuid.Nil {
+			http.Redirect(w, r, "/signin", http.StatusFound)
+			return
+		}
+
+		// template data
+		user, sessions, err := account(conf, store, userService, r, id)
+		if err != nil {
+			serverError(w, r, "getting account", err)
+			return
+		}
+		data := accountTplData{layoutData: newLayoutData(conf, r), User: user, Sessions: sessions}
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+		for _, flash := range session.Flashes(noticeFlashes) {
+			data.Notices = append(data.Notices, data.L.T(fmt.Sprintf("%s", flash)))
+		}
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+
+		// show page
+		if err := tpl.Execute(w, "account", data); err != nil {
+			serverError(w, r, "rendering template", err)
+		}
+	}
+}
+
+// APIAccountHandler responds with the signed-in user's account like AccountHandler or with 401.
+func APIAccountHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := signedInUserID(conf, store, userService, r)
+		if err != nil {
+			apiServerError(w, r, "getting signed-in user", err)
+			return
+		}
+		if id == uuid.Nil {
+			writeAPIError(w, r, http.StatusUnauthorized, apiErrUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+
+		user, sessions, err := account(conf, store, userService, r, id)
+		if err != nil {
+			apiServerError(w, r, "getting account", err)
+			return
+		}
+
+		body := apiAccount{ID: user.ID, Email: user.Email, CreatedAt: user.CreatedAt, Sessions: []apiSession{}}
+		if !user.LastSigninAt.IsZero() {
+			body.LastSigninAt = &user.LastSigninAt
+		}
+		for _, session := range sessions {
+			body.Sessions = append(body.Sessions, apiSession{
+				CreatedAt:  session.CreatedAt,
+				LastSeenAt: session.LastSeenAt,
+				IP:         session.IP,
+				UserAgent:  session.UserAgent,
+				Current:    session.Current,
+			})
+		}
+		writeJSON(w, r, http.StatusOK, body)
+	}
+}
+
+// account returns the user and the user's sessions with the request's one marked.
+func account(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, r *http.Request, id uuid.UUID) (*services.User, []accountSession, error) {
+	user, err := userService.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	list, err := userService.Sessions(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// signedInUserID already got the session
+	var currentID string
+	if session, err := store.Get(r, conf.SessionName); err == nil {
+		currentID, _ = session.Values[conf.SessionIDKey].(string)
+	}
+
+	var sessions []accountSession
+	for _, session := range list {
+		sessions = append(sessions, accountSession{Session: session, Current: session.ID == currentID})
+	}
+	return user, sessions, nil
+}
@@ -0,0 +1,138 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/services"
+)
+
+// account invokes the handler with the user signed in on this and another device unless userID is uuid.Nil.
+func account(t *testing.T, handler func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc, userService *services.UserService, userID uuid.UUID) *httptest.ResponseRecorder {
+	var (
+		store = sessions.NewCookieStore([]byte("abc"))
+		conf  = config.NewConfig()
+		w     = httptest.NewRecorder()
+	)
+
+	req, err := http.NewRequest("GET", "/account", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "this browser")
+	if userID != uuid.Nil {
+		if _, err := userService.CreateSession(userID, "192.0.2.1", "other browser"); err != nil {
+			t.Fatal(err)
+		}
+		if err := userService.SetLastSignin(userID); err != nil {
+			t.Fatal(err)
+		}
+		session, err := store.Get(req, conf.SessionName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		putUser(t, conf, userService, session, userID)
+	}
+
+	handler(conf, store)(w, req)
+	return w
+}
+
+func TestAccountHandler(t *testing.T) {
+	var (
+		userService = &services.UserService{DB: db(t)}
+		userID      = createUser(t, userService, "me@example.com", strings.Repeat("x", services.PasswordMinLen))
+		handler     = func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+			return handlers.AccountHandler(conf, store, userService, templates(t, conf))
+		}
+	)
+
+	cases := map[string]func(t *testing.T){
+		"signed in": func(t *testing.T) {
+			w := account(t, handler, userService, userID)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, w.Code)
+			}
+
+			// ensure details and devices are shown
+			html := w.Body.String()
+			for _, expected := range []string{"me@example.com", "other browser", "192.0.2.1", "(this device)", `href="/account/password"`} {
+				if !strings.Contains(html, expected) {
+					t.Fatalf("expected html to contain\n%s\nbut didn't:\n%s\n", expected, html)
+				}
+			}
+		},
+		"not signed in": func(t *testing.T) {
+			w := account(t, handler, userService, uuid.Nil)
+			if location := w.Header().Get("Location"); location != "/signin" {
+				t.Fatalf("expected redirect to %s but was to %s\n", "/signin", location)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestAPIAccountHandler(t *testing.T) {
+	var (
+		userService = &services.UserService{DB: db(t)}
+		userID      = createUser(t, userService, "me@example.com", strings.Repeat("x", services.PasswordMinLen))
+		handler     = func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+			return handlers.APIAccountHandler(conf, store, userService)
+		}
+	)
+
+	cases := map[string]func(t *testing.T){
+		"signed in": func(t *testing.T) {
+			w := account(t, handler, userService, userID)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, w.Code)
+			}
+
+			var body struct {
+				ID           uuid.UUID `json:"id"`
+				Email        string    `json:"email"`
+				LastSigninAt *string   `json:"last_signin_at"`
+				Sessions     []struct {
+					UserAgent string `json:"user_agent"`
+					Current   bool   `json:"current"`
+				} `json:"sessions"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.ID != userID || body.Email != "me@example.com" || body.LastSigninAt == nil {
+				t.Fatalf("expected user %s with email and last signin but got %+v\n", userID, body)
+			}
+			var current int
+			for _, session := range body.Sessions {
+				if session.Current {
+					current++
+				}
+			}
+			if len(body.Sessions) != 2 || current != 1 {
+				t.Fatalf("expected 2 sessions with 1 current but got %+v\n", body.Sessions)
+			}
+		},
+		"not signed in": func(t *testing.T) {
+			w := account(t, handler, userService, uuid.Nil)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusUnauthorized, w.Code)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/i18n"
+	"github.com/kschaper/auth-static/logging"
+	"github.com/kschaper/auth-static/mail"
+	"github.com/kschaper/auth-static/services"
+)
+
+// adminPageData is embedded in the template data of the admin pages.
+type adminPageData struct {
+	layoutData
+	CSRFToken string   // from session
+	Notices   []string // translated flash messages
+	Errors    []string // translated flash messages
+}
+
+// adminNavTpl is the built-in admin_nav.html with the navigation and the messages of the admin pages.
+const adminNavTpl = `{{define "admin_nav"}}
+  <nav class="admin">
+    <a href="/admin/users">{{.L.T "admin.users"}}</a>
+    <a href="/admin/registrations">{{.L.T "admin.registrations"}}</a>
+    <a href="/admin/rules">{{.L.T "admin.rules"}}</a>
+    <a href="/admin/sessions">{{.L.T "admin.sessions"}}</a>
+    <a href="/admin/audit">{{.L.T "admin.audit"}}</a>
+  </nav>
+  {{range .Notices}}
+    <p class="notice">{{.}}</p>
+  {{end}}
+  {{template "errors" .}}
+{{end}}`
+
+// pathID returns the user or registration ID of the route's "id" variable or uuid.Nil.
+func pathID(r *http.Request) uuid.UUID {
+	id, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// requireAdmin returns the ID of the signed-in admin. Users not signed in are redirected to the signin page,
+// other users get 403. It returns false if the response has been written.
+func requireAdmin(w http.ResponseWriter, r *http.Request, conf *config.Config, store *sessions.CookieStore, userService *services.UserService) (uuid.UUID, bool) {
+	id, err := signedInUserID(conf, store, userService, r)
+	if err != nil {
+		serverError(w, r, "getting signed-in user", err)
+		return uuid.Nil, false
+	}
+	if id == uuid.Nil {
+		http.Redirect(w, r, "/signin", http.StatusFound)
+		return uuid.Nil, false
+	}
+
+	admin, err := userService.IsAdmin(id)
+	if err != nil {
+		serverError(w, r, "checking admin flag", err)
+		return uuid.Nil, false
+	}
+	if !admin {
+		logging.FromContext(r.Context()).Info("admin page denied", "user", id)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// adminPage shows the admin page with the data returned by load. load gets the page data
+// with the CSRF token and the flashes to embed. Only admins get the page. ErrUnknownUser results in 404.
+func adminPage(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, tpl *Templates, page string, load func(r *http.Request, data adminPageData) (interface{}, error)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireAdmin(w, r, conf, store, userService); !ok {
+			return
+		}
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+
+		// template data
+		token, err := csrfToken(conf, session)
+		if err != nil {
+			serverError(w, r, "generating CSRF token", err)
+			return
+		}
+		pageData := adminPageData{layoutData: newLayoutData(conf, r), CSRFToken: token}
+		for _, flash := range session.Flashes(noticeFlashes) {
+			pageData.Notices = append(pageData.Notices, pageData.L.T(fmt.Sprintf("%s", flash)))
+		}
+		for _, flash := range session.Flashes() {
+			pageData.Errors = append(pageData.Errors, pageData.L.T(fmt.Sprintf("%s", flash)))
+		}
+		data, err := load(r, pageData)
+		if err == services.ErrUnknownUser {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			serverError(w, r, "loading admin page", err)
+			return
+		}
+
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+
+		// show page
+		if err := tpl.Execute(w, page, data); err != nil {
+			serverError(w, r, "rendering template", err)
+		}
+	}
+}
+
+// adminAction is a change made by an admin. It returns the page to redirect to and the message key of the notice.
+type adminAction func(r *http.Request, adminID uuid.UUID) (redirect, notice string, err error)
+
+// adminActionHandler performs the action of a signed-in admin and redirects with the notice
+// or the error of the action flashed. Only services.Error errors are flashed, others are server errors.
+func adminActionHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, action adminAction) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID, ok := requireAdmin(w, r, conf, store, userService)
+		if !ok {
+			return
+		}
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+
+		// act
+		redirect, notice, err := action(r, adminID)
+		if err != nil {
+			if _, ok := err.(services.Error); !ok {
+				serverError(w, r, "performing admin action", err)
+				return
+			}
+			logging.FromContext(r.Context()).Info("admin action rejected", "error", err)
+			session.AddFlash(errorKey(err))
+		} else if notice != "" {
+			session.AddFlash(notice, noticeFlashes)
+		}
+
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+		http.Redirect(w, r, redirect, http.StatusFound)
+	}
+}
+
+// recordAdmin records the admin's action on the user with the email.
+func recordAdmin(conf *config.Config, audit services.AuditSink, r *http.Request, eventType services.AuditEventType, adminID uuid.UUID, email, detail string) {
+	record(conf, audit, r, services.AuditEvent{Type: eventType, UserID: adminID, Email: email, Path: r.URL.Path, Detail: detail})
+}
+
+// sendInvite mails the signup URL of the code to the email with the subject and body of the message keys.
+func sendInvite(conf *config.Config, mailer mail.Mailer, r *http.Request, email, code, subjectKey, bodyKey string) error {
+	l := i18n.FromContext(r.Context())
+	return mailer.Send(mail.Message{
+		To:      email,
+		Subject: l.T(subjectKey, conf.SiteName),
+		Body:    l.T(bodyKey, baseURL(conf, r)+"/signup/"+code),
+	})
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/services"
+)
+
+// adminAuditLimit is the maximum number of events shown on the audit page.
+const adminAuditLimit = 100
+
+// errDateInvalid is shown on the audit page for dates not formatted like 2018-06-30.
+var errDateInvalid = services.Error("date invalid")
+
+type adminAuditTplData struct {
+	adminPageData
+	User   string // filter
+	Path   string // filter
+	Since  string // filter
+	Until  string // filter
+	Events []services.AuditEvent
+}
+
+// adminAuditTpl is the built-in admin_audit.html.
+const adminAuditTpl = `{{define "title"}}{{.L.T "admin.audit"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "admin.audit"}}</h1>
+  {{template "admin_nav" .}}
+  <form action="/admin/audit" method="get">
+    <label for="user">{{.L.T "admin.email"}}</label>
+    <input type="text" name="user" id="user" value="{{.User}}">
+    <label for="path">{{.L.T "admin.path"}}</label>
+    <input type="text" name="path" id="path" value="{{.Path}}">
+    <label for="since">{{.L.T "admin.since"}}</label>
+    <input type="text" name="since" id="since" value="{{.Since}}" placeholder="2018-06-01">
+    <label for="until">{{.L.T "admin.until"}}</label>
+    <input type="text" name="until" id="until" value="{{.Until}}" placeholder="2018-06-30">
+    <input type="submit" value="{{.L.T "admin.search_submit"}}">
+  </form>
+  <table class="audit">
+    <tr>
+      <th>{{.L.T "admin.time"}}</th>
+      <th>{{.L.T "admin.event"}}</th>
+      <th>{{.L.T "admin.email"}}</th>
+      <th>{{.L.T "admin.path"}}</th>
+      <th>{{.L.T "account.ip"}}</th>
+      <th>{{.L.T "admin.detail"}}</th>
+    </tr>
+    {{range .Events}}
+      <tr>
+        <td>{{.Time.UTC.Format "2006-01-02 15:04:05"}}</td>
+        <td>{{.Type}}</td>
+        <td>{{.Email}}</td>
+        <td>{{.Path}}</td>
+        <td>{{.IP}}</td>
+        <td>{{.Detail}}</td>
+      </tr>
+    {{end}}
+  </table>
+{{end}}
+`
+
+type adminSessionsTplData struct {
+	adminPageData
+	Sessions []services.UserSession
+}
+
+// adminSessionsTpl is the built-in admin_sessions.html.
+const adminSessionsTpl = `{{define "title"}}{{.L.T "admin.sessions"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "admin.sessions"}}</h1>
+  {{template "admin_nav" .}}
+  <table class="sessions">
+    <tr>
+      <th>{{.L.T "admin.email"}}</th>
+      <th>{{.L.T "account.device"}}</th>
+      <th>{{.L.T "account.ip"}}</th>
+      <th>{{.L.T "account.signed_in_at"}}</th>
+      <th>{{.L.T "account.last_seen_at"}}</th>
+    </tr>
+    {{range .Sessions}}
+      <tr>
+        <td><a href="/admin/users/{{.UserID}}">{{.Email}}</a></td>
+        <td>{{.UserAgent}}</td>
+        <td>{{.IP}}</td>
+        <td>{{.CreatedAt.Format "2006-01-02 15:04"}} UTC</td>
+        <td>{{.LastSeenAt.Format "2006-01-02 15:04"}} UTC</td>
+      </tr>
+    {{end}}
+  </table>
+{{end}}
+`
+
+// AdminAuditHandler shows the latest events of the audit log filtered by user, path prefix and dates.
+// The user filter matches events of the user as well as events concerning the user's email.
+func AdminAuditHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, auditLog *services.AuditService, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
+	return adminPage(conf, store, userService, tpl, "admin_audit", func(r *http.Request, page adminPageData) (interface{}, error) {
+		query := r.URL.Query()
+		data := adminAuditTplData{
+			adminPageData: page,
+			User:          strings.TrimSpace(query.Get("user")),
+			Path:          strings.TrimSpace(query.Get("path")),
+			Since:         strings.TrimSpace(query.Get("since")),
+			Until:         strings.TrimSpace(query.Get("until")),
+		}
+
+		// filter
+		filter := services.AuditFilter{Email: data.User, PathPrefix: data.Path, Limit: adminAuditLimit, Latest: true}
+		if data.User != "" {
+			// unknown emails still match failed signins and registrations
+			if id, err := userService.GetIDByEmail(data.User); err == nil {
+				filter.UserID = id
+			}
+		}
+		var err error
+		if filter.Since, err = parseDate(data.Since); err != nil {
+			data.Errors = append(data.Errors, data.L.T(errorKey(err)))
+			return data, nil
+		}
+		if filter.Until, err = parseDate(data.Until); err != nil {
+			data.Errors = append(data.Errors, data.L.T(errorKey(err)))
+			return data, nil
+		}
+		if !filter.Until.IsZero() {
+			// include the whole day
+			filter.Until = filter.Until.Add(24 * time.Hour)
+		}
+
+		data.Events, err = auditLog.Query(filter)
+		return data, err
+	})
+}
+
+// AdminSessionsHandler lists the sessions of all users used recently.
+func AdminSessionsHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
+	return adminPage(conf, store, userService, tpl, "admin_sessions", func(r *http.Request, page adminPageData) (interface{}, error) {
+		sessions, err := userService.ActiveSessions()
+		if err != nil {
+			return nil, err
+		}
+		return adminSessionsTplData{adminPageData: page, Sessions: sessions}, nil
+	})
+}
+
+// parseDate parses dates like 2018-06-30 in UTC. It returns the zero time for an empty string.
+func parseDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, errDateInvalid
+	}
+	return t, nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/logging"
+	"github.com/kschaper/auth-static/mail"
+	"github.com/kschaper/auth-static/services"
+)
+
+type adminRegistrationsTplData struct {
+	adminPageData
+	Registrations []services.Registration
+}
+
+// adminRegistrationsTpl is the built-in admin_registrations.html.
+const adminRegistrationsTpl = `{{define "title"}}{{.L.T "admin.registrations"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "admin.registrations"}}</h1>
+  {{template "admin_nav" .}}
+  <table class="registrations">
+    <tr>
+      <th>{{.L.T "admin.email"}}</th>
+      <th>{{.L.T "registration.reason"}}</th>
+      <th>{{.L.T "account.ip"}}</th>
+      <th>{{.L.T "account.created_at"}}</th>
+      <th></th>
+    </tr>
+    {{range .Registrations}}
+      <tr>
+        <td>{{.Email}}</td>
+        <td>{{.Reason}}</td>
+        <td>{{.IP}}</td>
+        <td>{{.CreatedAt.Format "2006-01-02 15:04"}} UTC</td>
+        <td>
+          <form action="/admin/registrations/{{.ID}}/approve" method="post">
+            <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
+            <input type="submit" value="{{$.L.T "admin.approve"}}">
+          </form>
+          <form action="/admin/registrations/{{.ID}}/reject" method="post">
+            <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
+            <input type="submit" value="{{$.L.T "admin.reject"}}">
+          </form>
+        </td>
+      </tr>
+    {{end}}
+  </table>
+{{end}}
+`
+
+// AdminRegistrationsHandler lists the pending registrations.
+func AdminRegistrationsHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
+	return adminPage(conf, store, userService, tpl, "admin_registrations", func(r *http.Request, page adminPageData) (interface{}, error) {
+		registrations, err := userService.Registrations()
+		if err != nil {
+			return nil, err
+		}
+		return adminRegistrationsTplData{adminPageData: page, Registrations: registrations}, nil
+	})
+}
+
+// AdminRegistrationActionHandler approves the registration of the path and mails the signup URL,
+// or rejects it, according to the route's "action" variable. Rejected visitors aren't notified.
+func AdminRegistrationActionHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, mailer mail.Mailer, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return adminActionHandler(conf, store, userService, func(r *http.Request, adminID uuid.UUID) (string, string, error) {
+		id := pathID(r)
+
+		switch mux.Vars(r)["action"] {
+		case "approve":
+			email, code, err := userService.ApproveRegistration(id)
+			if err != nil {
+				return "/admin/registrations", "", err
+			}
+			recordAdmin(conf, audit, r, services.AuditRegistrationApproved, adminID, email, "")
+			if err := sendInvite(conf, mailer, r, email, code, "registration.approved_subject", "registration.approved_body"); err != nil {
+				logging.FromContext(r.Context()).Error("sending signup URL", "error", err)
+				return "/admin/registrations", "", errInviteNotSent
+			}
+			return "/admin/registrations", "admin.approved", nil
+
+		case "reject":
+			email, err := userService.RejectRegistration(id)
+			if err != nil {
+				return "/admin/registrations", "", err
+			}
+			recordAdmin(conf, audit, r, services.AuditRegistrationRejected, adminID, email, "")
+			return "/admin/registrations", "admin.rejected", nil
+		}
+		return "/admin/registrations", "", errUnknownAction
+	})
+}
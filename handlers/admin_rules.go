@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/services"
+)
+
+type adminRulesTplData struct {
+	adminPageData
+	Rules []services.AccessRule
+}
+
+// adminRulesTpl is the built-in admin_rules.html.
+const adminRulesTpl = `{{define "title"}}{{.L.T "admin.rules"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "admin.rules"}}</h1>
+  {{template "admin_nav" .}}
+  <p>{{.L.T "admin.rules_intro"}}</p>
+  <table class="rules">
+    <tr>
+      <th>{{.L.T "admin.path"}}</th>
+      <th>{{.L.T "admin.group"}}</th>
+      <th></th>
+    </tr>
+    {{range .Rules}}
+      <tr>
+        <td>/{{.Path}}</td>
+        <td>{{.Group}}</td>
+        <td>
+          <form action="/admin/rules/delete" method="post">
+            <input type="hidden" name="csrf_token" value="{{$.CSRFToken}}">
+            <input type="hidden" name="path" value="{{.Path}}">
+            <input type="hidden" name="group" value="{{.Group}}">
+            <input type="submit" value="{{$.L.T "admin.delete"}}">
+          </form>
+        </td>
+      </tr>
+    {{end}}
+  </table>
+  <h2>{{.L.T "admin.rule_add"}}</h2>
+  <form action="/admin/rules" method="post">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    <label for="path">{{.L.T "admin.path"}}</label>
+    <input type="text" name="path" id="path">
+    <label for="group">{{.L.T "admin.group"}}</label>
+    <input type="text" name="group" id="group">
+    <input type="submit" value="{{.L.T "admin.rule_add"}}">
+  </form>
+{{end}}
+`
+
+// AdminRulesHandler lists the access rules and shows the form to add one.
+func AdminRulesHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
+	return adminPage(conf, store, userService, tpl, "admin_rules", func(r *http.Request, page adminPageData) (interface{}, error) {
+		rules, err := userService.AccessRules()
+		if err != nil {
+			return nil, err
+		}
+		return adminRulesTplData{adminPageData: page, Rules: rules}, nil
+	})
+}
+
+// AdminAddRuleHandler adds the access rule.
+func AdminAddRuleHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return adminActionHandler(conf, store, userService, func(r *http.Request, adminID uuid.UUID) (string, string, error) {
+		rule := services.AccessRule{Path: r.PostFormValue("path"), Group: r.PostFormValue("group")}
+		if err := userService.AddAccessRule(rule); err != nil {
+			return "/admin/rules", "", err
+		}
+		recordAdmin(conf, audit, r, services.AuditAdminAccessRule, adminID, "", "added "+rule.Path+" "+rule.Group)
+		return "/admin/rules", "admin.saved", nil
+	})
+}
+
+// AdminDeleteRuleHandler deletes the access rule.
+func AdminDeleteRuleHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return adminActionHandler(conf, store, userService, func(r *http.Request, adminID uuid.UUID) (string, string, error) {
+		rule := services.AccessRule{Path: r.PostFormValue("path"), Group: r.PostFormValue("group")}
+		if err := userService.DeleteAccessRule(rule); err != nil {
+			return "/admin/rules", "", err
+		}
+		recordAdmin(conf, audit, r, services.AuditAdminAccessRule, adminID, "", "deleted "+rule.Path+" "+rule.Group)
+		return "/admin/rules", "admin.saved", nil
+	})
+}
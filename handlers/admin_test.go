@@ -0,0 +1,223 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestAdminUsersHandler(t *testing.T) {
+	password := strings.Repeat("x", services.PasswordMinLen)
+
+	cases := map[string]func(t *testing.T){
+		"admin": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				adminID     = createUser(t, userService, "admin@example.com", password)
+			)
+			createUser(t, userService, "me@example.com", password)
+			if err := userService.SetAdmin(adminID, true); err != nil {
+				t.Fatal(err)
+			}
+
+			w, _ := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.AdminUsersHandler(conf, store, userService, templates(t, conf))
+			}, userService, adminID, "/admin/users?q=me%40", nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d but got %d\n", http.StatusOK, w.Code)
+			}
+			if html := w.Body.String(); !strings.Contains(html, "me@example.com") || strings.Contains(html, "admin@example.com") {
+				t.Fatalf("expected html to list %q only but got:\n%s\n", "me@example.com", html)
+			}
+		},
+		"not admin": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				userID      = createUser(t, userService, "me@example.com", password)
+			)
+
+			w, _ := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.AdminUsersHandler(conf, store, userService, templates(t, conf))
+			}, userService, userID, "/admin/users", nil)
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("expected status %d but got %d\n", http.StatusForbidden, w.Code)
+			}
+		},
+		"not signed in": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+
+			w, _ := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.AdminUsersHandler(conf, store, userService, templates(t, conf))
+			}, userService, uuid.Nil, "/admin/users", nil)
+			if location := w.Header().Get("Location"); location != "/signin" {
+				t.Fatalf("expected redirect to %s but was to %s\n", "/signin", location)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestAdminInviteHandler(t *testing.T) {
+	var (
+		userService = &services.UserService{DB: db(t)}
+		adminID     = createUser(t, userService, "admin@example.com", strings.Repeat("x", services.PasswordMinLen))
+		audit       = &services.AuditService{DB: userService.DB}
+		box         mailbox
+	)
+	if err := userService.SetAdmin(adminID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	w, session := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+		return handlers.AdminInviteHandler(conf, store, userService, &box, audit)
+	}, userService, adminID, "/admin/users", url.Values{"email": {"me@example.com"}, "name": {"Me"}, "groups": {"staff, sales"}})
+	if flashes := session.Flashes("notice"); len(flashes) != 1 || flashes[0] != "admin.invited" {
+		t.Fatalf("expected notice %q but got %v, errors %v\n", "admin.invited", flashes, session.Flashes())
+	}
+
+	// ensure the user has been created with name and groups
+	id, err := userService.GetIDByEmail("me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location := w.Header().Get("Location"); location != "/admin/users/"+id.String() {
+		t.Fatalf("expected redirect to %s but was to %s\n", "/admin/users/"+id.String(), location)
+	}
+	user, err := userService.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Me" || strings.Join(user.Groups, " ") != "sales staff" {
+		t.Fatalf("expected name %q and groups %q but got %+v\n", "Me", "sales staff", user)
+	}
+
+	// ensure the signup URL has been sent
+	if len(box) != 1 || box[0].To != "me@example.com" || !regexp.MustCompile(`/signup/[a-z0-9]{32}`).MatchString(box[0].Body) {
+		t.Fatalf("expected an invitation to %s but got %+v\n", "me@example.com", box)
+	}
+
+	// ensure the invitation has been recorded with the admin as user
+	events, err := audit.Query(services.AuditFilter{UserID: adminID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != services.AuditAdminInvite || events[0].Email != "me@example.com" {
+		t.Fatalf("expected an invite event but got %+v\n", events)
+	}
+}
+
+func TestAdminUserActionHandler(t *testing.T) {
+	password := strings.Repeat("x", services.PasswordMinLen)
+
+	cases := map[string]func(t *testing.T){
+		"disable": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				adminID     = createUser(t, userService, "admin@example.com", password)
+				userID      = createUser(t, userService, "me@example.com", password)
+				box         mailbox
+			)
+			if err := userService.SetAdmin(adminID, true); err != nil {
+				t.Fatal(err)
+			}
+
+			_, session := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.AdminUserActionHandler(conf, store, userService, &box, &services.AuditService{DB: userService.DB})
+			}, userService, adminID, "/admin/users/"+userID.String()+"/disable", nil)
+			if flashes := session.Flashes("notice"); len(flashes) != 1 || flashes[0] != "admin.saved" {
+				t.Fatalf("expected notice %q but got %v\n", "admin.saved", flashes)
+			}
+			if ok, err := userService.Authenticate("me@example.com", password); err != nil || ok {
+				t.Fatalf("expected disabled user not to authenticate but got %t, %v\n", ok, err)
+			}
+		},
+		"disable self": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				adminID     = createUser(t, userService, "admin@example.com", password)
+				box         mailbox
+			)
+			if err := userService.SetAdmin(adminID, true); err != nil {
+				t.Fatal(err)
+			}
+
+			_, session := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.AdminUserActionHandler(conf, store, userService, &box, &services.AuditService{DB: userService.DB})
+			}, userService, adminID, "/admin/users/"+adminID.String()+"/disable", nil)
+			if flashes := session.Flashes(); len(flashes) != 1 || flashes[0] != "error.self" {
+				t.Fatalf("expected error %q but got %v\n", "error.self", flashes)
+			}
+			if ok, err := userService.Authenticate("admin@example.com", password); err != nil || !ok {
+				t.Fatalf("expected admin to authenticate but got %t, %v\n", ok, err)
+			}
+		},
+		"invite disabled": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				adminID     = createUser(t, userService, "admin@example.com", password)
+				box         mailbox
+			)
+			if err := userService.SetAdmin(adminID, true); err != nil {
+				t.Fatal(err)
+			}
+			code, err := userService.Create("me@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			userID, err := userService.GetIDByCode(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := userService.Disable(userID); err != nil {
+				t.Fatal(err)
+			}
+
+			_, session := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.AdminUserActionHandler(conf, store, userService, &box, &services.AuditService{DB: userService.DB})
+			}, userService, adminID, "/admin/users/"+userID.String()+"/invite", nil)
+			if flashes := session.Flashes(); len(flashes) != 1 || flashes[0] != "error.user_disabled" {
+				t.Fatalf("expected error %q but got %v\n", "error.user_disabled", flashes)
+			}
+			if len(box) != 0 {
+				t.Fatalf("expected no email but got %+v\n", box)
+			}
+		},
+		"delete without confirmation": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				adminID     = createUser(t, userService, "admin@example.com", password)
+				userID      = createUser(t, userService, "me@example.com", password)
+				box         mailbox
+			)
+			if err := userService.SetAdmin(adminID, true); err != nil {
+				t.Fatal(err)
+			}
+
+			_, session := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.AdminUserActionHandler(conf, store, userService, &box, &services.AuditService{DB: userService.DB})
+			}, userService, adminID, "/admin/users/"+userID.String()+"/delete", nil)
+			if flashes := session.Flashes(); len(flashes) != 1 || flashes[0] != "error.not_confirmed" {
+				t.Fatalf("expected error %q but got %v\n", "error.not_confirmed", flashes)
+			}
+			if exists, err := userService.Exists(userID); err != nil || !exists {
+				t.Fatalf("expected user to exist but got %t, %v\n", exists, err)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/logging"
+	"github.com/kschaper/auth-static/mail"
+	"github.com/kschaper/auth-static/services"
+)
+
+// errInviteNotSent is returned by the admin actions if the user has been created
+// or got a new code but the invitation couldn't be sent.
+var errInviteNotSent = services.Error("invitation not sent")
+
+type adminUsersTplData struct {
+	adminPageData
+	Query string // search
+	Users []services.User
+}
+
+// adminUsersTpl is the built-in admin_users.html.
+const adminUsersTpl = `{{define "title"}}{{.L.T "admin.users"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "admin.users"}}</h1>
+  {{template "admin_nav" .}}
+  <form action="/admin/users" method="get">
+    <label for="q">{{.L.T "admin.search"}}</label>
+    <input type="text" name="q" id="q" value="{{.Query}}">
+    <input type="submit" value="{{.L.T "admin.search_submit"}}">
+  </form>
+  <table class="users">
+    <tr>
+      <th>{{.L.T "admin.email"}}</th>
+      <th>{{.L.T "admin.name"}}</th>
+      <th>{{.L.T "admin.groups"}}</th>
+      <th>{{.L.T "admin.status"}}</th>
+      <th>{{.L.T "account.last_signin_at"}}</th>
+    </tr>
+    {{range .Users}}
+      <tr>
+        <td><a href="/admin/users/{{.ID}}">{{.Email}}</a>{{if .Admin}} ({{$.L.T "admin.admin"}}){{end}}</td>
+        <td>{{.Name}}</td>
+        <td>{{range $i, $group := .Groups}}{{if $i}}, {{end}}{{$group}}{{end}}</td>
+        <td>{{if .Disabled}}{{$.L.T "admin.status_disabled"}}{{else if .Active}}{{$.L.T "admin.status_active"}}{{else}}{{$.L.T "admin.status_pending"}}{{end}}</td>
+        <td>{{if .LastSigninAt.IsZero}}{{$.L.T "account.never"}}{{else}}{{.LastSigninAt.Format "2006-01-02 15:04"}} UTC{{end}}</td>
+      </tr>
+    {{end}}
+  </table>
+  <h2>{{.L.T "admin.invite"}}</h2>
+  <form action="/admin/users" method="post">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    <label for="email">{{.L.T "admin.email"}}</label>
+    <input type="text" name="email" id="email">
+    <label for="name">{{.L.T "admin.name"}}</label>
+    <input type="text" name="name" id="name">
+    <label for="groups">{{.L.T "admin.groups_hint"}}</label>
+    <input type="text" name="groups" id="groups">
+    <input type="submit" value="{{.L.T "admin.invite_submit"}}">
+  </form>
+{{end}}
+`
+
+type adminUserTplData struct {
+	adminPageData
+	User     *services.User
+	Self     bool // the user is the signed-in admin
+	Sessions []services.Session
+}
+
+// adminUserTpl is the built-in admin_user.html.
+const adminUserTpl = `{{define "title"}}{{.User.Email}}{{end}}
+{{define "content"}}
+  <h1>{{.User.Email}}</h1>
+  {{template "admin_nav" .}}
+  <dl>
+    <dt>{{.L.T "admin.name"}}</dt>
+    <dd>{{.User.Name}}</dd>
+    <dt>{{.L.T "admin.status"}}</dt>
+    <dd>{{if .User.Disabled}}{{.L.T "admin.status_disabled"}}{{else if .User.Active}}{{.L.T "admin.status_active"}}{{else}}{{.L.T "admin.status_pending"}}{{end}}{{if .User.Admin}}, {{.L.T "admin.admin"}}{{end}}</dd>
+    <dt>{{.L.T "account.created_at"}}</dt>
+    <dd>{{.User.CreatedAt.Format "2006-01-02 15:04"}} UTC</dd>
+    <dt>{{.L.T "account.last_signin_at"}}</dt>
+    <dd>{{if .User.LastSigninAt.IsZero}}{{.L.T "account.never"}}{{else}}{{.User.LastSigninAt.Format "2006-01-02 15:04"}} UTC{{end}}</dd>
+  </dl>
+  <p><a href="/admin/audit?user={{.User.Email}}">{{.L.T "admin.audit"}}</a></p>
+  <form action="/admin/users/{{.User.ID}}/groups" method="post">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    <label for="groups">{{.L.T "admin.groups_hint"}}</label>
+    <input type="text" name="groups" id="groups" value="{{range $i, $group := .User.Groups}}{{if $i}} {{end}}{{$group}}{{end}}">
+    <input type="submit" value="{{.L.T "admin.groups_submit"}}">
+  </form>
+  {{if not (or .User.Active .User.Disabled)}}
+    <form action="/admin/users/{{.User.ID}}/invite" method="post">
+      <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+      <input type="submit" value="{{.L.T "admin.resend_invite"}}">
+    </form>
+  {{end}}
+  {{if not .Self}}
+    <form action="/admin/users/{{.User.ID}}/admin" method="post">
+      <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+      {{if .User.Admin}}
+        <input type="submit" value="{{.L.T "admin.revoke_admin"}}">
+      {{else}}
+        <input type="hidden" name="admin" value="1">
+        <input type="submit" value="{{.L.T "admin.grant_admin"}}">
+      {{end}}
+    </form>
+    <form action="/admin/users/{{.User.ID}}/signout" method="post">
+      <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+      <input type="submit" value="{{.L.T "admin.signout"}}">
+    </form>
+    <form action="/admin/users/{{.User.ID}}/{{if .User.Disabled}}enable{{else}}disable{{end}}" method="post">
+      <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+      <input type="submit" value="{{if .User.Disabled}}{{.L.T "admin.enable"}}{{else}}{{.L.T "admin.disable"}}{{end}}">
+    </form>
+    <form action="/admin/users/{{.User.ID}}/delete" method="post">
+      <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+      <label><input type="checkbox" name="confirm" value="1"> {{.L.T "admin.delete_confirm"}}</label>
+      <input type="submit" value="{{.L.T "admin.delete"}}">
+    </form>
+  {{end}}
+  <h2>{{.L.T "account.sessions"}}</h2>
+  <table class="sessions">
+    <tr>
+      <th>{{.L.T "account.device"}}</th>
+      <th>{{.L.T "account.ip"}}</th>
+      <th>{{.L.T "account.signed_in_at"}}</th>
+      <th>{{.L.T "account.last_seen_at"}}</th>
+    </tr>
+    {{range .Sessions}}
+      <tr>
+        <td>{{.UserAgent}}</td>
+        <td>{{.IP}}</td>
+        <td>{{.CreatedAt.Format "2006-01-02 15:04"}} UTC</td>
+        <td>{{.LastSeenAt.Format "2006-01-02 15:04"}} UTC</td>
+      </tr>
+    {{end}}
+  </table>
+{{end}}
+`
+
+// AdminUsersHandler lists the users matching the search and shows the form to invite a user.
+func AdminUsersHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
+	return adminPage(conf, store, userService, tpl, "admin_users", func(r *http.Request, page adminPageData) (interface{}, error) {
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		users, err := userService.FindUsers(query)
+		if err != nil {
+			return nil, err
+		}
+		return adminUsersTplData{adminPageData: page, Query: query, Users: users}, nil
+	})
+}
+
+// AdminInviteHandler creates a user with name and groups and mails the signup URL.
+func AdminInviteHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, mailer mail.Mailer, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return adminActionHandler(conf, store, userService, func(r *http.Request, adminID uuid.UUID) (string, string, error) {
+		user := services.ImportUser{
+			Row:    1,
+			Email:  r.PostFormValue("email"),
+			Name:   r.PostFormValue("name"),
+			Groups: splitGroups(r.PostFormValue("groups")),
+		}
+
+		// create user
+		results, err := userService.Import([]services.ImportUser{user}, false)
+		if err != nil {
+			return "/admin/users", "", err
+		}
+		if err := results[0].Err; err != nil {
+			return "/admin/users", "", err
+		}
+		email, code := results[0].Email, results[0].Code
+		id, err := userService.GetIDByCode(code)
+		if err != nil {
+			return "/admin/users", "", err
+		}
+		recordAdmin(conf, audit, r, services.AuditAdminInvite, adminID, email, "")
+
+		// send invitation
+		redirect := "/admin/users/" + id.String()
+		if err := sendInvite(conf, mailer, r, email, code, "admin.invite_subject", "admin.invite_body"); err != nil {
+			logging.FromContext(r.Context()).Error("sending invitation", "error", err)
+			return redirect, "", errInviteNotSent
+		}
+		return redirect, "admin.invited", nil
+	})
+}
+
+// AdminUserHandler shows the user with the forms to change the user's groups and status, and the user's sessions.
+func AdminUserHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
+	return adminPage(conf, store, userService, tpl, "admin_user", func(r *http.Request, page adminPageData) (interface{}, error) {
+		id := pathID(r)
+		user, err := userService.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		sessions, err := userService.Sessions(id)
+		if err != nil {
+			return nil, err
+		}
+
+		// signedInUserID already got the session
+		self := false
+		if session, err := store.Get(r, conf.SessionName); err == nil {
+			self = session.Values[conf.UserIDKey] == id.String()
+		}
+		return adminUserTplData{adminPageData: page, User: user, Self: self, Sessions: sessions}, nil
+	})
+}
+
+// AdminUserActionHandler changes the user of the path according to the route's "action" variable:
+// groups, invite (resend), admin (grant with admin=1, revoke otherwise), signout, disable, enable or delete.
+// Admins can't demote, sign out, disable or delete themselves.
+func AdminUserActionHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, mailer mail.Mailer, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return adminActionHandler(conf, store, userService, func(r *http.Request, adminID uuid.UUID) (string, string, error) {
+		var (
+			id       = pathID(r)
+			action   = mux.Vars(r)["action"]
+			redirect = "/admin/users/" + id.String()
+		)
+
+		user, err := userService.Get(id)
+		if err != nil {
+			return "/admin/users", "", err
+		}
+		switch action {
+		case "admin", "signout", "disable", "delete":
+			if id == adminID {
+				return redirect, "", services.ErrSelf
+			}
+		}
+
+		switch action {
+		case "groups":
+			if err := userService.SetGroups(id, splitGroups(r.PostFormValue("groups"))); err != nil {
+				return redirect, "", err
+			}
+			groups, err := userService.Groups(id)
+			if err != nil {
+				return redirect, "", err
+			}
+			recordAdmin(conf, audit, r, services.AuditAdminGroups, adminID, user.Email, strings.Join(groups, " "))
+			return redirect, "admin.groups_saved", nil
+
+		case "invite":
+			email, code, err := userService.ResendInvite(id)
+			if err != nil {
+				return redirect, "", err
+			}
+			recordAdmin(conf, audit, r, services.AuditAdminResendInvite, adminID, email, "")
+			if err := sendInvite(conf, mailer, r, email, code, "admin.invite_subject", "admin.invite_body"); err != nil {
+				logging.FromContext(r.Context()).Error("sending invitation", "error", err)
+				return redirect, "", errInviteNotSent
+			}
+			return redirect, "admin.invited", nil
+
+		case "admin":
+			admin := r.PostFormValue("admin") == "1"
+			if err := userService.SetAdmin(id, admin); err != nil {
+				return redirect, "", err
+			}
+			detail := "revoked"
+			if admin {
+				detail = "granted"
+			}
+			recordAdmin(conf, audit, r, services.AuditAdminRole, adminID, user.Email, detail)
+			return redirect, "admin.saved", nil
+
+		case "signout":
+			if _, err := userService.DeleteOtherSessions(id, ""); err != nil {
+				return redirect, "", err
+			}
+			recordAdmin(conf, audit, r, services.AuditAdminSignout, adminID, user.Email, "")
+			return redirect, "admin.signed_out", nil
+
+		case "disable":
+			if err := userService.Disable(id); err != nil {
+				return redirect, "", err
+			}
+			recordAdmin(conf, audit, r, services.AuditAdminDisable, adminID, user.Email, "")
+			return redirect, "admin.saved", nil
+
+		case "enable":
+			if err := userService.Enable(id); err != nil {
+				return redirect, "", err
+			}
+			recordAdmin(conf, audit, r, services.AuditAdminEnable, adminID, user.Email, "")
+			return redirect, "admin.saved", nil
+
+		case "delete":
+			if r.PostFormValue("confirm") != "1" {
+				return redirect, "", errNotConfirmed
+			}
+			if err := userService.Delete(id); err != nil {
+				return redirect, "", err
+			}
+			recordAdmin(conf, audit, r, services.AuditAdminDelete, adminID, user.Email, "")
+			return "/admin/users", "admin.deleted", nil
+		}
+		return redirect, "", errUnknownAction
+	})
+}
+
+// errNotConfirmed is returned by admin actions which need a ticked confirmation checkbox.
+var errNotConfirmed = services.Error("action not confirmed")
+
+// errUnknownAction is returned for paths without a known admin action.
+var errUnknownAction = services.Error("unknown action")
+
+// splitGroups splits the group names separated by spaces, commas or semicolons.
+func splitGroups(groups string) []string {
+	return strings.FieldsFunc(groups, func(r rune) bool {
+		return r == ',' || r == ';' || unicode.IsSpace(r)
+	})
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/i18n"
+	"github.com/kschaper/auth-static/logging"
+	"github.com/kschaper/auth-static/services"
+)
+
+// apiMaxBodySize limits the size of JSON request bodies.
+const apiMaxBodySize = 1 << 20
+
+// API error codes besides the ones derived from the message keys of services.Error values.
+const (
+	apiErrUnauthorized = "unauthorized"
+	apiErrBadRequest   = "bad_request"
+	apiErrInternal     = "internal_error"
+)
+
+// apiUser is the JSON representation of a user.
+type apiUser struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+// apiError is the JSON body of error responses: {"error": {"code": "password_too_short", "message": "password too short"}}.
+// The message is translated into the request's language.
+type apiError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// APICSRFHandler responds with the session's anti-CSRF token: {"csrf_token": "..."}.
+// The API's POST requests have to send it in the X-CSRF-Token header.
+func APICSRFHandler(conf *config.Config, store *sessions.CookieStore) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			apiServerError(w, r, "getting session", err)
+			return
+		}
+
+		token, err := csrfToken(conf, session)
+		if err != nil {
+			apiServerError(w, r, "generating CSRF token", err)
+			return
+		}
+		if err := session.Save(r, w); err != nil {
+			apiServerError(w, r, "saving session", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, map[string]string{"csrf_token": token})
+	}
+}
+
+// APISigninHandler authenticates with {"email": "...", "password": "..."} like SigninHandler
+// and responds with the user or with 401 and the error code signin_failed.
+func APISigninHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		if err := decodeJSON(r, &body); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, apiErrBadRequest, err.Error())
+			return
+		}
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			apiServerError(w, r, "getting session", err)
+			return
+		}
+
+		// authenticate
+		id, err := signIn(conf, session, userService, audit, r, body.Email, body.Password)
+		if err == errSigninFailed {
+			writeServiceError(w, r, http.StatusUnauthorized, err)
+			return
+		}
+		if err != nil {
+			apiServerError(w, r, "authenticating", err)
+			return
+		}
+
+		if err := session.Save(r, w); err != nil {
+			apiServerError(w, r, "saving session", err)
+			return
+		}
+
+		email, err := userService.GetEmailByID(id)
+		if err != nil {
+			apiServerError(w, r, "getting email", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, apiUser{ID: id, Email: email})
+	}
+}
+
+// APISignupHandler sets the password with {"password": "...", "confirmation": "..."} like SignupHandler
+// and responds with the user or with 422 and the error code, e.g. password_too_short.
+func APISignupHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			reg  = regexp.MustCompile("[a-z0-9]{32}")
+			code = reg.FindString(r.URL.Path) // TODO: use Gorilla Mux's path vars
+			body struct {
+				Password     string `json:"password"`
+				Confirmation string `json:"confirmation"`
+			}
+		)
+		if err := decodeJSON(r, &body); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, apiErrBadRequest, err.Error())
+			return
+		}
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			apiServerError(w, r, "getting session", err)
+			return
+		}
+
+		// set password
+		id, err := signUp(conf, session, userService, audit, r, code, body.Password, body.Confirmation)
+		if _, ok := err.(services.Error); ok {
+			logging.FromContext(r.Context()).Info("signup rejected", "error", err)
+			writeServiceError(w, r, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if err != nil {
+			apiServerError(w, r, "signing up", err)
+			return
+		}
+
+		if err := session.Save(r, w); err != nil {
+			apiServerError(w, r, "saving session", err)
+			return
+		}
+
+		email, err := userService.GetEmailByID(id)
+		if err != nil {
+			apiServerError(w, r, "getting email", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, apiUser{ID: id, Email: email})
+	}
+}
+
+// APISignoutHandler removes the user from the session like SignoutHandler and responds with 204.
+func APISignoutHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			apiServerError(w, r, "getting session", err)
+			return
+		}
+
+		if err := signOut(conf, session, userService, audit, r); err != nil {
+			apiServerError(w, r, "deleting session", err)
+			return
+		}
+		if err := session.Save(r, w); err != nil {
+			apiServerError(w, r, "saving session", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// APIMeHandler responds with the signed-in user or with 401.
+func APIMeHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := signedInUserID(conf, store, userService, r)
+		if err != nil {
+			apiServerError(w, r, "getting signed-in user", err)
+			return
+		}
+		if id == uuid.Nil {
+			writeAPIError(w, r, http.StatusUnauthorized, apiErrUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+
+		email, err := userService.GetEmailByID(id)
+		if err != nil {
+			apiServerError(w, r, "getting email", err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, apiUser{ID: id, Email: email})
+	}
+}
+
+// decodeJSON decodes the request's JSON body. The Content-Type must be application/json
+// which browsers don't send cross-origin without a CORS preflight.
+func decodeJSON(r *http.Request, v interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return fmt.Errorf("content type must be application/json")
+	}
+	return json.NewDecoder(http.MaxBytesReader(nil, r.Body, apiMaxBodySize)).Decode(v)
+}
+
+// writeJSON writes v as JSON with the status code.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.FromContext(r.Context()).Error("writing JSON response", "error", err)
+	}
+}
+
+// writeAPIError writes an error response.
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	var body apiError
+	body.Error.Code = code
+	body.Error.Message = message
+	writeJSON(w, r, status, body)
+}
+
+// writeServiceError writes an error response for an expected error.
+// The code is its message key without the "error." prefix, the message is translated.
+func writeServiceError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	key := errorKey(err)
+	writeAPIError(w, r, status, strings.TrimPrefix(key, "error."), i18n.FromContext(r.Context()).T(key))
+}
+
+// apiServerError logs the unexpected error and writes an error response without details.
+func apiServerError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	logging.FromContext(r.Context()).Error(msg, "error", err)
+	writeAPIError(w, r, http.StatusInternalServerError, apiErrInternal, http.StatusText(http.StatusInternalServerError))
+}
@@ -0,0 +1,223 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/services"
+)
+
+// createUser creates a user with the password and returns the id.
+func createUser(t *testing.T, userService *services.UserService, email, password string) uuid.UUID {
+	code, err := userService.Create(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := userService.GetIDByCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := userService.UpdatePassword(id, password, password); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// apiServer starts a server with the API handlers.
+func apiServer(t *testing.T, userService *services.UserService) *httptest.Server {
+	var (
+		store = sessions.NewCookieStore([]byte("abc"))
+		conf  = config.NewConfig()
+		audit = &services.AuditService{DB: userService.DB}
+		mux   = http.NewServeMux()
+	)
+	mux.HandleFunc("/api/signin", handlers.APISigninHandler(conf, store, userService, audit))
+	mux.HandleFunc("/api/signup/", handlers.APISignupHandler(conf, store, userService, audit))
+	mux.HandleFunc("/api/signout", handlers.APISignoutHandler(conf, store, userService, audit))
+	mux.HandleFunc("/api/me", handlers.APIMeHandler(conf, store, userService))
+	mux.HandleFunc("/api/csrf", handlers.APICSRFHandler(conf, store))
+	return httptest.NewServer(mux)
+}
+
+// apiRequest sends the request with the JSON body and decodes the JSON response into a map.
+func apiRequest(t *testing.T, client *http.Client, method, url string, body interface{}) (int, map[string]interface{}) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	if resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, result
+}
+
+// errorCode returns the code of an error response.
+func errorCode(result map[string]interface{}) interface{} {
+	if e, ok := result["error"].(map[string]interface{}); ok {
+		return e["code"]
+	}
+	return nil
+}
+
+func TestAPI(t *testing.T) {
+	var (
+		email    = "webmaster@example.com"
+		password = strings.Repeat("k", services.PasswordMinLen)
+	)
+
+	// newClient returns a client keeping cookies.
+	newClient := func(t *testing.T) *http.Client {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &http.Client{Jar: jar}
+	}
+
+	cases := map[string]func(t *testing.T){
+		"signin, me and signout": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+			id := createUser(t, userService, email, password)
+			ts := apiServer(t, userService)
+			defer ts.Close()
+			client := newClient(t)
+
+			// ensure not signed in
+			if status, result := apiRequest(t, client, "GET", ts.URL+"/api/me", nil); status != http.StatusUnauthorized || errorCode(result) != "unauthorized" {
+				t.Fatalf("expected status code %d and error unauthorized but got %d %v\n", http.StatusUnauthorized, status, result)
+			}
+
+			// sign in
+			status, result := apiRequest(t, client, "POST", ts.URL+"/api/signin", map[string]string{"email": email, "password": password})
+			if status != http.StatusOK || result["id"] != id.String() || result["email"] != email {
+				t.Fatalf("expected status code %d and the user but got %d %v\n", http.StatusOK, status, result)
+			}
+
+			// ensure signed in
+			if status, result := apiRequest(t, client, "GET", ts.URL+"/api/me", nil); status != http.StatusOK || result["id"] != id.String() {
+				t.Fatalf("expected status code %d and the user but got %d %v\n", http.StatusOK, status, result)
+			}
+
+			// sign out
+			if status, _ := apiRequest(t, client, "POST", ts.URL+"/api/signout", nil); status != http.StatusNoContent {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusNoContent, status)
+			}
+
+			// ensure signed out
+			if status, _ := apiRequest(t, client, "GET", ts.URL+"/api/me", nil); status != http.StatusUnauthorized {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusUnauthorized, status)
+			}
+		},
+		"signin failed": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+			createUser(t, userService, email, password)
+			ts := apiServer(t, userService)
+			defer ts.Close()
+
+			status, result := apiRequest(t, newClient(t), "POST", ts.URL+"/api/signin", map[string]string{"email": email, "password": "wrong"})
+
+			// ensure status code 401 and error code
+			if status != http.StatusUnauthorized || errorCode(result) != "signin_failed" {
+				t.Fatalf("expected status code %d and error signin_failed but got %d %v\n", http.StatusUnauthorized, status, result)
+			}
+		},
+		"signup": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+			code, err := userService.Create(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts := apiServer(t, userService)
+			defer ts.Close()
+			client := newClient(t)
+
+			// ensure password errors have codes
+			status, result := apiRequest(t, client, "POST", ts.URL+"/api/signup/"+code, map[string]string{"password": "short", "confirmation": "short"})
+			if status != http.StatusUnprocessableEntity || errorCode(result) != "password_too_short" {
+				t.Fatalf("expected status code %d and error password_too_short but got %d %v\n", http.StatusUnprocessableEntity, status, result)
+			}
+
+			// sign up
+			status, result = apiRequest(t, client, "POST", ts.URL+"/api/signup/"+code, map[string]string{"password": password, "confirmation": password})
+			if status != http.StatusOK || result["email"] != email {
+				t.Fatalf("expected status code %d and the user but got %d %v\n", http.StatusOK, status, result)
+			}
+
+			// ensure signed in
+			if status, _ := apiRequest(t, client, "GET", ts.URL+"/api/me", nil); status != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, status)
+			}
+		},
+		"unknown code": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+			ts := apiServer(t, userService)
+			defer ts.Close()
+
+			status, result := apiRequest(t, newClient(t), "POST", ts.URL+"/api/signup/"+strings.Repeat("a", 32), map[string]string{"password": password, "confirmation": password})
+
+			// ensure status code 422 and error code
+			if status != http.StatusUnprocessableEntity || errorCode(result) != "unknown_code" {
+				t.Fatalf("expected status code %d and error unknown_code but got %d %v\n", http.StatusUnprocessableEntity, status, result)
+			}
+		},
+		"csrf token": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+			ts := apiServer(t, userService)
+			defer ts.Close()
+
+			status, result := apiRequest(t, newClient(t), "GET", ts.URL+"/api/csrf", nil)
+
+			// ensure the token is returned
+			if token, _ := result["csrf_token"].(string); status != http.StatusOK || len(token) != 43 {
+				t.Fatalf("expected status code %d and a token but got %d %v\n", http.StatusOK, status, result)
+			}
+		},
+		"wrong content type": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+			ts := apiServer(t, userService)
+			defer ts.Close()
+
+			resp, err := http.Post(ts.URL+"/api/signin", "text/plain", strings.NewReader(`{}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			// ensure status code 400
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusBadRequest, resp.StatusCode)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
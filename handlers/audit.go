@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/logging"
+	"github.com/kschaper/auth-static/services"
+)
+
+// record completes the event with time, IP and user agent of the request and records it.
+// Failures are logged but don't affect the response.
+func record(conf *config.Config, audit services.AuditSink, r *http.Request, event services.AuditEvent) {
+	event.Time = time.Now()
+	event.IP = clientIP(conf, r)
+	event.UserAgent = r.UserAgent()
+
+	if err := audit.Record(event); err != nil {
+		logging.FromContext(r.Context()).Error("recording audit event", "error", err, "type", event.Type)
+	}
+}
+
+// clientIP returns the client's IP from the conf.RealIPHeader set by the web server
+// or from the connection if the header isn't configured.
+// Lists like X-Forwarded-For give the rightmost entry, the one added by the web server,
+// since the client can send the header with any entries which the web server appends to.
+func clientIP(conf *config.Config, r *http.Request) string {
+	if conf.RealIPHeader != "" {
+		if values := r.Header[http.CanonicalHeaderKey(conf.RealIPHeader)]; len(values) > 0 {
+			// X-Forwarded-For: client, proxy1, proxy2
+			entries := strings.Split(values[len(values)-1], ",")
+			if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -2,56 +2,135 @@ package handlers
 
 import (
 	"fmt"
-	"mime"
 	"net/http"
-	"path"
-	"strings"
 
 	"github.com/satori/go.uuid"
 
 	"github.com/gorilla/sessions"
 	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/logging"
 	"github.com/kschaper/auth-static/services"
 )
 
-// AuthenticationHandler gets the user_id from the session and checks if there's a corresponding user in the database.
-func AuthenticationHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService) func(w http.ResponseWriter, r *http.Request) {
+// AuthenticationHandler gets the user_id from the session and checks if there's a corresponding user in the database
+// whose groups may access the path. Each access is recorded in the audit log.
+func AuthenticationHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		notFoundText := fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound))
 
-		// get session
-		session, err := store.Get(r, conf.SessionName)
+		// ensure user is signed in
+		id, err := signedInUserID(conf, store, userService, r)
 		if err != nil {
+			logging.FromContext(r.Context()).Error("getting signed-in user", "error", err)
+			authChecksTotal.Inc(outcomeError)
+		} else if id == uuid.Nil {
+			authChecksTotal.Inc(outcomeDenied)
+		}
+		if id == uuid.Nil || err != nil {
+			record(conf, audit, r, services.AuditEvent{Type: services.AuditAccessDenied, Path: r.URL.Path})
 			http.Error(w, notFoundText, http.StatusNotFound)
 			return
 		}
 
-		// get user_id from session and convert into UUID
-		userID := session.Values[conf.UserIDKey]
-		if userID == nil {
+		// map the URL to the protected area's path
+		rel, err := protectedPath(conf, r.URL)
+		if err != nil {
+			authChecksTotal.Inc(outcomeForbidden)
+			record(conf, audit, r, services.AuditEvent{Type: services.AuditAccessDenied, UserID: id, Path: r.URL.Path})
 			http.Error(w, notFoundText, http.StatusNotFound)
 			return
 		}
-		userUUID, err := uuid.FromString(fmt.Sprintf("%s", userID))
+
+		// ensure the user's groups may access the path
+		allowed, err := userService.Allowed(id, rel)
 		if err != nil {
-			http.Error(w, notFoundText, http.StatusNotFound)
+			authChecksTotal.Inc(outcomeError)
+			serverError(w, r, "checking access rules", err)
 			return
 		}
-
-		// check if user exists
-		if exists, err := userService.Exists(userUUID); !exists || err != nil {
+		if !allowed {
+			authChecksTotal.Inc(outcomeForbidden)
+			record(conf, audit, r, services.AuditEvent{Type: services.AuditAccessDenied, UserID: id, Path: r.URL.Path})
 			http.Error(w, notFoundText, http.StatusNotFound)
 			return
 		}
+		authChecksTotal.Inc(outcomeGranted)
+		record(conf, audit, r, services.AuditEvent{Type: services.AuditFileAccess, UserID: id, Path: r.URL.Path})
+
+		// set Content-Type and related headers
+		setContentTypeHeaders(w, conf, rel)
 
-		// set Content-Type header
-		mime := mime.TypeByExtension(path.Ext(r.URL.Path))
-		if mime == "" {
-			mime = "text/html"
+		// serve the file or tell the web server which file to serve
+		if conf.ServeFiles {
+			serveFile(w, r, conf.ProtectedAreaRoot, rel, conf.DirectoryIndex)
+			return
 		}
-		w.Header().Set("Content-Type", mime)
+		setSendfileHeaders(w, r, conf, rel)
+	}
+}
+
+// signedInUserID returns the ID of the user stored in the session.
+// It returns uuid.Nil if there's no session, no user_id or session_id in the session,
+// or the server-side session has been revoked, has expired or belongs to another, a deleted or a disabled user.
+func signedInUserID(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, r *http.Request) (uuid.UUID, error) {
+	// get session
+	session, err := store.Get(r, conf.SessionName)
+	if err != nil {
+		return uuid.Nil, nil
+	}
 
-		// set header
-		w.Header().Set("X-Accel-Redirect", strings.Replace(r.URL.String(), conf.ProtectedAreaDirExternal, conf.ProtectedAreaDirInternal, 1))
+	// get user_id from session and convert into UUID
+	userID := session.Values[conf.UserIDKey]
+	if userID == nil {
+		return uuid.Nil, nil
+	}
+	userUUID, err := uuid.FromString(fmt.Sprintf("%s", userID))
+	if err != nil {
+		return uuid.Nil, nil
+	}
+
+	// check server-side session which also ensures that the user exists
+	sessionID, _ := session.Values[conf.SessionIDKey].(string)
+	if sessionID == "" {
+		return uuid.Nil, nil
+	}
+	sessionUserID, err := userService.SessionUserID(sessionID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if sessionUserID != userUUID {
+		return uuid.Nil, nil
+	}
+	return userUUID, nil
+}
+
+// startSession creates a server-side session for the user and stores its ID and the user id in the session.
+// A previous server-side session and the anti-CSRF token are deleted, so a token planted before signin
+// isn't valid afterwards; a new one is generated with the next form. The caller saves the session.
+func startSession(conf *config.Config, session *sessions.Session, userService *services.UserService, r *http.Request, userID uuid.UUID) error {
+	if err := endSession(conf, session, userService); err != nil {
+		return err
+	}
+	delete(session.Values, conf.CSRFTokenKey)
+
+	sessionID, err := userService.CreateSession(userID, clientIP(conf, r), r.UserAgent())
+	if err != nil {
+		return err
+	}
+	session.Values[conf.UserIDKey] = userID.String()
+	session.Values[conf.SessionIDKey] = sessionID
+	return nil
+}
+
+// endSession deletes the server-side session and removes its ID and the user id from the session.
+// The caller saves the session.
+func endSession(conf *config.Config, session *sessions.Session, userService *services.UserService) error {
+	if sessionID, _ := session.Values[conf.SessionIDKey].(string); sessionID != "" {
+		if err := userService.DeleteSession(sessionID); err != nil {
+			return err
+		}
 	}
+	delete(session.Values, conf.SessionIDKey)
+	delete(session.Values, conf.UserIDKey)
+	return nil
 }
@@ -3,6 +3,7 @@ package handlers_test
 import (
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
@@ -35,7 +36,7 @@ func TestAuthenticationHandler(t *testing.T) {
 			// handler
 			store := sessions.NewCookieStore([]byte("abc"))
 			conf := config.NewConfig()
-			handler := handlers.AuthenticationHandler(conf, store, userService)
+			handler := handlers.AuthenticationHandler(conf, store, userService, &services.AuditService{DB: db})
 			w := httptest.NewRecorder()
 
 			// request
@@ -57,7 +58,7 @@ func TestAuthenticationHandler(t *testing.T) {
 			}
 
 			// put the user id in session
-			session.Values[conf.UserIDKey] = id.String()
+			putUser(t, conf, userService, session, id)
 			if err := session.Save(req, w); err != nil {
 				t.Fatal(err)
 			}
@@ -97,7 +98,7 @@ func TestAuthenticationHandler(t *testing.T) {
 			// handler
 			store := sessions.NewCookieStore([]byte("abc"))
 			conf := config.NewConfig()
-			handler := handlers.AuthenticationHandler(conf, store, userService)
+			handler := handlers.AuthenticationHandler(conf, store, userService, &services.AuditService{DB: db})
 			w := httptest.NewRecorder()
 
 			// request
@@ -113,7 +114,7 @@ func TestAuthenticationHandler(t *testing.T) {
 			}
 
 			// put unkown user id in session
-			session.Values[conf.UserIDKey] = uuid.NewV4().String()
+			putUser(t, conf, userService, session, uuid.NewV4())
 			if err := session.Save(req, w); err != nil {
 				t.Fatal(err)
 			}
@@ -138,6 +139,43 @@ func TestAuthenticationHandler(t *testing.T) {
 				t.Fatalf("expected X-Accel-Redirect not to be set but got value %q\n", redirectHeader)
 			}
 		},
+		"restricted to other group": func(t *testing.T) {
+			var (
+				db          = db(t)
+				userService = &services.UserService{DB: db}
+				id          = createUser(t, userService, "me@example.com", strings.Repeat("x", services.PasswordMinLen))
+				store       = sessions.NewCookieStore([]byte("abc"))
+				conf        = config.NewConfig()
+				handler     = handlers.AuthenticationHandler(conf, store, userService, &services.AuditService{DB: db})
+			)
+			if err := userService.SetGroups(id, []string{"staff"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := userService.AddAccessRule(services.AccessRule{Path: "board", Group: "board"}); err != nil {
+				t.Fatal(err)
+			}
+
+			for path, expected := range map[string]int{
+				"/private/board/minutes.html": http.StatusNotFound,
+				"/private/staff/minutes.html": http.StatusOK,
+			} {
+				req, err := http.NewRequest("GET", path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				session, err := store.Get(req, conf.SessionName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				putUser(t, conf, userService, session, id)
+				w := httptest.NewRecorder()
+
+				handler(w, req)
+				if w.Code != expected {
+					t.Fatalf("expected status code %d for %s but got %d\n", expected, path, w.Code)
+				}
+			}
+		},
 		"without file extension in path": func(t *testing.T) {
 			var (
 				db           = db(t)
@@ -156,7 +194,7 @@ func TestAuthenticationHandler(t *testing.T) {
 			// handler
 			store := sessions.NewCookieStore([]byte("abc"))
 			conf := config.NewConfig()
-			handler := handlers.AuthenticationHandler(conf, store, userService)
+			handler := handlers.AuthenticationHandler(conf, store, userService, &services.AuditService{DB: db})
 			w := httptest.NewRecorder()
 
 			// request
@@ -178,7 +216,7 @@ func TestAuthenticationHandler(t *testing.T) {
 			}
 
 			// put the user id in session
-			session.Values[conf.UserIDKey] = id.String()
+			putUser(t, conf, userService, session, id)
 			if err := session.Save(req, w); err != nil {
 				t.Fatal(err)
 			}
@@ -215,3 +253,214 @@ func TestAuthenticationHandler(t *testing.T) {
 		t.Run(n, c)
 	}
 }
+
+// authenticate invokes the AuthenticationHandler for the given path with the user ID in the session.
+func authenticate(t *testing.T, conf *config.Config, userService *services.UserService, userID uuid.UUID, requestPath string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", requestPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authenticateRequest(t, conf, userService, userID, req)
+}
+
+// authenticateRequest invokes the AuthenticationHandler for the given request with the user ID in the session.
+func authenticateRequest(t *testing.T, conf *config.Config, userService *services.UserService, userID uuid.UUID, req *http.Request) *httptest.ResponseRecorder {
+	// handler
+	store := sessions.NewCookieStore([]byte("abc"))
+	handler := handlers.AuthenticationHandler(conf, store, userService, &services.AuditService{DB: userService.DB})
+	w := httptest.NewRecorder()
+
+	// put the user id in session
+	session, err := store.Get(req, conf.SessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putUser(t, conf, userService, session, userID)
+	if err := session.Save(req, w); err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Set-Cookie", strings.Split(w.Header().Get("Set-Cookie"), ";")[0])
+
+	// invoke handler
+	w = httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestAuthenticationHandler_Sendfile(t *testing.T) {
+	var (
+		db          = db(t)
+		userService = &services.UserService{DB: db}
+	)
+
+	// create user
+	code, err := userService.Create("webmaster@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := userService.GetIDByCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]func(t *testing.T){
+		"accel with options": func(t *testing.T) {
+			conf := config.NewConfig()
+			conf.AccelBuffering = "no"
+			conf.AccelLimitRate = "1024"
+
+			w := authenticate(t, conf, userService, id, "/private/video.mp4")
+
+			expected := map[string]string{
+				"X-Accel-Redirect":   "/internal/video.mp4",
+				"X-Accel-Buffering":  "no",
+				"X-Accel-Limit-Rate": "1024",
+				"X-Accel-Expires":    "",
+			}
+			for header, value := range expected {
+				if actual := w.Header().Get(header); actual != value {
+					t.Fatalf("expected %s %q but got %q\n", header, value, actual)
+				}
+			}
+		},
+		"apache": func(t *testing.T) {
+			conf := config.NewConfig()
+			conf.SendfileHeader = config.SendfileApache
+			conf.ProtectedAreaRoot = "/var/www/internal"
+
+			w := authenticate(t, conf, userService, id, "/private/images/deers.jpg")
+
+			if header := w.Header().Get("X-Sendfile"); header != "/var/www/internal/images/deers.jpg" {
+				t.Fatalf("expected X-Sendfile %q but got %q\n", "/var/www/internal/images/deers.jpg", header)
+			}
+			if header := w.Header().Get("X-Accel-Redirect"); header != "" {
+				t.Fatalf("expected X-Accel-Redirect not to be set but got %q\n", header)
+			}
+		},
+		"lighttpd": func(t *testing.T) {
+			conf := config.NewConfig()
+			conf.SendfileHeader = config.SendfileLighttpd
+			conf.ProtectedAreaRoot = "/var/www/internal"
+
+			w := authenticate(t, conf, userService, id, "/private/main.html")
+
+			if header := w.Header().Get("X-LIGHTTPD-send-file"); header != "/var/www/internal/main.html" {
+				t.Fatalf("expected X-LIGHTTPD-send-file %q but got %q\n", "/var/www/internal/main.html", header)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestAuthenticationHandler_ContentType(t *testing.T) {
+	var (
+		db          = db(t)
+		userService = &services.UserService{DB: db}
+	)
+
+	// create user
+	code, err := userService.Create("webmaster@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := userService.GetIDByCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]func(t *testing.T){
+		"unknown extension": func(t *testing.T) {
+			conf := config.NewConfig()
+			w := authenticate(t, conf, userService, id, "/private/README")
+
+			if header := w.Header().Get("Content-Type"); header != "application/octet-stream" {
+				t.Fatalf("expected Content-Type %q but got %q\n", "application/octet-stream", header)
+			}
+			if header := w.Header().Get("X-Content-Type-Options"); header != "nosniff" {
+				t.Fatalf("expected X-Content-Type-Options %q but got %q\n", "nosniff", header)
+			}
+			if header := w.Header().Get("Content-Disposition"); header != "" {
+				t.Fatalf("expected Content-Disposition not to be set but got %q\n", header)
+			}
+		},
+		"sniffed type": func(t *testing.T) {
+			root := fileTree(t, map[string]string{
+				"report": "%PDF-1.4\n",
+				"page":   "<!DOCTYPE html><script>alert(1)</script>",
+			})
+			defer os.RemoveAll(root)
+
+			conf := config.NewConfig()
+			conf.ServeFiles = true
+			conf.ProtectedAreaRoot = root
+
+			// ensure safe types are detected
+			w := authenticate(t, conf, userService, id, "/private/report")
+			if header := w.Header().Get("Content-Type"); header != "application/pdf" {
+				t.Fatalf("expected Content-Type %q but got %q\n", "application/pdf", header)
+			}
+
+			// ensure HTML isn't
+			w = authenticate(t, conf, userService, id, "/private/page")
+			if header := w.Header().Get("Content-Type"); header != "application/octet-stream" {
+				t.Fatalf("expected Content-Type %q but got %q\n", "application/octet-stream", header)
+			}
+		},
+		"configured type": func(t *testing.T) {
+			conf := config.NewConfig()
+			conf.MIMETypes = map[string]string{".md": "text/markdown"}
+			w := authenticate(t, conf, userService, id, "/private/notes.MD")
+
+			if header := w.Header().Get("Content-Type"); header != "text/markdown" {
+				t.Fatalf("expected Content-Type %q but got %q\n", "text/markdown", header)
+			}
+		},
+		"attachment by type": func(t *testing.T) {
+			conf := config.NewConfig()
+			conf.AttachmentTypes = []string{"image/*"}
+			w := authenticate(t, conf, userService, id, "/private/images/deers.jpg")
+
+			expected := `attachment; filename=deers.jpg`
+			if header := w.Header().Get("Content-Disposition"); header != expected {
+				t.Fatalf("expected Content-Disposition %q but got %q\n", expected, header)
+			}
+		},
+		"attachment by path": func(t *testing.T) {
+			conf := config.NewConfig()
+			conf.AttachmentPaths = []string{"downloads/"}
+			w := authenticate(t, conf, userService, id, "/private/downloads/report%202018.html")
+
+			expected := `attachment; filename="report 2018.html"`
+			if header := w.Header().Get("Content-Disposition"); header != expected {
+				t.Fatalf("expected Content-Disposition %q but got %q\n", expected, header)
+			}
+		},
+		"no attachment": func(t *testing.T) {
+			conf := config.NewConfig()
+			conf.AttachmentTypes = []string{"application/pdf"}
+			conf.AttachmentPaths = []string{"downloads/"}
+			w := authenticate(t, conf, userService, id, "/private/main.html")
+
+			if header := w.Header().Get("Content-Disposition"); header != "" {
+				t.Fatalf("expected Content-Disposition not to be set but got %q\n", header)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+// putUser starts a server-side session for the user and puts its ID and the user id in the session.
+func putUser(t *testing.T, conf *config.Config, userService *services.UserService, session *sessions.Session, userID uuid.UUID) {
+	sessionID, err := userService.CreateSession(userID, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values[conf.UserIDKey] = userID.String()
+	session.Values[conf.SessionIDKey] = sessionID
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/kschaper/auth-static/config"
+)
+
+// setContentTypeHeaders sets the Content-Type, X-Content-Type-Options and, if configured,
+// Content-Disposition headers for the file with the given path relative to the protected area.
+func setContentTypeHeaders(w http.ResponseWriter, conf *config.Config, rel string) {
+	typ := contentType(conf, rel)
+	w.Header().Set("Content-Type", typ)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if isAttachment(conf, rel, typ) {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(rel)}))
+	}
+}
+
+// contentType returns the MIME type for the given path. Directories are HTML pages.
+// Files with unknown extensions are sniffed if conf.ProtectedAreaRoot is set.
+// Unknown types fall back to application/octet-stream so browsers don't render them.
+func contentType(conf *config.Config, rel string) string {
+	if rel == "" || strings.HasSuffix(rel, "/") {
+		return "text/html"
+	}
+
+	ext := strings.ToLower(path.Ext(rel))
+	if typ, ok := conf.MIMETypes[ext]; ok {
+		return typ
+	}
+	if typ := mime.TypeByExtension(ext); typ != "" {
+		return typ
+	}
+	if typ := sniffContentType(conf, rel); typ != "" {
+		return typ
+	}
+	return "application/octet-stream"
+}
+
+// sniffContentType returns the MIME type detected from the file's content with http.DetectContentType.
+// It returns an empty string if the file can't be read or the type could be rendered as a page, e.g. HTML.
+func sniffContentType(conf *config.Config, rel string) string {
+	if conf.ProtectedAreaRoot == "" {
+		return ""
+	}
+
+	f, err := os.Open(filepath.Join(conf.ProtectedAreaRoot, filepath.FromSlash(rel)))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	// http.DetectContentType considers at most 512 bytes
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+
+	typ := http.DetectContentType(buf[:n])
+	mediaType, _, err := mime.ParseMediaType(typ)
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case "text/html", "text/xml", "application/octet-stream":
+		return ""
+	}
+	return typ
+}
+
+// isAttachment checks if the file with the given path and MIME type has to be downloaded instead of displayed.
+func isAttachment(conf *config.Config, rel, typ string) bool {
+	for _, prefix := range conf.AttachmentPaths {
+		if strings.HasPrefix(rel, prefix) {
+			return true
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(typ)
+	if err != nil {
+		return false
+	}
+	for _, attachmentType := range conf.AttachmentTypes {
+		if attachmentType == mediaType {
+			return true
+		}
+		if strings.HasSuffix(attachmentType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(attachmentType, "*")) {
+			return true
+		}
+	}
+	return false
+}
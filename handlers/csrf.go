@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/logging"
+)
+
+// csrfFieldName is the name of the forms' hidden field with the anti-CSRF token.
+const csrfFieldName = "csrf_token"
+
+// CSRF protects unsafe requests against cross-site request forgery.
+// Their Origin or, if missing, Referer header must match the request's host or one of the trusted origins,
+// and unless the path is exempt the csrf_token form field or X-CSRF-Token header must match the token in the session.
+// The form handlers put the token in the session with csrfToken.
+func CSRF(conf *config.Config, store *sessions.CookieStore, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS", "TRACE":
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// check origin
+		if err := checkOrigin(conf, r); err != nil {
+			csrfForbidden(w, r, err)
+			return
+		}
+
+		// check token
+		if !isCSRFTokenExempt(conf, r.URL.Path) {
+			session, err := store.Get(r, conf.SessionName)
+			if err != nil {
+				csrfForbidden(w, r, fmt.Errorf("getting session: %s", err))
+				return
+			}
+			expected, _ := session.Values[conf.CSRFTokenKey].(string)
+			actual := r.Header.Get("X-CSRF-Token")
+			if actual == "" {
+				actual = r.PostFormValue(csrfFieldName)
+			}
+			if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+				csrfForbidden(w, r, fmt.Errorf("invalid CSRF token"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkOrigin returns an error if the request's Origin or Referer header is from another host.
+// Requests without both headers pass, e.g. from clients other than browsers or browsers hiding the Referer
+// for privacy. They still need the anti-CSRF token unless the path is exempt, which browsers can't send cross-site.
+func checkOrigin(conf *config.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	for _, trusted := range conf.TrustedOrigins {
+		if strings.EqualFold(u.Host, trusted) {
+			return nil
+		}
+	}
+	return fmt.Errorf("cross-origin request from %q", u.Host)
+}
+
+// isCSRFTokenExempt checks if the path doesn't need a token.
+func isCSRFTokenExempt(conf *config.Config, path string) bool {
+	for _, exempt := range conf.CSRFTokenExemptPaths {
+		if path == exempt {
+			return true
+		}
+	}
+	return false
+}
+
+// csrfForbidden logs the reason and responds with 403.
+func csrfForbidden(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Warn("CSRF check failed", "error", err)
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
+// csrfToken returns the session's anti-CSRF token. A new one is generated if the session doesn't have one yet.
+// The session must be saved afterwards.
+func csrfToken(conf *config.Config, session *sessions.Session) (string, error) {
+	if token, ok := session.Values[conf.CSRFTokenKey].(string); ok && token != "" {
+		return token, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	session.Values[conf.CSRFTokenKey] = token
+	return token, nil
+}
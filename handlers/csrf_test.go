@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+)
+
+// csrf invokes the CSRF middleware with a POST request to path and returns the status code.
+// If sessionToken isn't empty it's put in the session, formToken is sent as the csrf_token form field.
+func csrf(t *testing.T, conf *config.Config, path, sessionToken, formToken string, header http.Header) int {
+	// handler
+	store := sessions.NewCookieStore([]byte("abc"))
+	handler := handlers.CSRF(conf, store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// request
+	form := url.Values{"csrf_token": {formToken}}
+	req := httptest.NewRequest("POST", "http://auth.example.com"+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	// put the token in session
+	if sessionToken != "" {
+		session, err := store.Get(req, conf.SessionName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.Values[conf.CSRFTokenKey] = sessionToken
+	}
+
+	// invoke handler
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestCSRF(t *testing.T) {
+	origin := func(value string) http.Header {
+		return http.Header{"Origin": {value}}
+	}
+
+	cases := map[string]func(t *testing.T){
+		"valid token": func(t *testing.T) {
+			code := csrf(t, config.NewConfig(), "/signin", "token", "token", origin("https://auth.example.com"))
+
+			// ensure the request passed
+			if code != http.StatusNoContent {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusNoContent, code)
+			}
+		},
+		"token header": func(t *testing.T) {
+			code := csrf(t, config.NewConfig(), "/signin", "token", "", http.Header{"X-Csrf-Token": {"token"}})
+
+			// ensure the request passed
+			if code != http.StatusNoContent {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusNoContent, code)
+			}
+		},
+		"wrong token": func(t *testing.T) {
+			code := csrf(t, config.NewConfig(), "/signin", "token", "other", nil)
+
+			// ensure status code 403
+			if code != http.StatusForbidden {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusForbidden, code)
+			}
+		},
+		"no token in session": func(t *testing.T) {
+			code := csrf(t, config.NewConfig(), "/signin", "", "", nil)
+
+			// ensure status code 403
+			if code != http.StatusForbidden {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusForbidden, code)
+			}
+		},
+		"cross-origin": func(t *testing.T) {
+			code := csrf(t, config.NewConfig(), "/signin", "token", "token", origin("https://evil.example.com"))
+
+			// ensure status code 403
+			if code != http.StatusForbidden {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusForbidden, code)
+			}
+		},
+		"cross-origin referer": func(t *testing.T) {
+			code := csrf(t, config.NewConfig(), "/signin", "token", "token", http.Header{"Referer": {"https://evil.example.com/page.html"}})
+
+			// ensure status code 403
+			if code != http.StatusForbidden {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusForbidden, code)
+			}
+		},
+		"trusted origin": func(t *testing.T) {
+			conf := config.NewConfig()
+			conf.TrustedOrigins = []string{"www.example.com"}
+			code := csrf(t, conf, "/signin", "token", "token", origin("https://www.example.com"))
+
+			// ensure the request passed
+			if code != http.StatusNoContent {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusNoContent, code)
+			}
+		},
+		"exempt path": func(t *testing.T) {
+			code := csrf(t, config.NewConfig(), "/signout", "", "", origin("https://auth.example.com"))
+
+			// ensure the request passed without token
+			if code != http.StatusNoContent {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusNoContent, code)
+			}
+		},
+		"exempt path cross-origin": func(t *testing.T) {
+			code := csrf(t, config.NewConfig(), "/signout", "", "", origin("https://evil.example.com"))
+
+			// ensure status code 403
+			if code != http.StatusForbidden {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusForbidden, code)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/i18n"
+	"github.com/kschaper/auth-static/logging"
+	"github.com/kschaper/auth-static/mail"
+	"github.com/kschaper/auth-static/services"
+)
+
+type emailFormTplData struct {
+	layoutData
+	Email     string   // current email
+	CSRFToken string   // from session
+	Notices   []string // translated flash messages
+	Errors    []string // translated flash messages
+}
+
+// emailFormTpl is the built-in email.html.
+const emailFormTpl = `{{define "title"}}{{.L.T "email_change.title"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "email_change.title"}}</h1>
+  {{range .Notices}}
+    <p class="notice">{{.}}</p>
+  {{end}}
+  <p>{{.L.T "email_change.current" .Email}}</p>
+  <form action="/account/email" method="post">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    <label for="email">{{.L.T "email_change.email"}}</label>
+    <input type="text" name="email" id="email">
+    <label for="password">{{.L.T "password_change.current"}}</label>
+    <input type="password" name="password" id="password">
+    <input type="submit" value="{{.L.T "email_change.submit"}}">
+  </form>
+  {{template "errors" .}}
+{{end}}
+`
+
+type emailConfirmTplData struct {
+	layoutData
+	Code      string // from URL
+	NewEmail  string // empty if the code is unknown or expired
+	CSRFToken string // from session
+	Errors    []string
+}
+
+// emailConfirmTpl is the built-in email_confirm.html.
+const emailConfirmTpl = `{{define "title"}}{{.L.T "email_change.title"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "email_change.title"}}</h1>
+  {{if .NewEmail}}
+    <form action="/account/email/{{.Code}}" method="post">
+      <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+      <p>{{.L.T "email_change.confirm" .NewEmail}}</p>
+      <input type="submit" value="{{.L.T "email_change.confirm_submit"}}">
+    </form>
+  {{end}}
+  {{template "errors" .}}
+{{end}}
+`
+
+// EmailFormHandler shows the form to change the email. Users not signed in are redirected to the signin page.
+func EmailFormHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// ensure user is signed in
+		id, err := signedInUserID(conf, store, userService, r)
+		if err != nil {
+			serverError(w, r, "getting signed-in user", err)
+			return
+		}
+		if id == uuid.Nil {
+			http.Redirect(w, r, "/signin", http.StatusFound)
+			return
+		}
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+
+		// template data
+		email, err := userService.GetEmailByID(id)
+		if err != nil {
+			serverError(w, r, "getting email", err)
+			return
+		}
+		token, err := csrfToken(conf, session)
+		if err != nil {
+			serverError(w, r, "generating CSRF token", err)
+			return
+		}
+		data := emailFormTplData{layoutData: newLayoutData(conf, r), Email: email, CSRFToken: token}
+		for _, flash := range session.Flashes(noticeFlashes) {
+			data.Notices = append(data.Notices, data.L.T(fmt.Sprintf("%s", flash)))
+		}
+		for _, flash := range session.Flashes() {
+			data.Errors = append(data.Errors, data.L.T(fmt.Sprintf("%s", flash)))
+		}
+
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+
+		// show page
+		if err := tpl.Execute(w, "email", data); err != nil {
+			serverError(w, r, "rendering template", err)
+		}
+	}
+}
+
+// EmailHandler checks the signed-in user's password and sends a verification link to the new email.
+// The email is changed when the link is followed.
+func EmailHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, mailer mail.Mailer) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			newEmail = strings.TrimSpace(r.PostFormValue("email"))
+			password = r.PostFormValue("password")
+		)
+
+		// ensure user is signed in
+		id, err := signedInUserID(conf, store, userService, r)
+		if err != nil {
+			serverError(w, r, "getting signed-in user", err)
+			return
+		}
+		if id == uuid.Nil {
+			http.Redirect(w, r, "/signin", http.StatusFound)
+			return
+		}
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+
+		// request change
+		if err := requestEmailChange(conf, userService, mailer, r, id, newEmail, password); err != nil {
+			if _, ok := err.(services.Error); !ok {
+				serverError(w, r, "requesting email change", err)
+				return
+			}
+			logging.FromContext(r.Context()).Info("email change rejected", "error", err)
+			session.AddFlash(errorKey(err))
+		} else {
+			session.AddFlash("email_change.sent", noticeFlashes)
+		}
+
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+		http.Redirect(w, r, "/account/email", http.StatusFound)
+	}
+}
+
+// requestEmailChange checks the password, stores the new email and sends the verification link to it.
+func requestEmailChange(conf *config.Config, userService *services.UserService, mailer mail.Mailer, r *http.Request, id uuid.UUID, newEmail, password string) error {
+	// check password
+	email, err := userService.GetEmailByID(id)
+	if err != nil {
+		return err
+	}
+	authenticated, err := userService.Authenticate(email, password)
+	if err != nil {
+		return err
+	}
+	if !authenticated {
+		return services.ErrWrongPassword
+	}
+
+	code, err := userService.RequestEmailChange(id, newEmail)
+	if err != nil {
+		return err
+	}
+
+	// send verification link
+	l := i18n.FromContext(r.Context())
+	return mailer.Send(mail.Message{
+		To:      newEmail,
+		Subject: l.T("email_change.verify_subject", conf.SiteName),
+		Body:    l.T("email_change.verify_body", email, baseURL(conf, r)+"/account/email/"+code),
+	})
+}
+
+// EmailConfirmFormHandler shows the new email of the verification link and a button to confirm it.
+// Mail clients following links must not change the email, so the change needs the POST request.
+func EmailConfirmFormHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			reg  = regexp.MustCompile("[a-z0-9]{32}")
+			code = reg.FindString(r.URL.Path) // TODO: use Gorilla Mux's path vars
+		)
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+
+		// template data
+		token, err := csrfToken(conf, session)
+		if err != nil {
+			serverError(w, r, "generating CSRF token", err)
+			return
+		}
+		data := emailConfirmTplData{layoutData: newLayoutData(conf, r), Code: code, CSRFToken: token}
+		for _, flash := range session.Flashes() {
+			data.Errors = append(data.Errors, data.L.T(fmt.Sprintf("%s", flash)))
+		}
+		data.NewEmail, err = userService.PendingEmailChange(code)
+		if err == services.ErrUnknownCode {
+			if len(data.Errors) == 0 {
+				data.Errors = append(data.Errors, data.L.T(errorKey(err)))
+			}
+		} else if err != nil {
+			serverError(w, r, "getting email change", err)
+			return
+		}
+
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+
+		// show page
+		if err := tpl.Execute(w, "email_confirm", data); err != nil {
+			serverError(w, r, "rendering template", err)
+		}
+	}
+}
+
+// EmailConfirmHandler changes the email, notifies the old address and redirects to the account page.
+// Changes are recorded in the audit log.
+func EmailConfirmHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, mailer mail.Mailer, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			reg  = regexp.MustCompile("[a-z0-9]{32}")
+			code = reg.FindString(r.URL.Path) // TODO: use Gorilla Mux's path vars
+		)
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+
+		// change email
+		change, err := userService.ConfirmEmailChange(code)
+		if err != nil {
+			if _, ok := err.(services.Error); !ok {
+				serverError(w, r, "confirming email change", err)
+				return
+			}
+			logging.FromContext(r.Context()).Info("email change rejected", "error", err)
+			session.AddFlash(errorKey(err))
+			if err := session.Save(r, w); err != nil {
+				serverError(w, r, "saving session", err)
+				return
+			}
+			http.Redirect(w, r, "/account/email/"+code, http.StatusFound)
+			return
+		}
+		record(conf, audit, r, services.AuditEvent{Type: services.AuditEmailChange, UserID: change.UserID, Email: change.NewEmail})
+
+		// notify old address, the change stands if that fails
+		l := i18n.FromContext(r.Context())
+		err = mailer.Send(mail.Message{
+			To:      change.OldEmail,
+			Subject: l.T("email_change.notify_subject", conf.SiteName),
+			Body:    l.T("email_change.notify_body", change.NewEmail),
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("notifying old email", "error", err, "user_id", change.UserID)
+		}
+
+		session.AddFlash("email_change.changed", noticeFlashes)
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+		http.Redirect(w, r, "/account", http.StatusFound)
+	}
+}
+
+// baseURL returns conf.BaseURL or, if empty, the scheme and host of the request.
+// The request's host can be forged, so conf.BaseURL must be set when emails are sent.
+func baseURL(conf *config.Config, r *http.Request) string {
+	if conf.BaseURL != "" {
+		return strings.TrimSuffix(conf.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
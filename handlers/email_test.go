@@ -0,0 +1,192 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/mail"
+	"github.com/kschaper/auth-static/services"
+)
+
+// mailbox records the sent emails.
+type mailbox []mail.Message
+
+func (box *mailbox) Send(msg mail.Message) error {
+	*box = append(*box, msg)
+	return nil
+}
+
+// postForm invokes the handler with the form and the user signed in unless userID is uuid.Nil
+// and returns the response and the session.
+func postForm(t *testing.T, handler func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc, userService *services.UserService, userID uuid.UUID, path string, form url.Values) (*httptest.ResponseRecorder, *sessions.Session) {
+	var (
+		store = sessions.NewCookieStore([]byte("abc"))
+		conf  = config.NewConfig()
+		w     = httptest.NewRecorder()
+	)
+
+	req, err := http.NewRequest("POST", "http://auth.example.com"+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	session, err := store.Get(req, conf.SessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != uuid.Nil {
+		putUser(t, conf, userService, session, userID)
+	}
+
+	// route like cmd/web so the handlers get their path variables
+	router := mux.NewRouter()
+	h := handler(conf, store)
+	router.HandleFunc("/admin/users/{id}", h)
+	router.HandleFunc("/admin/users/{id}/{action}", h)
+	router.HandleFunc("/admin/registrations/{id}/{action}", h)
+	router.PathPrefix("/").Handler(h)
+	router.ServeHTTP(w, req)
+	return w, session
+}
+
+func TestEmailHandler(t *testing.T) {
+	password := strings.Repeat("x", services.PasswordMinLen)
+
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				userID      = createUser(t, userService, "old@example.com", password)
+				box         mailbox
+				audit       = &services.AuditService{DB: userService.DB}
+			)
+
+			// request change
+			w, session := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.EmailHandler(conf, store, userService, &box)
+			}, userService, userID, "/account/email", url.Values{"email": {"new@example.com"}, "password": {password}})
+			if location := w.Header().Get("Location"); location != "/account/email" {
+				t.Fatalf("expected redirect to %s but was to %s\n", "/account/email", location)
+			}
+			if flashes := session.Flashes("notice"); len(flashes) != 1 || flashes[0] != "email_change.sent" {
+				t.Fatalf("expected notice %q but got %v\n", "email_change.sent", flashes)
+			}
+
+			// ensure verification link has been sent to the new email
+			if len(box) != 1 || box[0].To != "new@example.com" {
+				t.Fatalf("expected an email to %s but got %+v\n", "new@example.com", box)
+			}
+			link := regexp.MustCompile(`http://auth\.example\.com/account/email/[a-z0-9]{32}`).FindString(box[0].Body)
+			if link == "" {
+				t.Fatalf("expected a verification link but got %q\n", box[0].Body)
+			}
+
+			// confirm
+			w, session = postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.EmailConfirmHandler(conf, store, userService, &box, audit)
+			}, userService, uuid.Nil, strings.TrimPrefix(link, "http://auth.example.com"), nil)
+			if location := w.Header().Get("Location"); location != "/account" {
+				t.Fatalf("expected redirect to %s but was to %s\n", "/account", location)
+			}
+			if email, err := userService.GetEmailByID(userID); err != nil || email != "new@example.com" {
+				t.Fatalf("expected email %q but got %q, %v\n", "new@example.com", email, err)
+			}
+
+			// ensure old email has been notified
+			if len(box) != 2 || box[1].To != "old@example.com" || !strings.Contains(box[1].Body, "new@example.com") {
+				t.Fatalf("expected a notification to %s but got %+v\n", "old@example.com", box)
+			}
+
+			// ensure change has been recorded
+			events, err := audit.Query(services.AuditFilter{UserID: userID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].Type != services.AuditEmailChange || events[0].Email != "new@example.com" {
+				t.Fatalf("expected an email change event but got %+v\n", events)
+			}
+		},
+		"wrong password": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				userID      = createUser(t, userService, "old@example.com", password)
+				box         mailbox
+			)
+
+			_, session := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.EmailHandler(conf, store, userService, &box)
+			}, userService, userID, "/account/email", url.Values{"email": {"new@example.com"}, "password": {"wrong password"}})
+			if flashes := session.Flashes(); len(flashes) != 1 || flashes[0] != "error.wrong_password" {
+				t.Fatalf("expected error %q but got %v\n", "error.wrong_password", flashes)
+			}
+			if len(box) != 0 {
+				t.Fatalf("expected no email but got %+v\n", box)
+			}
+		},
+		"unknown code": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				box         mailbox
+				code        = "73d3e3502ab73f40d4943fdcc16d05dd"
+			)
+
+			w, session := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.EmailConfirmHandler(conf, store, userService, &box, &services.AuditService{DB: userService.DB})
+			}, userService, uuid.Nil, "/account/email/"+code, nil)
+			if location := w.Header().Get("Location"); location != "/account/email/"+code {
+				t.Fatalf("expected redirect to %s but was to %s\n", "/account/email/"+code, location)
+			}
+			if flashes := session.Flashes(); len(flashes) != 1 || flashes[0] != "error.unknown_code" {
+				t.Fatalf("expected error %q but got %v\n", "error.unknown_code", flashes)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestEmailConfirmFormHandler(t *testing.T) {
+	var (
+		userService = &services.UserService{DB: db(t)}
+		userID      = createUser(t, userService, "old@example.com", strings.Repeat("x", services.PasswordMinLen))
+		store       = sessions.NewCookieStore([]byte("abc"))
+		conf        = config.NewConfig()
+		handler     = handlers.EmailConfirmFormHandler(conf, store, userService, templates(t, conf))
+	)
+	code, err := userService.RequestEmailChange(userID, "new@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]string{
+		"/account/email/" + code:                          `action="/account/email/` + code + `"`,
+		"/account/email/73d3e3502ab73f40d4943fdcc16d05dd": "code unknown",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		// ensure the email isn't changed yet
+		if email, err := userService.GetEmailByID(userID); err != nil || email != "old@example.com" {
+			t.Fatalf("expected email %q but got %q, %v\n", "old@example.com", email, err)
+		}
+		if html := w.Body.String(); !strings.Contains(html, expected) {
+			t.Fatalf("expected html to contain\n%s\nbut didn't:\n%s\n", expected, html)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/logging"
+)
+
+// PublicHandler serves the files of the public site from conf.PublicRoot.
+// Dotfiles and the files of conf.PublicExclude are answered with 404.
+func PublicHandler(conf *config.Config) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hiddenPublicFile(conf, r.URL.Path) {
+			http.Error(w, fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)), http.StatusNotFound)
+			return
+		}
+		serveFile(w, r, conf.PublicRoot, r.URL.Path, conf.DirectoryIndex)
+	}
+}
+
+// hiddenPublicFile checks if the slash-separated name relative to conf.PublicRoot has a segment
+// starting with a dot or if the file's path starts with one of conf.PublicExclude.
+func hiddenPublicFile(conf *config.Config, name string) bool {
+	name = path.Clean("/" + name)
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+
+	file, err := filepath.Abs(filepath.Join(conf.PublicRoot, filepath.FromSlash(name)))
+	if err != nil {
+		return true
+	}
+	for _, excluded := range conf.PublicExclude {
+		if strings.HasPrefix(file, excluded) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveFile serves the file with the given slash-separated name relative to the root directory.
+// Requests for directories are redirected to the URL with a trailing slash and answered with the directory index.
+// Directory listings are not supported. Range, If-Modified-Since and If-None-Match requests are handled by http.ServeContent.
+func serveFile(w http.ResponseWriter, r *http.Request, root, name, index string) {
+	notFoundText := fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound))
+
+	// http.Dir cleans the name so it can't leave the root directory
+	dir := http.Dir(root)
+	name = path.Clean("/" + name)
+
+	file, err := dir.Open(name)
+	if err != nil {
+		logging.FromContext(r.Context()).Debug("opening file", "error", err)
+		http.Error(w, notFoundText, http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		http.Error(w, notFoundText, http.StatusNotFound)
+		return
+	}
+
+	// directory
+	if stat.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+			return
+		}
+
+		index, err := dir.Open(path.Join(name, index))
+		if err != nil {
+			http.Error(w, notFoundText, http.StatusNotFound)
+			return
+		}
+		defer index.Close()
+
+		file = index
+		if stat, err = index.Stat(); err != nil || stat.IsDir() {
+			http.Error(w, notFoundText, http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("ETag", etag(stat))
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), file)
+}
+
+// etag returns a weak entity tag derived from the file's size and modification time.
+func etag(stat os.FileInfo) string {
+	return fmt.Sprintf(`W/"%x-%x"`, stat.ModTime().UnixNano(), stat.Size())
+}
@@ -0,0 +1,242 @@
+package handlers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/services"
+)
+
+// fileTree creates a temporary directory with the given files and returns its path.
+func fileTree(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		filename := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestAuthenticationHandler_ServeFiles(t *testing.T) {
+	var (
+		db          = db(t)
+		userService = &services.UserService{DB: db}
+	)
+
+	// create user
+	code, err := userService.Create("webmaster@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := userService.GetIDByCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// files
+	root := fileTree(t, map[string]string{
+		"main.html":       "<h1>main</h1>",
+		"docs/index.html": "<h1>docs</h1>",
+		"empty/.keep":     "",
+	})
+	defer os.RemoveAll(root)
+	secret := fileTree(t, map[string]string{"secret.txt": "secret"})
+	defer os.RemoveAll(secret)
+
+	conf := config.NewConfig()
+	conf.ServeFiles = true
+	conf.ProtectedAreaRoot = root
+
+	cases := map[string]func(t *testing.T){
+		"file": func(t *testing.T) {
+			w := authenticate(t, conf, userService, id, "/private/main.html")
+
+			// ensure status code 200
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, w.Code)
+			}
+
+			// ensure file content is served
+			if body := w.Body.String(); body != "<h1>main</h1>" {
+				t.Fatalf("expected body %q but got %q\n", "<h1>main</h1>", body)
+			}
+
+			// ensure no header for the web server is set
+			if header := w.Header().Get("X-Accel-Redirect"); header != "" {
+				t.Fatalf("expected X-Accel-Redirect not to be set but got %q\n", header)
+			}
+
+			// ensure ETag is set
+			if header := w.Header().Get("ETag"); header == "" {
+				t.Fatal("expected ETag to be set but wasn't")
+			}
+		},
+		"range": func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/private/main.html", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Range", "bytes=4-7")
+
+			w := authenticateRequest(t, conf, userService, id, req)
+
+			// ensure status code 206
+			if w.Code != http.StatusPartialContent {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusPartialContent, w.Code)
+			}
+			if body := w.Body.String(); body != "main" {
+				t.Fatalf("expected body %q but got %q\n", "main", body)
+			}
+		},
+		"not modified": func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/private/main.html", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+
+			w := authenticateRequest(t, conf, userService, id, req)
+
+			// ensure status code 304
+			if w.Code != http.StatusNotModified {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusNotModified, w.Code)
+			}
+		},
+		"directory index": func(t *testing.T) {
+			w := authenticate(t, conf, userService, id, "/private/docs/")
+
+			// ensure index is served
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, w.Code)
+			}
+			if body := w.Body.String(); body != "<h1>docs</h1>" {
+				t.Fatalf("expected body %q but got %q\n", "<h1>docs</h1>", body)
+			}
+		},
+		"directory without trailing slash": func(t *testing.T) {
+			w := authenticate(t, conf, userService, id, "/private/docs")
+
+			// ensure redirect to URL with trailing slash
+			if w.Code != http.StatusMovedPermanently {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusMovedPermanently, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != "/private/docs/" {
+				t.Fatalf("expected redirect to %s but was to %s\n", "/private/docs/", location)
+			}
+		},
+		"directory without index": func(t *testing.T) {
+			w := authenticate(t, conf, userService, id, "/private/empty/")
+
+			// ensure status code 404
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusNotFound, w.Code)
+			}
+		},
+		"path traversal": func(t *testing.T) {
+			rel, err := filepath.Rel(root, filepath.Join(secret, "secret.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := authenticate(t, conf, userService, id, "/private/"+filepath.ToSlash(rel))
+
+			// ensure status code 404
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusNotFound, w.Code)
+			}
+		},
+		"unknown file": func(t *testing.T) {
+			w := authenticate(t, conf, userService, id, "/private/unknown.html")
+
+			// ensure status code 404
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusNotFound, w.Code)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestPublicHandler(t *testing.T) {
+	root := fileTree(t, map[string]string{
+		"index.html":      "<h1>public</h1>",
+		".git/config":     "[core]",
+		"prod.db":         "users",
+		"prod.db-journal": "users",
+	})
+	defer os.RemoveAll(root)
+
+	conf := config.NewConfig()
+	conf.PublicRoot = root
+	conf.PublicExclude = []string{filepath.Join(root, "prod.db")}
+	handler := handlers.PublicHandler(conf)
+
+	cases := map[string]func(t *testing.T){
+		"index": func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			// ensure index is served
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, w.Code)
+			}
+			if body := w.Body.String(); body != "<h1>public</h1>" {
+				t.Fatalf("expected body %q but got %q\n", "<h1>public</h1>", body)
+			}
+		},
+		"unknown file": func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/unknown.html", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			// ensure status code 404
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusNotFound, w.Code)
+			}
+		},
+		"hidden files": func(t *testing.T) {
+			for _, name := range []string{"/.git/config", "/prod.db", "/prod.db-journal", "/x/../prod.db"} {
+				req, err := http.NewRequest("GET", name, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				w := httptest.NewRecorder()
+				handler(w, req)
+
+				// ensure status code 404
+				if w.Code != http.StatusNotFound {
+					t.Fatalf("expected status code %d for %s but got %d\n", http.StatusNotFound, name, w.Code)
+				}
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/kschaper/auth-static/logging"
+)
+
+// readyTimeout limits the time all readiness checks together may take.
+const readyTimeout = 5 * time.Second
+
+// ReadinessCheck is a named check run by ReadyHandler.
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// healthResponse is the JSON body of HealthHandler and ReadyHandler.
+type healthResponse struct {
+	Status string            `json:"status"`           // ok or unavailable
+	Checks map[string]string `json:"checks,omitempty"` // check name to ok or error message
+}
+
+// HealthHandler responds with 200 as long as the process is able to handle requests.
+// Like ReadyHandler it's not recorded in the audit log.
+func HealthHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, r, http.StatusOK, healthResponse{Status: "ok"})
+	}
+}
+
+// ReadyHandler runs the checks and responds with 200 if all passed and with 503 otherwise.
+// The body lists the result of each check.
+func ReadyHandler(checks ...ReadinessCheck) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+
+		var (
+			status = http.StatusOK
+			resp   = healthResponse{Status: "ok", Checks: map[string]string{}}
+		)
+		for _, check := range checks {
+			if err := check.Check(ctx); err != nil {
+				logging.FromContext(r.Context()).Warn("readiness check failed", "check", check.Name, "error", err)
+				resp.Checks[check.Name] = err.Error()
+				resp.Status = "unavailable"
+				status = http.StatusServiceUnavailable
+				continue
+			}
+			resp.Checks[check.Name] = "ok"
+		}
+		writeHealth(w, r, status, resp)
+	}
+}
+
+// writeHealth writes the response as JSON which must not be cached.
+func writeHealth(w http.ResponseWriter, r *http.Request, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logging.FromContext(r.Context()).Error("writing health response", "error", err)
+	}
+}
@@ -0,0 +1,78 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kschaper/auth-static/handlers"
+)
+
+func TestHealthHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	handlers.HealthHandler()(w, req)
+
+	// ensure status code 200
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d but got %d\n", http.StatusOK, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Fatalf("expected Content-Type %q but got %q\n", "application/json", contentType)
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	var (
+		ok     = handlers.ReadinessCheck{Name: "database", Check: func(ctx context.Context) error { return nil }}
+		failed = handlers.ReadinessCheck{Name: "schema", Check: func(ctx context.Context) error { return errors.New("outdated") }}
+	)
+
+	// ready invokes the ReadyHandler and decodes the body.
+	ready := func(t *testing.T, checks ...handlers.ReadinessCheck) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/readyz", nil)
+		handlers.ReadyHandler(checks...)(w, req)
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, body
+	}
+
+	cases := map[string]func(t *testing.T){
+		"ready": func(t *testing.T) {
+			code, body := ready(t, ok)
+
+			// ensure status code 200 and the check's result
+			if code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, code)
+			}
+			if status := body["checks"].(map[string]interface{})["database"]; status != "ok" {
+				t.Fatalf("expected database check %q but got %q\n", "ok", status)
+			}
+		},
+		"not ready": func(t *testing.T) {
+			code, body := ready(t, ok, failed)
+
+			// ensure status code 503 and the error message
+			if code != http.StatusServiceUnavailable {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusServiceUnavailable, code)
+			}
+			if status := body["status"]; status != "unavailable" {
+				t.Fatalf("expected status %q but got %q\n", "unavailable", status)
+			}
+			if status := body["checks"].(map[string]interface{})["schema"]; status != "outdated" {
+				t.Fatalf("expected schema check %q but got %q\n", "outdated", status)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
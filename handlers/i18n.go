@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/i18n"
+	"github.com/kschaper/auth-static/services"
+)
+
+// errorKeys maps the expected errors to message keys.
+var errorKeys = map[error]string{
+	errSigninFailed:                   "error.signin_failed",
+	services.ErrEmailRequired:         "error.email_required",
+	services.ErrPasswordTooShort:      "error.password_too_short",
+	services.ErrPasswordNotConfirmed:  "error.password_not_confirmed",
+	services.ErrUnknownCode:           "error.unknown_code",
+	services.ErrUnknownUser:           "error.unknown_user",
+	services.ErrPasswordTooLong:       "error.password_too_long",
+	services.ErrPasswordTooSimple:     "error.password_too_simple",
+	services.ErrPasswordContainsEmail: "error.password_contains_email",
+	services.ErrPasswordBreached:      "error.password_breached",
+	services.ErrWrongPassword:         "error.wrong_password",
+	services.ErrEmailUnchanged:        "error.email_unchanged",
+	services.ErrEmailTaken:            "error.email_taken",
+	services.ErrEmailInvalid:          "error.email_invalid",
+	services.ErrEmailDomainNotAllowed: "error.domain_not_allowed",
+	services.ErrEmailDomainDenied:     "error.domain_denied",
+	services.ErrReasonTooLong:         "error.reason_too_long",
+	services.ErrUnknownRegistration:   "error.unknown_registration",
+	services.ErrTooManyRegistrations:  "error.too_many_registrations",
+	services.ErrNameTooLong:           "error.name_too_long",
+	services.ErrGroupInvalid:          "error.group_invalid",
+	services.ErrUserActive:            "error.user_active",
+	services.ErrUserExists:            "error.user_exists",
+	services.ErrUserDisabled:          "error.user_disabled",
+	services.ErrSelf:                  "error.self",
+	services.ErrPathInvalid:           "error.path_invalid",
+	errInviteNotSent:                  "error.invite_not_sent",
+	errNotConfirmed:                   "error.not_confirmed",
+	errUnknownAction:                  "error.unknown_action",
+	errDateInvalid:                    "error.date_invalid",
+}
+
+// errorKey returns the message key of the error. Errors without a key are returned as is
+// which the localizer shows untranslated.
+func errorKey(err error) string {
+	if key, ok := errorKeys[err]; ok {
+		return key
+	}
+	return err.Error()
+}
+
+// Localize passes a localizer to the handlers via the request's context.
+// The language is taken from the language cookie or negotiated from the Accept-Language header.
+func Localize(conf *config.Config, bundle *i18n.Bundle, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var preferred string
+		if cookie, err := r.Cookie(conf.LanguageCookie); err == nil {
+			preferred = cookie.Value
+		}
+		localizer := bundle.Localizer(bundle.Match(preferred, r.Header.Get("Accept-Language")))
+		next.ServeHTTP(w, r.WithContext(i18n.NewContext(r.Context(), localizer)))
+	})
+}
+
+// LanguageHandler stores the language given by the lang query parameter in the language cookie
+// and redirects to the local path given by the next query parameter or to the signin page.
+func LanguageHandler(conf *config.Config, bundle *i18n.Bundle) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := r.URL.Query().Get("lang")
+		if !bundle.Supports(lang) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     conf.LanguageCookie,
+			Value:    lang,
+			Path:     "/",
+			Expires:  time.Now().AddDate(1, 0, 0),
+			HttpOnly: true,
+		})
+
+		// only redirect within the site
+		next := r.URL.Query().Get("next")
+		if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+			next = "/signin"
+		}
+		http.Redirect(w, r, next, http.StatusFound)
+	}
+}
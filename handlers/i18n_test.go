@@ -0,0 +1,110 @@
+package handlers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/i18n"
+)
+
+func TestLocalize(t *testing.T) {
+	var (
+		conf    = config.NewConfig()
+		bundle  = i18n.NewBundle(conf.DefaultLanguage)
+		store   = sessions.NewCookieStore([]byte("abc"))
+		handler = handlers.Localize(conf, bundle, http.HandlerFunc(handlers.SigninFormHandler(conf, store, templates(t, conf))))
+	)
+
+	// signin invokes the signin form with the headers and returns the body.
+	signin := func(t *testing.T, header http.Header) string {
+		req := httptest.NewRequest("GET", "/signin", nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		body, err := ioutil.ReadAll(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	cases := map[string]func(t *testing.T){
+		"default": func(t *testing.T) {
+			html := signin(t, nil)
+
+			// ensure the English page
+			if !strings.Contains(html, `<html lang="en">`) || !strings.Contains(html, "<h1>sign in</h1>") {
+				t.Fatalf("expected the English page but got\n%s\n", html)
+			}
+		},
+		"accept language": func(t *testing.T) {
+			html := signin(t, http.Header{"Accept-Language": {"de-DE,de;q=0.9,en;q=0.8"}})
+
+			// ensure the German page
+			if !strings.Contains(html, `<html lang="de">`) || !strings.Contains(html, "<h1>Anmelden</h1>") {
+				t.Fatalf("expected the German page but got\n%s\n", html)
+			}
+		},
+		"cookie": func(t *testing.T) {
+			html := signin(t, http.Header{"Accept-Language": {"de"}, "Cookie": {"lang=en"}})
+
+			// ensure the cookie wins
+			if !strings.Contains(html, "<h1>sign in</h1>") {
+				t.Fatalf("expected the English page but got\n%s\n", html)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestLanguageHandler(t *testing.T) {
+	var (
+		conf    = config.NewConfig()
+		handler = handlers.LanguageHandler(conf, i18n.NewBundle(conf.DefaultLanguage))
+	)
+
+	cases := map[string]struct {
+		query    string
+		status   int
+		location string
+	}{
+		"success":          {"lang=de&next=/signup/abc", http.StatusFound, "/signup/abc"},
+		"no next":          {"lang=de", http.StatusFound, "/signin"},
+		"external next":    {"lang=de&next=//evil.example.com", http.StatusFound, "/signin"},
+		"absolute next":    {"lang=de&next=https://evil.example.com", http.StatusFound, "/signin"},
+		"unsupported lang": {"lang=xx", http.StatusBadRequest, ""},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "/language?"+c.query, nil))
+
+			// ensure status code and redirect
+			if w.Code != c.status {
+				t.Fatalf("expected status code %d but got %d\n", c.status, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != c.location {
+				t.Fatalf("expected redirect to %q but was to %q\n", c.location, location)
+			}
+
+			// ensure the cookie is set
+			if c.status == http.StatusFound && !strings.HasPrefix(w.Header().Get("Set-Cookie"), "lang=de;") {
+				t.Fatalf("expected language cookie but got %q\n", w.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+}
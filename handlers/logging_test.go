@@ -0,0 +1,153 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/logging"
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestLogging(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"generated request id": func(t *testing.T) {
+			var (
+				buf    bytes.Buffer
+				logger = logging.New(&buf, logging.Info, logging.Logfmt)
+				conf   = config.NewConfig()
+			)
+
+			handler := handlers.Logging(conf, logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "teapot", http.StatusTeapot)
+			}))
+			req, err := http.NewRequest("GET", "/signin", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			// ensure request id header is set
+			id := w.Header().Get("X-Request-ID")
+			if len(id) != 32 {
+				t.Fatalf("expected generated X-Request-ID but got %q\n", id)
+			}
+
+			// ensure access log contains request id and status
+			line := buf.String()
+			for _, expected := range []string{"request_id=" + id, "status=418", "path=/signin", "method=GET"} {
+				if !strings.Contains(line, expected) {
+					t.Fatalf("expected log to contain %q but didn't: %s", expected, line)
+				}
+			}
+		},
+		"forwarded ip": func(t *testing.T) {
+			var (
+				buf    bytes.Buffer
+				logger = logging.New(&buf, logging.Info, logging.Logfmt)
+				conf   = config.NewConfig()
+			)
+			conf.RealIPHeader = "X-Forwarded-For"
+
+			handler := handlers.Logging(conf, logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the client sent a spoofed entry, the web server appended the client's address
+			req.Header.Set("X-Forwarded-For", "192.0.2.66, 198.51.100.7")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			// ensure the entry of the web server is logged
+			if line := buf.String(); !strings.Contains(line, "ip=198.51.100.7") {
+				t.Fatalf("expected log to contain %q but didn't: %s", "ip=198.51.100.7", line)
+			}
+		},
+		"request id from web server": func(t *testing.T) {
+			var (
+				logger = logging.New(&bytes.Buffer{}, logging.Info, logging.Logfmt)
+				conf   = config.NewConfig()
+			)
+
+			handler := handlers.Logging(conf, logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Request-ID", "f00-ba7")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if id := w.Header().Get("X-Request-ID"); id != "f00-ba7" {
+				t.Fatalf("expected X-Request-ID %q but got %q\n", "f00-ba7", id)
+			}
+		},
+		"invalid request id from web server": func(t *testing.T) {
+			var (
+				logger = logging.New(&bytes.Buffer{}, logging.Info, logging.Logfmt)
+				conf   = config.NewConfig()
+			)
+
+			handler := handlers.Logging(conf, logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Request-ID", "evil\" msg=injected")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if id := w.Header().Get("X-Request-ID"); id == "evil\" msg=injected" || id == "" {
+				t.Fatalf("expected generated X-Request-ID but got %q\n", id)
+			}
+		},
+		"handler error": func(t *testing.T) {
+			var (
+				buf         bytes.Buffer
+				logger      = logging.New(&buf, logging.Info, logging.Logfmt)
+				db          = db(t)
+				userService = &services.UserService{DB: db}
+				store       = sessions.NewCookieStore([]byte("abc"))
+				conf        = config.NewConfig()
+			)
+
+			// make the database fail
+			db.Close()
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/signin/", handlers.SigninHandler(conf, store, userService, &services.AuditService{DB: db}))
+			ts := httptest.NewServer(handlers.Logging(conf, logger, mux))
+			defer ts.Close()
+
+			resp, err := http.PostForm(ts.URL+"/signin/", url.Values{"password": {"xxx"}, "email": {"xxx@example.com"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			// ensure status code 500
+			if resp.StatusCode != http.StatusInternalServerError {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusInternalServerError, resp.StatusCode)
+			}
+
+			// ensure the underlying error is logged with the request id
+			id := resp.Header.Get("X-Request-ID")
+			expected := `level=error msg=authenticating request_id=` + id + ` error=`
+			if !strings.Contains(buf.String(), expected) {
+				t.Fatalf("expected log to contain %q but didn't: %s", expected, buf.String())
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
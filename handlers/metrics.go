@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/kschaper/auth-static/metrics"
+)
+
+// authentication check outcomes
+const (
+	outcomeGranted   = "granted"   // signed in and within the protected area
+	outcomeDenied    = "denied"    // not signed in
+	outcomeForbidden = "forbidden" // signed in but outside the protected area
+	outcomeError     = "error"
+)
+
+var (
+	signinsTotal = metrics.NewCounterVec("auth_static_signins_total",
+		"Signin attempts by result.", "result")
+	signupsTotal = metrics.NewCounterVec("auth_static_signups_total",
+		"Completed signups.")
+	authChecksTotal = metrics.NewCounterVec("auth_static_authentication_checks_total",
+		"Authentication checks of protected files and verify subrequests by outcome.", "outcome")
+	requestDuration = metrics.NewHistogramVec("auth_static_http_request_duration_seconds",
+		"Time spent handling requests by handler.", metrics.DefBuckets, "handler")
+)
+
+func init() {
+	metrics.Register(signinsTotal, signupsTotal, authChecksTotal, requestDuration)
+}
+
+// Instrument measures the duration of the handler's requests labeled with the given name.
+func Instrument(name string, next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next(w, r)
+		requestDuration.Observe(time.Since(start).Seconds(), name)
+	}
+}
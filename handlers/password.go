@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/logging"
+	"github.com/kschaper/auth-static/services"
+)
+
+// noticeFlashes is the flash key of success messages. Error messages use the default key.
+const noticeFlashes = "notice"
+
+type passwordFormTplData struct {
+	layoutData
+	PasswordRules []string // translated rules of the password policy
+	CSRFToken     string   // from session
+	Notices       []string // translated flash messages
+	Errors        []string // translated flash messages
+}
+
+// passwordFormTpl is the built-in password.html.
+const passwordFormTpl = `{{define "title"}}{{.L.T "password_change.title"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "password_change.title"}}</h1>
+  {{range .Notices}}
+    <p class="notice">{{.}}</p>
+  {{end}}
+  <p>{{.L.T "signup.password_rules"}}</p>
+  <ul class="rules">
+    {{range .PasswordRules}}
+      <li>{{.}}</li>
+    {{end}}
+  </ul>
+  <form action="/account/password" method="post">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    <label for="current">{{.L.T "password_change.current"}}</label>
+    <input type="password" name="current" id="current">
+    <label for="password">{{.L.T "password_change.password"}}</label>
+    <input type="password" name="password" id="password">
+    <label for="confirmation">{{.L.T "password_change.confirmation"}}</label>
+    <input type="password" name="confirmation" id="confirmation">
+    <label><input type="checkbox" name="revoke" value="1" checked> {{.L.T "password_change.revoke"}}</label>
+    <input type="submit" value="{{.L.T "password_change.submit"}}">
+  </form>
+  {{template "errors" .}}
+{{end}}
+`
+
+// PasswordFormHandler shows the form to change the password. Users not signed in are redirected to the signin page.
+func PasswordFormHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// ensure user is signed in
+		id, err := signedInUserID(conf, store, userService, r)
+		if err != nil {
+			serverError(w, r, "getting signed-in user", err)
+			return
+		}
+		if id == uuid.Nil {
+			http.Redirect(w, r, "/signin", http.StatusFound)
+			return
+		}
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+
+		// template data
+		token, err := csrfToken(conf, session)
+		if err != nil {
+			serverError(w, r, "generating CSRF token", err)
+			return
+		}
+		data := passwordFormTplData{layoutData: newLayoutData(conf, r), CSRFToken: token}
+		for _, rule := range userService.PasswordPolicy().Rules() {
+			data.PasswordRules = append(data.PasswordRules, data.L.T(rule.Key, rule.Args...))
+		}
+		for _, flash := range session.Flashes(noticeFlashes) {
+			data.Notices = append(data.Notices, data.L.T(fmt.Sprintf("%s", flash)))
+		}
+		for _, flash := range session.Flashes() {
+			data.Errors = append(data.Errors, data.L.T(fmt.Sprintf("%s", flash)))
+		}
+
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+
+		// show page
+		if err := tpl.Execute(w, "password", data); err != nil {
+			serverError(w, r, "rendering template", err)
+		}
+	}
+}
+
+// PasswordHandler changes the password of the signed-in user after checking the current one.
+// On success the session is replaced by a new one with a new anti-CSRF token, and if the revoke field is set
+// the user's other sessions are deleted. Changes are recorded in the audit log.
+func PasswordHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			current      = r.PostFormValue("current")
+			password     = r.PostFormValue("password")
+			confirmation = r.PostFormValue("confirmation")
+			revoke       = r.PostFormValue("revoke") != ""
+		)
+
+		// ensure user is signed in
+		id, err := signedInUserID(conf, store, userService, r)
+		if err != nil {
+			serverError(w, r, "getting signed-in user", err)
+			return
+		}
+		if id == uuid.Nil {
+			http.Redirect(w, r, "/signin", http.StatusFound)
+			return
+		}
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+
+		// change password
+		if err := changePassword(conf, session, userService, audit, r, id, current, password, confirmation, revoke); err != nil {
+			switch err.(type) {
+			case services.Error:
+				logging.FromContext(r.Context()).Info("password change rejected", "error", err)
+				session.AddFlash(errorKey(err))
+			default:
+				serverError(w, r, "changing password", err)
+				return
+			}
+		} else {
+			session.AddFlash("password_change.changed", noticeFlashes)
+		}
+
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+		http.Redirect(w, r, "/account/password", http.StatusFound)
+	}
+}
+
+// changePassword changes the password, replaces the server-side session and the anti-CSRF token,
+// optionally deletes the user's other sessions and records the change. The caller saves the session.
+func changePassword(conf *config.Config, session *sessions.Session, userService *services.UserService, audit services.AuditSink, r *http.Request, id uuid.UUID, current, password, confirmation string, revoke bool) error {
+	if err := userService.ChangePassword(id, current, password, confirmation); err != nil {
+		return err
+	}
+
+	// rotate session and anti-CSRF token
+	if err := startSession(conf, session, userService, r, id); err != nil {
+		return err
+	}
+
+	// sign out other devices
+	if revoke {
+		sessionID, _ := session.Values[conf.SessionIDKey].(string)
+		if _, err := userService.DeleteOtherSessions(id, sessionID); err != nil {
+			return err
+		}
+	}
+
+	record(conf, audit, r, services.AuditEvent{Type: services.AuditPasswordChange, UserID: id})
+	return nil
+}
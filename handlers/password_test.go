@@ -0,0 +1,248 @@
+package handlers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/services"
+)
+
+// sessionCount returns the number of the user's server-side sessions.
+func sessionCount(t *testing.T, userService *services.UserService, userID uuid.UUID) int {
+	var count int
+	if err := userService.DB.QueryRow("SELECT COUNT(id) FROM sessions WHERE user_id = ?", userID).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestPasswordFormHandler(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"signed in": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				userID      = createUser(t, userService, "me@example.com", strings.Repeat("x", services.PasswordMinLen))
+				store       = sessions.NewCookieStore([]byte("abc"))
+				conf        = config.NewConfig()
+				handler     = handlers.PasswordFormHandler(conf, store, userService, templates(t, conf))
+				w           = httptest.NewRecorder()
+			)
+
+			// request
+			req, err := http.NewRequest("GET", "/account/password", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session, err := store.Get(req, conf.SessionName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			putUser(t, conf, userService, session, userID)
+
+			// invoke handler
+			handler(w, req)
+
+			// ensure form is shown
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, w.Code)
+			}
+			body, err := ioutil.ReadAll(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, expected := range []string{`action="/account/password"`, `name="current"`, `name="revoke"`, "at least 8 characters"} {
+				if !strings.Contains(string(body), expected) {
+					t.Fatalf("expected html to contain\n%s\nbut didn't:\n%s\n", expected, body)
+				}
+			}
+		},
+		"not signed in": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				store       = sessions.NewCookieStore([]byte("abc"))
+				conf        = config.NewConfig()
+				handler     = handlers.PasswordFormHandler(conf, store, userService, templates(t, conf))
+				w           = httptest.NewRecorder()
+			)
+
+			req, err := http.NewRequest("GET", "/account/password", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler(w, req)
+
+			// ensure redirect to signin page
+			if w.Code != http.StatusFound {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusFound, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != "/signin" {
+				t.Fatalf("expected redirect to %s but was to %s\n", "/signin", location)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestPasswordHandler(t *testing.T) {
+	var (
+		email       = "me@example.com"
+		password    = strings.Repeat("x", services.PasswordMinLen)
+		newPassword = strings.Repeat("y", services.PasswordMinLen)
+	)
+
+	// change posts the form with a signed-in user who has another session on a second device
+	// and returns the response and the session.
+	change := func(t *testing.T, userService *services.UserService, userID uuid.UUID, form url.Values) (*httptest.ResponseRecorder, *sessions.Session) {
+		var (
+			store   = sessions.NewCookieStore([]byte("abc"))
+			conf    = config.NewConfig()
+			audit   = &services.AuditService{DB: userService.DB}
+			handler = handlers.PasswordHandler(conf, store, userService, audit)
+			w       = httptest.NewRecorder()
+		)
+
+		// second device
+		if _, err := userService.CreateSession(userID, "", ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// request
+		req, err := http.NewRequest("POST", "/account/password", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session, err := store.Get(req, conf.SessionName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		putUser(t, conf, userService, session, userID)
+		session.Values[conf.CSRFTokenKey] = "token"
+
+		// invoke handler
+		handler(w, req)
+		return w, session
+	}
+
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				userID      = createUser(t, userService, email, password)
+				conf        = config.NewConfig()
+			)
+
+			w, session := change(t, userService, userID, url.Values{"current": {password}, "password": {newPassword}, "confirmation": {newPassword}, "revoke": {"1"}})
+
+			// ensure redirect to form
+			if w.Code != http.StatusFound {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusFound, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != "/account/password" {
+				t.Fatalf("expected redirect to %s but was to %s\n", "/account/password", location)
+			}
+
+			// ensure password has been changed
+			if ok, err := userService.Authenticate(email, newPassword); err != nil || !ok {
+				t.Fatalf("expected new password to work but got %t, %v\n", ok, err)
+			}
+
+			// ensure session has been rotated and other sessions are revoked
+			if count := sessionCount(t, userService, userID); count != 1 {
+				t.Fatalf("expected 1 session but got %d\n", count)
+			}
+			sessionID, _ := session.Values[conf.SessionIDKey].(string)
+			if id, err := userService.SessionUserID(sessionID); err != nil || id != userID {
+				t.Fatalf("expected new session of user %s but got %s, %v\n", userID, id, err)
+			}
+			if token := session.Values[conf.CSRFTokenKey]; token != nil {
+				t.Fatalf("expected CSRF token to be removed but got %q\n", token)
+			}
+			if flashes := session.Flashes("notice"); len(flashes) != 1 || flashes[0] != "password_change.changed" {
+				t.Fatalf("expected notice %q but got %v\n", "password_change.changed", flashes)
+			}
+
+			// ensure change has been recorded
+			events, err := (&services.AuditService{DB: userService.DB}).Query(services.AuditFilter{UserID: userID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].Type != services.AuditPasswordChange {
+				t.Fatalf("expected a password change event but got %+v\n", events)
+			}
+		},
+		"keep other sessions": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				userID      = createUser(t, userService, email, password)
+			)
+
+			w, _ := change(t, userService, userID, url.Values{"current": {password}, "password": {newPassword}, "confirmation": {newPassword}})
+			if w.Code != http.StatusFound {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusFound, w.Code)
+			}
+
+			// ensure the other device's session is kept
+			if count := sessionCount(t, userService, userID); count != 2 {
+				t.Fatalf("expected 2 sessions but got %d\n", count)
+			}
+		},
+		"wrong current password": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				userID      = createUser(t, userService, email, password)
+			)
+
+			w, session := change(t, userService, userID, url.Values{"current": {newPassword}, "password": {newPassword}, "confirmation": {newPassword}, "revoke": {"1"}})
+			if w.Code != http.StatusFound {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusFound, w.Code)
+			}
+
+			// ensure nothing has changed
+			if ok, err := userService.Authenticate(email, password); err != nil || !ok {
+				t.Fatalf("expected old password to work but got %t, %v\n", ok, err)
+			}
+			if count := sessionCount(t, userService, userID); count != 2 {
+				t.Fatalf("expected 2 sessions but got %d\n", count)
+			}
+			if flashes := session.Flashes(); len(flashes) != 1 || flashes[0] != "error.wrong_password" {
+				t.Fatalf("expected error %q but got %v\n", "error.wrong_password", flashes)
+			}
+		},
+		"not signed in": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				store       = sessions.NewCookieStore([]byte("abc"))
+				conf        = config.NewConfig()
+				handler     = handlers.PasswordHandler(conf, store, userService, &services.AuditService{DB: userService.DB})
+				w           = httptest.NewRecorder()
+			)
+
+			req, err := http.NewRequest("POST", "/account/password", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler(w, req)
+
+			if location := w.Header().Get("Location"); location != "/signin" {
+				t.Fatalf("expected redirect to %s but was to %s\n", "/signin", location)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/kschaper/auth-static/config"
+)
+
+// errBadPath is returned for URLs which must not be mapped to a file.
+var errBadPath = errors.New("bad path")
+
+// protectedPath returns the cleaned and decoded path of the URL relative to the protected area,
+// e.g. "images/deers.jpg" for "/private/images/deers.jpg". A trailing slash is kept.
+// URLs outside the protected area and URLs with `..` segments, null bytes, backslashes
+// or encoded separators are rejected with errBadPath.
+func protectedPath(conf *config.Config, u *url.URL) (string, error) {
+	// encoded separators and null bytes
+	escaped := strings.ToLower(u.EscapedPath())
+	for _, s := range []string{"%2f", "%5c", "%00"} {
+		if strings.Contains(escaped, s) {
+			return "", errBadPath
+		}
+	}
+
+	// decoded null bytes and backslashes
+	p := u.Path
+	if strings.ContainsAny(p, "\x00\\") {
+		return "", errBadPath
+	}
+
+	// anchor at the protected area's prefix
+	if !strings.HasPrefix(p, conf.ProtectedAreaDirExternal) {
+		return "", errBadPath
+	}
+	rel := p[len(conf.ProtectedAreaDirExternal):]
+
+	// traversal
+	for _, segment := range strings.Split(rel, "/") {
+		if segment == ".." {
+			return "", errBadPath
+		}
+	}
+
+	// remove `.` segments and duplicate slashes
+	cleaned := path.Clean("/" + rel)[1:]
+	if cleaned != "" && strings.HasSuffix(rel, "/") {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
+
+// internalURL returns the URL of the protected area's path for the web server.
+// The query string is passed through if conf.PassQuery is set.
+func internalURL(conf *config.Config, u *url.URL, rel string) string {
+	internal := &url.URL{Path: conf.ProtectedAreaDirInternal + rel}
+	if conf.PassQuery {
+		internal.RawQuery = u.RawQuery
+	}
+	return internal.String()
+}
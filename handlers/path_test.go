@@ -0,0 +1,84 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestAuthenticationHandler_PathMapping(t *testing.T) {
+	var (
+		db          = db(t)
+		userService = &services.UserService{DB: db}
+	)
+
+	// create user
+	code, err := userService.Create("webmaster@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := userService.GetIDByCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		url       string
+		passQuery bool
+		redirect  string // empty if the request has to be rejected
+	}{
+		{"file", "/private/images/deers.jpg", false, "/internal/images/deers.jpg"},
+		{"directory", "/private/images/", false, "/internal/images/"},
+		{"root", "/private/", false, "/internal/"},
+		{"encoded space", "/private/my%20file.pdf", false, "/internal/my%20file.pdf"},
+		{"dot segment", "/private/./images/./deers.jpg", false, "/internal/images/deers.jpg"},
+		{"duplicate slashes", "/private//images//deers.jpg", false, "/internal/images/deers.jpg"},
+		{"query dropped", "/private/main.html?a=b", false, "/internal/main.html"},
+		{"query passed", "/private/main.html?a=b", true, "/internal/main.html?a=b"},
+		{"prefix in query", "/private/main.html?next=/private/", false, "/internal/main.html"},
+		{"traversal", "/private/../secret.txt", false, ""},
+		{"traversal within", "/private/images/../../secret.txt", false, ""},
+		{"encoded traversal", "/private/%2e%2e/secret.txt", false, ""},
+		{"encoded slash", "/private/..%2fsecret.txt", false, ""},
+		{"encoded backslash", "/private/..%5csecret.txt", false, ""},
+		{"backslash", `/private/..\secret.txt`, false, ""},
+		{"null byte", "/private/main.html%00.jpg", false, ""},
+		{"prefix not anchored", "/public/private/main.html", false, ""},
+		{"prefix without slash", "/privatefiles/main.html", false, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conf := config.NewConfig()
+			conf.PassQuery = c.passQuery
+
+			req, err := http.NewRequest("GET", c.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := authenticateRequest(t, conf, userService, id, req)
+
+			// ensure rejected URLs are not found
+			if c.redirect == "" {
+				if w.Code != http.StatusNotFound {
+					t.Fatalf("expected status code %d but got %d\n", http.StatusNotFound, w.Code)
+				}
+				if header := w.Header().Get("X-Accel-Redirect"); header != "" {
+					t.Fatalf("expected X-Accel-Redirect not to be set but got %q\n", header)
+				}
+				return
+			}
+
+			// ensure X-Accel-Redirect header has correct value
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, w.Code)
+			}
+			if header := w.Header().Get("X-Accel-Redirect"); header != c.redirect {
+				t.Fatalf("expected X-Accel-Redirect %q but got %q\n", c.redirect, header)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/logging"
+	"github.com/kschaper/auth-static/services"
+)
+
+type registerFormTplData struct {
+	layoutData
+	CSRFToken string   // from session
+	Notices   []string // translated flash messages
+	Errors    []string // translated flash messages
+}
+
+// registerFormTpl is the built-in register.html.
+const registerFormTpl = `{{define "title"}}{{.L.T "registration.title"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "registration.title"}}</h1>
+  {{range .Notices}}
+    <p class="notice">{{.}}</p>
+  {{end}}
+  <p>{{.L.T "registration.intro"}}</p>
+  <form action="/register" method="post">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    <label for="email">{{.L.T "registration.email"}}</label>
+    <input type="text" name="email" id="email">
+    <label for="reason">{{.L.T "registration.reason"}}</label>
+    <textarea name="reason" id="reason" rows="4"></textarea>
+    <input type="submit" value="{{.L.T "registration.submit"}}">
+  </form>
+  {{template "errors" .}}
+{{end}}
+`
+
+// RegisterFormHandler shows the form where visitors ask for an account.
+func RegisterFormHandler(conf *config.Config, store *sessions.CookieStore, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+
+		// template data
+		token, err := csrfToken(conf, session)
+		if err != nil {
+			serverError(w, r, "generating CSRF token", err)
+			return
+		}
+		data := registerFormTplData{layoutData: newLayoutData(conf, r), CSRFToken: token}
+		for _, flash := range session.Flashes(noticeFlashes) {
+			data.Notices = append(data.Notices, data.L.T(fmt.Sprintf("%s", flash)))
+		}
+		for _, flash := range session.Flashes() {
+			data.Errors = append(data.Errors, data.L.T(fmt.Sprintf("%s", flash)))
+		}
+
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+
+		// show page
+		if err := tpl.Execute(w, "register", data); err != nil {
+			serverError(w, r, "rendering template", err)
+		}
+	}
+}
+
+// RegisterHandler stores a pending registration which admins approve or reject. The visitor gets the same
+// notice whether or not the email already has an account. Registrations are recorded in the audit log.
+func RegisterHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			email  = strings.TrimSpace(r.PostFormValue("email"))
+			reason = strings.TrimSpace(r.PostFormValue("reason"))
+		)
+
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+
+		// register
+		if err := userService.Register(email, reason, clientIP(conf, r)); err != nil {
+			if _, ok := err.(services.Error); !ok {
+				serverError(w, r, "registering", err)
+				return
+			}
+			logging.FromContext(r.Context()).Info("registration rejected", "error", err)
+			session.AddFlash(errorKey(err))
+		} else {
+			record(conf, audit, r, services.AuditEvent{Type: services.AuditRegistration, Email: email})
+			session.AddFlash("registration.sent", noticeFlashes)
+		}
+
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+		http.Redirect(w, r, "/register", http.StatusFound)
+	}
+}
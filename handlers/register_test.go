@@ -0,0 +1,68 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestRegisterHandler(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				audit       = &services.AuditService{DB: userService.DB}
+			)
+
+			w, session := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.RegisterHandler(conf, store, userService, audit)
+			}, userService, uuid.Nil, "/register", url.Values{"email": {"me@example.com"}, "reason": {"I'm new here"}})
+			if location := w.Header().Get("Location"); location != "/register" {
+				t.Fatalf("expected redirect to %s but was to %s\n", "/register", location)
+			}
+			if flashes := session.Flashes("notice"); len(flashes) != 1 || flashes[0] != "registration.sent" {
+				t.Fatalf("expected notice %q but got %v\n", "registration.sent", flashes)
+			}
+
+			// ensure registration is pending and recorded
+			pending, err := userService.Registrations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pending) != 1 || pending[0].Email != "me@example.com" || pending[0].Reason != "I'm new here" {
+				t.Fatalf("expected a registration of %q but got %+v\n", "me@example.com", pending)
+			}
+			events, err := audit.Query(services.AuditFilter{Email: "me@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].Type != services.AuditRegistration {
+				t.Fatalf("expected a registration event but got %+v\n", events)
+			}
+		},
+		"invalid email": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+
+			_, session := postForm(t, func(conf *config.Config, store *sessions.CookieStore) http.HandlerFunc {
+				return handlers.RegisterHandler(conf, store, userService, &services.AuditService{DB: userService.DB})
+			}, userService, uuid.Nil, "/register", url.Values{"email": {"me"}})
+			if flashes := session.Flashes(); len(flashes) != 1 || flashes[0] != "error.email_invalid" {
+				t.Fatalf("expected error %q but got %v\n", "error.email_invalid", flashes)
+			}
+			if pending, err := userService.Registrations(); err != nil || len(pending) != 0 {
+				t.Fatalf("expected no registrations but got %+v, %v\n", pending, err)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/kschaper/auth-static/config"
+)
+
+// setSendfileHeaders sets the headers telling the web server to serve the file
+// with the given path relative to the protected area.
+func setSendfileHeaders(w http.ResponseWriter, r *http.Request, conf *config.Config, rel string) {
+	switch conf.SendfileHeader {
+	case config.SendfileApache, config.SendfileLighttpd:
+		// absolute filesystem path
+		w.Header().Set(conf.SendfileHeader, filepath.Join(conf.ProtectedAreaRoot, filepath.FromSlash(rel)))
+
+	default:
+		// internal URL path
+		w.Header().Set(config.SendfileAccel, internalURL(conf, r.URL, rel))
+		for header, value := range map[string]string{
+			"X-Accel-Buffering":  conf.AccelBuffering,
+			"X-Accel-Expires":    conf.AccelExpires,
+			"X-Accel-Limit-Rate": conf.AccelLimitRate,
+		} {
+			if value != "" {
+				w.Header().Set(header, value)
+			}
+		}
+	}
+}
@@ -2,119 +2,111 @@ package handlers
 
 import (
 	"fmt"
-	"html/template"
-	"log"
 	"net/http"
 
+	"github.com/satori/go.uuid"
+
 	"github.com/gorilla/sessions"
 	"github.com/kschaper/auth-static/config"
 	"github.com/kschaper/auth-static/services"
 )
 
+// errSigninFailed is returned by signIn if email and/or password are wrong.
+var errSigninFailed = services.Error("email and/or password wrong")
+
 type signinFormTplData struct {
-	Errors []string // from flash messages
+	layoutData
+	CSRFToken    string   // from session
+	Registration bool     // link to the registration page
+	Errors       []string // translated flash messages
 }
 
-const signinFormTpl = `<!DOCTYPE html>
-<html lang="en">
-  <head>
-    <meta charset="UTF-8">
-    <title>sign in</title>
-  </head>
-  <body>
-		<h1>sign in</h1>
-    <form action="/signin" method="post">
-      email: <input type="text" name="email">
-      password: <input type="password" name="password">
-      <input type="submit" value="sign in">
-		</form>
-		{{if .Errors}}
-			<ul>
-				{{range .Errors}}
-					<li>{{.}}</li>
-				{{end}}
-			</ul>
-		{{end}}
-  </body>
-</html>
+// signinFormTpl is the built-in signin.html.
+const signinFormTpl = `{{define "title"}}{{.L.T "signin.title"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "signin.title"}}</h1>
+  <form action="/signin" method="post">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    <label for="email">{{.L.T "signin.email"}}</label>
+    <input type="text" name="email" id="email">
+    <label for="password">{{.L.T "signin.password"}}</label>
+    <input type="password" name="password" id="password">
+    <input type="submit" value="{{.L.T "signin.submit"}}">
+  </form>
+  {{template "errors" .}}
+  {{if .Registration}}
+    <p><a href="/register">{{.L.T "signin.register"}}</a></p>
+  {{end}}
+{{end}}
 `
 
 // SigninFormHandler shows the signin form.
-func SigninFormHandler(conf *config.Config, store *sessions.CookieStore) func(w http.ResponseWriter, r *http.Request) {
+func SigninFormHandler(conf *config.Config, store *sessions.CookieStore, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tpl := template.Must(template.New("signin").Parse(signinFormTpl))
-
 		// get session
 		session, err := store.Get(r, conf.SessionName)
 		if err != nil {
-			log.Print(err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			serverError(w, r, "getting session", err)
 			return
 		}
 
 		// template data
-		data := signinFormTplData{}
+		token, err := csrfToken(conf, session)
+		if err != nil {
+			serverError(w, r, "generating CSRF token", err)
+			return
+		}
+		data := signinFormTplData{layoutData: newLayoutData(conf, r), CSRFToken: token, Registration: conf.Registration}
 		if flashes := session.Flashes(); len(flashes) > 0 {
 			for _, flash := range flashes {
-				data.Errors = append(data.Errors, fmt.Sprintf("%s", flash))
+				data.Errors = append(data.Errors, data.L.T(fmt.Sprintf("%s", flash)))
 			}
 		}
 
 		if err := session.Save(r, w); err != nil {
-			log.Print(err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			serverError(w, r, "saving session", err)
 			return
 		}
 
 		// show page
-		tpl.Execute(w, data)
+		if err := tpl.Execute(w, "signin", data); err != nil {
+			serverError(w, r, "rendering template", err)
+		}
 	}
 }
 
-// SigninHandler authenticates and redirects.
-func SigninHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService) func(w http.ResponseWriter, r *http.Request) {
+// SigninHandler authenticates and redirects. Successful and failed signins are recorded in the audit log.
+func SigninHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
 			email    = r.PostFormValue("email")
 			password = r.PostFormValue("password")
 		)
 
-		// authenticate
-		authenticated, err := userService.Authenticate(email, password)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
-
 		// get session
 		session, err := store.Get(r, conf.SessionName)
 		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			serverError(w, r, "getting session", err)
 			return
 		}
 
-		// handle authentication failed
-		if !authenticated {
-			session.AddFlash("email and/or password wrong")
+		// authenticate
+		if _, err := signIn(conf, session, userService, audit, r, email, password); err != nil {
+			if err != errSigninFailed {
+				serverError(w, r, "authenticating", err)
+				return
+			}
+			session.AddFlash(errorKey(err))
 			if err := session.Save(r, w); err != nil {
-				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				serverError(w, r, "saving session", err)
 				return
 			}
 			http.Redirect(w, r, "/signin", http.StatusFound)
 			return
 		}
 
-		// get user id
-		id, err := userService.GetIDByEmail(email)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
-
-		// store user id in session
-		session.Values[conf.UserIDKey] = id.String()
 		if err := session.Save(r, w); err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			serverError(w, r, "saving session", err)
 			return
 		}
 
@@ -122,3 +114,36 @@ func SigninHandler(conf *config.Config, store *sessions.CookieStore, userService
 		http.Redirect(w, r, conf.ProtectedAreaDirExternal+conf.ProtectedAreaHome, http.StatusFound)
 	}
 }
+
+// signIn authenticates the user, starts a server-side session and records the attempt.
+// It returns errSigninFailed if email and/or password are wrong. The caller saves the session.
+func signIn(conf *config.Config, session *sessions.Session, userService *services.UserService, audit services.AuditSink, r *http.Request, email, password string) (uuid.UUID, error) {
+	// authenticate
+	authenticated, err := userService.Authenticate(email, password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !authenticated {
+		record(conf, audit, r, services.AuditEvent{Type: services.AuditSigninFailure, Email: email})
+		signinsTotal.Inc("failure")
+		return uuid.Nil, errSigninFailed
+	}
+
+	// get user id
+	id, err := userService.GetIDByEmail(email)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// start a new server-side session
+	if err := startSession(conf, session, userService, r, id); err != nil {
+		return uuid.Nil, err
+	}
+	if err := userService.SetLastSignin(id); err != nil {
+		return uuid.Nil, err
+	}
+
+	record(conf, audit, r, services.AuditEvent{Type: services.AuditSigninSuccess, UserID: id, Email: email})
+	signinsTotal.Inc("success")
+	return id, nil
+}
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/sessions"
 	"github.com/kschaper/auth-static/config"
@@ -22,7 +23,7 @@ func TestSigninFormHandler(t *testing.T) {
 			store := sessions.NewCookieStore([]byte("abc"))
 			mux := http.NewServeMux()
 			conf := config.NewConfig()
-			mux.HandleFunc("/signin/", handlers.SigninFormHandler(conf, store))
+			mux.HandleFunc("/signin/", handlers.SigninFormHandler(conf, store, templates(t, conf)))
 			ts := httptest.NewServer(mux)
 			defer ts.Close()
 
@@ -52,6 +53,16 @@ func TestSigninFormHandler(t *testing.T) {
 			if !match {
 				t.Fatalf("expected html to contain\n%s\nbut didn't:\n%s\n", expected, html)
 			}
+
+			// ensure the CSRF token is included
+			expected = `name="csrf_token" value="[A-Za-z0-9_-]{43}"`
+			match, err = regexp.MatchString(expected, html)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !match {
+				t.Fatalf("expected html to contain\n%s\nbut didn't:\n%s\n", expected, html)
+			}
 		},
 		// TODO: test rendering of error messages
 	}
@@ -93,7 +104,7 @@ func TestSigninHandler(t *testing.T) {
 			store := sessions.NewCookieStore([]byte("abc"))
 			conf := config.NewConfig()
 			mux := http.NewServeMux()
-			mux.HandleFunc("/signin/", handlers.SigninHandler(conf, store, userService))
+			mux.HandleFunc("/signin/", handlers.SigninHandler(conf, store, userService, &services.AuditService{DB: db}))
 			ts := httptest.NewServer(mux)
 			defer ts.Close()
 
@@ -133,6 +144,44 @@ func TestSigninHandler(t *testing.T) {
 			if !sessionCookieFound {
 				t.Fatalf("expected %s cookie to exist but didn't: %s\n", conf.SessionName, resp.Cookies())
 			}
+
+			// ensure the signin has been recorded
+			user, err := userService.Get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if time.Since(user.LastSigninAt) > time.Minute {
+				t.Fatalf("expected last signin to be now but got %s\n", user.LastSigninAt)
+			}
+		},
+		"new csrf token": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				password    = strings.Repeat("k", services.PasswordMinLen)
+				userID      = createUser(t, userService, "me@example.com", password)
+				store       = sessions.NewCookieStore([]byte("abc"))
+				conf        = config.NewConfig()
+			)
+
+			req, err := http.NewRequest("POST", "/signin", strings.NewReader(url.Values{"email": {"me@example.com"}, "password": {password}}.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			session, err := store.Get(req, conf.SessionName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session.Values[conf.CSRFTokenKey] = "planted"
+			handlers.SigninHandler(conf, store, userService, &services.AuditService{DB: userService.DB})(httptest.NewRecorder(), req)
+
+			// ensure the user is signed in and the token planted before is gone
+			if session.Values[conf.UserIDKey] != userID.String() {
+				t.Fatalf("expected user %s to be signed in but got %v\n", userID, session.Values[conf.UserIDKey])
+			}
+			if token, ok := session.Values[conf.CSRFTokenKey]; ok {
+				t.Fatalf("expected no CSRF token but got %v\n", token)
+			}
 		},
 		"fail": func(t *testing.T) {
 			var (
@@ -144,7 +193,7 @@ func TestSigninHandler(t *testing.T) {
 			store := sessions.NewCookieStore([]byte("abc"))
 			conf := config.NewConfig()
 			mux := http.NewServeMux()
-			mux.HandleFunc("/signin/", handlers.SigninHandler(conf, store, userService))
+			mux.HandleFunc("/signin/", handlers.SigninHandler(conf, store, userService, &services.AuditService{DB: db}))
 			ts := httptest.NewServer(mux)
 			defer ts.Close()
 
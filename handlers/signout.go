@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/services"
+)
+
+// SignoutHandler removes the user from the session, deletes the server-side session and redirects to the signin page.
+// Signouts are recorded in the audit log.
+func SignoutHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// get session
+		session, err := store.Get(r, conf.SessionName)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
+		}
+
+		// remove user id from session
+		if err := signOut(conf, session, userService, audit, r); err != nil {
+			serverError(w, r, "deleting session", err)
+			return
+		}
+		if err := session.Save(r, w); err != nil {
+			serverError(w, r, "saving session", err)
+			return
+		}
+
+		// redirect to signin page
+		http.Redirect(w, r, "/signin", http.StatusFound)
+	}
+}
+
+// signOut ends the server-side session, removes the user id from the session and records the signout.
+// The caller saves the session.
+func signOut(conf *config.Config, session *sessions.Session, userService *services.UserService, audit services.AuditSink, r *http.Request) error {
+	userID := session.Values[conf.UserIDKey]
+	if err := endSession(conf, session, userService); err != nil {
+		return err
+	}
+	if userID != nil {
+		id, _ := uuid.FromString(fmt.Sprintf("%s", userID))
+		record(conf, audit, r, services.AuditEvent{Type: services.AuditSignout, UserID: id})
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestSignoutHandler(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			var (
+				db           = db(t)
+				auditService = &services.AuditService{DB: db}
+				userService  = &services.UserService{DB: db}
+				userID       = uuid.NewV4()
+			)
+
+			// handler
+			store := sessions.NewCookieStore([]byte("abc"))
+			conf := config.NewConfig()
+			handler := handlers.SignoutHandler(conf, store, userService, auditService)
+			w := httptest.NewRecorder()
+
+			// request
+			req, err := http.NewRequest("POST", "/signout", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// put the user id in session
+			session, err := store.Get(req, conf.SessionName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			putUser(t, conf, userService, session, userID)
+			if err := session.Save(req, w); err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Set-Cookie", strings.Split(w.Header().Get("Set-Cookie"), ";")[0])
+
+			// invoke handler
+			w = httptest.NewRecorder()
+			handler(w, req)
+
+			// ensure redirect to signin page
+			if w.Code != http.StatusFound {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusFound, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != "/signin" {
+				t.Fatalf("expected redirect to %s but was to %s\n", "/signin", location)
+			}
+
+			// ensure user id has been removed from session
+			if userID := session.Values[conf.UserIDKey]; userID != nil {
+				t.Fatalf("expected user id to be removed from session but got %q\n", userID)
+			}
+
+			// ensure server-side session has been deleted
+			var count int
+			if err := db.QueryRow("SELECT COUNT(id) FROM sessions").Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if count != 0 {
+				t.Fatalf("expected no sessions but got %d\n", count)
+			}
+
+			// ensure signout has been recorded
+			events, err := auditService.Query(services.AuditFilter{UserID: userID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].Type != services.AuditSignout {
+				t.Fatalf("expected a signout event but got %+v\n", events)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
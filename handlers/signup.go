@@ -2,8 +2,6 @@ package handlers
 
 import (
 	"fmt"
-	"html/template"
-	"log"
 	"net/http"
 	"regexp"
 
@@ -11,125 +9,124 @@ import (
 
 	"github.com/gorilla/sessions"
 	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/logging"
 	"github.com/kschaper/auth-static/services"
 )
 
 type signupFormTplData struct {
-	Code           string   // from URL
-	PasswordMinLen int      // from package services
-	Errors         []string // from flash messages
+	layoutData
+	Code          string   // from URL
+	PasswordRules []string // translated rules of the password policy
+	CSRFToken     string   // from session
+	Errors        []string // translated flash messages
 }
 
-const signupFormTpl = `<!DOCTYPE html>
-<html lang="en">
-  <head>
-    <meta charset="UTF-8">
-    <title>sign up</title>
-  </head>
-  <body>
-		<h1>sign up</h1>
-		<p>The password must have at least {{.PasswordMinLen}} characters.</p>
-    <form action="/signup/{{.Code}}" method="post">
-      password: <input type="password" name="password">
-      again: <input type="password" name="confirmation">
-      <input type="submit" value="sign up">
-		</form>
-		{{if .Errors}}
-			<ul>
-				{{range .Errors}}
-					<li>{{.}}</li>
-				{{end}}
-			</ul>
-		{{end}}
-  </body>
-</html>
+// signupFormTpl is the built-in signup.html.
+const signupFormTpl = `{{define "title"}}{{.L.T "signup.title"}}{{end}}
+{{define "content"}}
+  <h1>{{.L.T "signup.title"}}</h1>
+  <p>{{.L.T "signup.password_rules"}}</p>
+  <ul class="rules">
+    {{range .PasswordRules}}
+      <li>{{.}}</li>
+    {{end}}
+  </ul>
+  <form action="/signup/{{.Code}}" method="post">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    <label for="password">{{.L.T "signup.password"}}</label>
+    <input type="password" name="password" id="password">
+    <label for="confirmation">{{.L.T "signup.confirmation"}}</label>
+    <input type="password" name="confirmation" id="confirmation">
+    <input type="submit" value="{{.L.T "signup.submit"}}">
+  </form>
+  {{template "errors" .}}
+{{end}}
 `
 
 // SignupFormHandler shows the signup form.
-func SignupFormHandler(conf *config.Config, store *sessions.CookieStore) func(w http.ResponseWriter, r *http.Request) {
+func SignupFormHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, tpl *Templates) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
 			reg  = regexp.MustCompile("[a-z0-9]{32}")
 			code = reg.FindString(r.URL.String()) // TODO: use Gorilla Mux's path vars
-			tpl  = template.Must(template.New("signup").Parse(signupFormTpl))
 		)
 
 		// get session
 		session, err := store.Get(r, conf.SessionName)
 		if err != nil {
-			log.Print(err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			serverError(w, r, "getting session", err)
 			return
 		}
 
 		// template data
+		token, err := csrfToken(conf, session)
+		if err != nil {
+			serverError(w, r, "generating CSRF token", err)
+			return
+		}
 		data := signupFormTplData{
-			Code:           code,
-			PasswordMinLen: services.PasswordMinLen,
+			layoutData: newLayoutData(conf, r),
+			Code:       code,
+			CSRFToken:  token,
 		}
 
+		for _, rule := range userService.PasswordPolicy().Rules() {
+			data.PasswordRules = append(data.PasswordRules, data.L.T(rule.Key, rule.Args...))
+		}
 		if flashes := session.Flashes(); len(flashes) > 0 {
 			for _, flash := range flashes {
-				data.Errors = append(data.Errors, fmt.Sprintf("%s", flash))
+				data.Errors = append(data.Errors, data.L.T(fmt.Sprintf("%s", flash)))
 			}
 		}
 
 		if err := session.Save(r, w); err != nil {
-			log.Print(err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			serverError(w, r, "saving session", err)
 			return
 		}
 
 		// show page
-		tpl.Execute(w, data)
+		if err := tpl.Execute(w, "signup", data); err != nil {
+			serverError(w, r, "rendering template", err)
+		}
 	}
 }
 
-// SignupHandler sets the password and redirects.
-func SignupHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService) func(w http.ResponseWriter, r *http.Request) {
+// SignupHandler sets the password and redirects. Signups are recorded in the audit log.
+func SignupHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
 			reg          = regexp.MustCompile("[a-z0-9]{32}")
 			code         = reg.FindString(r.URL.String()) // TODO: use Gorilla Mux's path vars
 			password     = r.PostFormValue("password")
 			confirmation = r.PostFormValue("confirmation")
-			id           uuid.UUID
 		)
 
 		// get session
 		session, err := store.Get(r, conf.SessionName)
-
-		// get user id
-		if err == nil {
-			id, err = userService.GetIDByCode(code)
-		}
-
-		// update password
-		if err == nil {
-			err = userService.UpdatePassword(id, password, confirmation)
+		if err != nil {
+			serverError(w, r, "getting session", err)
+			return
 		}
 
-		// handle errors
-		if err != nil {
-			log.Print(err)
+		// set password
+		if _, err := signUp(conf, session, userService, audit, r, code, password, confirmation); err != nil {
 			switch err.(type) {
 			case services.Error:
-				session.AddFlash(err.Error())
+				logging.FromContext(r.Context()).Info("signup rejected", "error", err)
+				session.AddFlash(errorKey(err))
 				if err := session.Save(r, w); err != nil {
-					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					serverError(w, r, "saving session", err)
 					return
 				}
 				http.Redirect(w, r, "/signup/"+code, http.StatusFound)
 			default:
-				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				serverError(w, r, "signing up", err)
 			}
 			return
 		}
 
-		// store user id in session
-		session.Values[conf.UserIDKey] = id.String()
 		if err := session.Save(r, w); err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			serverError(w, r, "saving session", err)
 			return
 		}
 
@@ -137,3 +134,27 @@ func SignupHandler(conf *config.Config, store *sessions.CookieStore, userService
 		http.Redirect(w, r, conf.ProtectedAreaDirExternal+conf.ProtectedAreaHome, http.StatusFound)
 	}
 }
+
+// signUp sets the password of the user with the code, stores the user id in the session and records the signup.
+// Expected errors are of type services.Error. The caller saves the session.
+func signUp(conf *config.Config, session *sessions.Session, userService *services.UserService, audit services.AuditSink, r *http.Request, code, password, confirmation string) (uuid.UUID, error) {
+	// get user id
+	id, err := userService.GetIDByCode(code)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// update password
+	if err := userService.UpdatePassword(id, password, confirmation); err != nil {
+		return uuid.Nil, err
+	}
+
+	// start a new server-side session
+	if err := startSession(conf, session, userService, r, id); err != nil {
+		return uuid.Nil, err
+	}
+
+	record(conf, audit, r, services.AuditEvent{Type: services.AuditSignup, UserID: id})
+	signupsTotal.Inc()
+	return id, nil
+}
@@ -37,7 +37,7 @@ func TestSignupFormHandler(t *testing.T) {
 			store := sessions.NewCookieStore([]byte("abc"))
 			conf := config.NewConfig()
 			mux := http.NewServeMux()
-			mux.HandleFunc("/signup/", handlers.SignupFormHandler(conf, store))
+			mux.HandleFunc("/signup/", handlers.SignupFormHandler(conf, store, &services.UserService{}, templates(t, conf)))
 			ts := httptest.NewServer(mux)
 			defer ts.Close()
 
@@ -68,6 +68,38 @@ func TestSignupFormHandler(t *testing.T) {
 				t.Fatalf("expected html to contain\n%s\nbut didn't:\n%s\n", expected, html)
 			}
 		},
+		"password rules": func(t *testing.T) {
+			// server
+			store := sessions.NewCookieStore([]byte("abc"))
+			conf := config.NewConfig()
+			userService := &services.UserService{Policy: &services.PasswordPolicy{MinLength: 12, MinClasses: 3, RejectEmail: true}}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/signup/", handlers.SignupFormHandler(conf, store, userService, templates(t, conf)))
+			ts := httptest.NewServer(mux)
+			defer ts.Close()
+
+			// request
+			req, err := http.Get(ts.URL + "/signup/73d3e3502ab73f40d4943fdcc16d05dd")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer req.Body.Close()
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// ensure the active rules are listed
+			html := string(body)
+			for _, expected := range []string{"at least 12 characters", "at most 72 bytes", "at least 3 of", "your email address"} {
+				if !strings.Contains(html, expected) {
+					t.Fatalf("expected html to contain\n%s\nbut didn't:\n%s\n", expected, html)
+				}
+			}
+			if strings.Contains(html, "data breaches") {
+				t.Fatalf("expected html not to contain the breached passwords rule:\n%s\n", html)
+			}
+		},
 		// TODO: test rendering of error messages
 	}
 
@@ -96,7 +128,7 @@ func TestSignupHandler(t *testing.T) {
 			store := sessions.NewCookieStore([]byte("abc"))
 			conf := config.NewConfig()
 			mux := http.NewServeMux()
-			mux.HandleFunc("/signup/", handlers.SignupHandler(conf, store, userService))
+			mux.HandleFunc("/signup/", handlers.SignupHandler(conf, store, userService, &services.AuditService{DB: db}))
 			ts := httptest.NewServer(mux)
 			defer ts.Close()
 
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/i18n"
+)
+
+// Shared templates. Pages define "title" and "content" which are rendered by "layout".
+const (
+	layoutTpl = `{{define "layout"}}<!DOCTYPE html>
+<html lang="{{.L.Lang}}">
+  <head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{template "title" .}} - {{.SiteName}}</title>
+    <link rel="stylesheet" href="/assets/style.css">
+  </head>
+  <body>
+    <header>
+      {{with .Branding.logo}}<img src="{{.}}" alt="{{$.SiteName}}">{{else}}{{.SiteName}}{{end}}
+    </header>
+    <main>
+      {{template "content" .}}
+    </main>
+  </body>
+</html>
+{{end}}`
+
+	errorsTpl = `{{define "errors"}}
+  {{if .Errors}}
+    <ul class="errors">
+      {{range .Errors}}
+        <li>{{.}}</li>
+      {{end}}
+    </ul>
+  {{end}}
+{{end}}`
+)
+
+// styleCSS is the default stylesheet served if the assets directory doesn't contain one.
+const styleCSS = `body { font-family: sans-serif; max-width: 30em; margin: 2em auto; padding: 0 1em; }
+header img { max-height: 3em; }
+label { display: block; margin: 1em 0 0.25em; }
+input[type="text"], input[type="password"] { width: 100%; box-sizing: border-box; }
+input[type="submit"] { margin-top: 1em; }
+.errors { color: #b00; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.25em 0.5em 0.25em 0; vertical-align: top; }
+nav.admin a { margin-right: 1em; }
+`
+
+// defaultTemplates are used for the files missing in the templates directory.
+var defaultTemplates = map[string]string{
+	"layout.html":              layoutTpl,
+	"errors.html":              errorsTpl,
+	"signin.html":              signinFormTpl,
+	"signup.html":              signupFormTpl,
+	"password.html":            passwordFormTpl,
+	"account.html":             accountTpl,
+	"email.html":               emailFormTpl,
+	"email_confirm.html":       emailConfirmTpl,
+	"register.html":            registerFormTpl,
+	"admin_nav.html":           adminNavTpl,
+	"admin_users.html":         adminUsersTpl,
+	"admin_user.html":          adminUserTpl,
+	"admin_rules.html":         adminRulesTpl,
+	"admin_audit.html":         adminAuditTpl,
+	"admin_sessions.html":      adminSessionsTpl,
+	"admin_registrations.html": adminRegistrationsTpl,
+}
+
+// pages are the templates rendered by the handlers. All other files are shared by the pages.
+var pages = []string{"signin", "signup", "password", "account", "email", "email_confirm", "register",
+	"admin_users", "admin_user", "admin_rules", "admin_audit", "admin_sessions", "admin_registrations"}
+
+// layoutData is embedded in the pages' template data.
+type layoutData struct {
+	SiteName string
+	Branding map[string]string // e.g. {{.Branding.logo}}
+	L        *i18n.Localizer   // e.g. {{.L.T "signin.title"}}
+}
+
+// newLayoutData returns the layout data from the configuration and the request's localizer.
+func newLayoutData(conf *config.Config, r *http.Request) layoutData {
+	return layoutData{SiteName: conf.SiteName, Branding: conf.Branding, L: i18n.FromContext(r.Context())}
+}
+
+// Templates renders the pages.
+// They're parsed once from conf.TemplatesDir with the built-in templates as fallback,
+// or on each request if conf.TemplatesReload is set.
+type Templates struct {
+	dir    string
+	reload bool
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+}
+
+// NewTemplates parses the templates.
+func NewTemplates(conf *config.Config) (*Templates, error) {
+	tpl := &Templates{dir: conf.TemplatesDir, reload: conf.TemplatesReload}
+	if err := tpl.parse(); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// parse parses the templates and replaces the current ones if there was no error.
+func (tpl *Templates) parse() error {
+	sources := map[string]string{}
+	for name, src := range defaultTemplates {
+		sources[name] = src
+	}
+
+	// files of the templates directory take precedence
+	if tpl.dir != "" {
+		filenames, err := filepath.Glob(filepath.Join(tpl.dir, "*.html"))
+		if err != nil {
+			return err
+		}
+		for _, filename := range filenames {
+			src, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+			sources[filepath.Base(filename)] = string(src)
+		}
+	}
+
+	isPage := map[string]bool{}
+	for _, page := range pages {
+		isPage[page+".html"] = true
+	}
+
+	// layout and partials
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	shared := template.New("")
+	for _, name := range names {
+		if isPage[name] {
+			continue
+		}
+		if _, err := shared.New(name).Parse(sources[name]); err != nil {
+			return err
+		}
+	}
+
+	// pages
+	parsed := map[string]*template.Template{}
+	for _, page := range pages {
+		t, err := shared.Clone()
+		if err != nil {
+			return err
+		}
+		if _, err := t.New(page + ".html").Parse(sources[page+".html"]); err != nil {
+			return err
+		}
+		parsed[page] = t
+	}
+
+	tpl.mu.Lock()
+	tpl.pages = parsed
+	tpl.mu.Unlock()
+	return nil
+}
+
+// Execute renders the page with the layout. Nothing is written if rendering fails.
+func (tpl *Templates) Execute(w io.Writer, page string, data interface{}) error {
+	if tpl.reload {
+		if err := tpl.parse(); err != nil {
+			return err
+		}
+	}
+
+	tpl.mu.RLock()
+	t, ok := tpl.pages[page]
+	tpl.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown page %q", page)
+	}
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, "layout", data); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// AssetsHandler serves the static assets like stylesheets and logos below /assets/
+// from the assets directory within conf.TemplatesDir. The built-in style.css is served if the directory doesn't have one.
+func AssetsHandler(conf *config.Config) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, "/assets/"))
+
+		if conf.TemplatesDir != "" {
+			root := filepath.Join(conf.TemplatesDir, "assets")
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err == nil {
+				serveFile(w, r, root, name, "")
+				return
+			}
+		}
+
+		if name == "/style.css" {
+			w.Header().Set("Content-Type", "text/css; charset=utf-8")
+			http.ServeContent(w, r, "style.css", time.Time{}, strings.NewReader(styleCSS))
+			return
+		}
+		http.NotFound(w, r)
+	}
+}
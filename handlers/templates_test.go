@@ -0,0 +1,142 @@
+package handlers_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/i18n"
+)
+
+// templates returns the parsed templates.
+func templates(t *testing.T, conf *config.Config) *handlers.Templates {
+	tpl, err := handlers.NewTemplates(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tpl
+}
+
+// render renders the signin page.
+func render(t *testing.T, tpl *handlers.Templates) string {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, "signin", map[string]interface{}{"L": i18n.Default}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestTemplates(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"built-in": func(t *testing.T) {
+			html := render(t, templates(t, config.NewConfig()))
+
+			// ensure the layout is rendered around the page
+			if !strings.Contains(html, "<title>sign in - </title>") || !strings.Contains(html, `action="/signin"`) {
+				t.Fatalf("expected the built-in signin page but got\n%s\n", html)
+			}
+		},
+		"directory": func(t *testing.T) {
+			dir := fileTree(t, map[string]string{
+				"layout.html": `{{define "layout"}}<custom>{{template "content" .}}</custom>{{end}}`,
+				"footer.html": `{{define "footer"}}imprint{{end}}`,
+				"signin.html": `{{define "title"}}{{end}}{{define "content"}}my signin {{template "footer"}}{{end}}`,
+			})
+			defer os.RemoveAll(dir)
+			conf := config.NewConfig()
+			conf.TemplatesDir = dir
+
+			// ensure the files override the built-in templates and partials are shared
+			html := render(t, templates(t, conf))
+			if html != "<custom>my signin imprint</custom>" {
+				t.Fatalf("expected the custom signin page but got %q\n", html)
+			}
+
+			// ensure the other pages still use the built-in templates with the custom layout
+			var buf bytes.Buffer
+			if err := templates(t, conf).Execute(&buf, "signup", map[string]interface{}{"L": i18n.Default}); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(buf.String(), "<custom>") || !strings.Contains(buf.String(), "sign up") {
+				t.Fatalf("expected the built-in signup page in the custom layout but got %q\n", buf.String())
+			}
+		},
+		"invalid template": func(t *testing.T) {
+			dir := fileTree(t, map[string]string{"signin.html": `{{define "content"}}`})
+			defer os.RemoveAll(dir)
+			conf := config.NewConfig()
+			conf.TemplatesDir = dir
+
+			// ensure parsing fails at startup
+			if _, err := handlers.NewTemplates(conf); err == nil {
+				t.Fatal("expected an error but got none")
+			}
+		},
+		"reload": func(t *testing.T) {
+			dir := fileTree(t, map[string]string{
+				"signin.html": `{{define "title"}}{{end}}{{define "content"}}before{{end}}`,
+			})
+			defer os.RemoveAll(dir)
+			conf := config.NewConfig()
+			conf.TemplatesDir = dir
+			conf.TemplatesReload = true
+			tpl := templates(t, conf)
+
+			// change the template
+			if err := ioutil.WriteFile(filepath.Join(dir, "signin.html"), []byte(`{{define "title"}}{{end}}{{define "content"}}after{{end}}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// ensure the change is rendered
+			if html := render(t, tpl); !strings.Contains(html, "after") {
+				t.Fatalf("expected the changed template but got\n%s\n", html)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestAssetsHandler(t *testing.T) {
+	dir := fileTree(t, map[string]string{"assets/logo.svg": "<svg></svg>"})
+	defer os.RemoveAll(dir)
+	conf := config.NewConfig()
+	conf.TemplatesDir = dir
+	handler := handlers.AssetsHandler(conf)
+
+	cases := map[string]struct {
+		path   string
+		status int
+		body   string
+	}{
+		"file":                {"/assets/logo.svg", http.StatusOK, "<svg></svg>"},
+		"built-in stylesheet": {"/assets/style.css", http.StatusOK, "body {"},
+		"unknown":             {"/assets/missing.png", http.StatusNotFound, ""},
+		"traversal":           {"/assets/../assets/../../etc/passwd", http.StatusNotFound, ""},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", c.path, nil))
+
+			// ensure status code and body
+			if w.Code != c.status {
+				t.Fatalf("expected status code %d but got %d\n", c.status, w.Code)
+			}
+			if !strings.HasPrefix(w.Body.String(), c.body) {
+				t.Fatalf("expected body to start with %q but got %q\n", c.body, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/gorilla/sessions"
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/services"
+)
+
+// VerifyHandler answers the subrequests of nginx' auth_request and of forward_auth proxies like Traefik and Caddy.
+// The original URI is read from the X-Original-URI or X-Forwarded-Uri header.
+// It responds with 200 and the X-Auth-User and X-Auth-Email headers if the user is signed in
+// and the URI is within the protected area and allowed by the access rules, with 401 if the user isn't signed in, and with 403 otherwise.
+// Each verification is recorded in the audit log as file access or denied access.
+func VerifyHandler(conf *config.Config, store *sessions.CookieStore, userService *services.UserService, audit services.AuditSink) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// get original URI
+		originalURI := r.Header.Get("X-Original-URI")
+		if originalURI == "" {
+			originalURI = r.Header.Get("X-Forwarded-Uri")
+		}
+		if originalURI == "" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		u, err := url.Parse(originalURI)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		// ensure user is signed in
+		id, err := signedInUserID(conf, store, userService, r)
+		if err != nil {
+			authChecksTotal.Inc(outcomeError)
+			serverError(w, r, "getting signed-in user", err)
+			return
+		}
+		if id == uuid.Nil {
+			authChecksTotal.Inc(outcomeDenied)
+			record(conf, audit, r, services.AuditEvent{Type: services.AuditAccessDenied, Path: u.Path})
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		// ensure URI is within the protected area and the user's groups may access it
+		rel, err := protectedPath(conf, u)
+		allowed := false
+		if err == nil {
+			if allowed, err = userService.Allowed(id, rel); err != nil {
+				authChecksTotal.Inc(outcomeError)
+				serverError(w, r, "checking access rules", err)
+				return
+			}
+		}
+		if !allowed {
+			authChecksTotal.Inc(outcomeForbidden)
+			record(conf, audit, r, services.AuditEvent{Type: services.AuditAccessDenied, UserID: id, Path: u.Path})
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		// set user headers
+		email, err := userService.GetEmailByID(id)
+		if err != nil {
+			authChecksTotal.Inc(outcomeError)
+			serverError(w, r, "getting email", err)
+			return
+		}
+		authChecksTotal.Inc(outcomeGranted)
+		record(conf, audit, r, services.AuditEvent{Type: services.AuditFileAccess, UserID: id, Email: email, Path: u.Path})
+		w.Header().Set("X-Auth-User", id.String())
+		w.Header().Set("X-Auth-Email", email)
+		w.WriteHeader(http.StatusOK)
+	}
+}
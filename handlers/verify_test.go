@@ -0,0 +1,145 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/config"
+	"github.com/kschaper/auth-static/handlers"
+	"github.com/kschaper/auth-static/services"
+)
+
+// verify invokes the VerifyHandler with the given original URI header and user ID in the session.
+func verify(t *testing.T, userService *services.UserService, userID uuid.UUID, header, uri string) *httptest.ResponseRecorder {
+	// handler
+	store := sessions.NewCookieStore([]byte("abc"))
+	conf := config.NewConfig()
+	handler := handlers.VerifyHandler(conf, store, userService, &services.AuditService{DB: userService.DB})
+	w := httptest.NewRecorder()
+
+	// request
+	req, err := http.NewRequest("GET", "/auth/verify", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header != "" {
+		req.Header.Set(header, uri)
+	}
+
+	// put the user id in session
+	if userID != uuid.Nil {
+		session, err := store.Get(req, conf.SessionName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		putUser(t, conf, userService, session, userID)
+		if err := session.Save(req, w); err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Set-Cookie", strings.Split(w.Header().Get("Set-Cookie"), ";")[0])
+	}
+
+	// invoke handler
+	w = httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestVerifyHandler(t *testing.T) {
+	var (
+		db          = db(t)
+		userService = &services.UserService{DB: db}
+		email       = "webmaster@example.com"
+	)
+
+	// create user
+	code, err := userService.Create(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := userService.GetIDByCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]func(t *testing.T){
+		"authenticated": func(t *testing.T) {
+			w := verify(t, userService, id, "X-Original-URI", "/private/secret.jpg?size=large")
+
+			// ensure status code 200
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, w.Code)
+			}
+
+			// ensure user headers are set
+			if header := w.Header().Get("X-Auth-User"); header != id.String() {
+				t.Fatalf("expected X-Auth-User %q but got %q\n", id, header)
+			}
+			if header := w.Header().Get("X-Auth-Email"); header != email {
+				t.Fatalf("expected X-Auth-Email %q but got %q\n", email, header)
+			}
+		},
+		"forwarded uri": func(t *testing.T) {
+			w := verify(t, userService, id, "X-Forwarded-Uri", "/private/secret.jpg")
+
+			// ensure status code 200
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, w.Code)
+			}
+		},
+		"unauthenticated": func(t *testing.T) {
+			w := verify(t, userService, uuid.Nil, "X-Original-URI", "/private/secret.jpg")
+
+			// ensure status code 401
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusUnauthorized, w.Code)
+			}
+
+			// ensure user headers are not set
+			if header := w.Header().Get("X-Auth-User"); header != "" {
+				t.Fatalf("expected X-Auth-User not to be set but got %q\n", header)
+			}
+		},
+		"unknown user": func(t *testing.T) {
+			w := verify(t, userService, uuid.NewV4(), "X-Original-URI", "/private/secret.jpg")
+
+			// ensure status code 401
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusUnauthorized, w.Code)
+			}
+		},
+		"outside protected area": func(t *testing.T) {
+			w := verify(t, userService, id, "X-Original-URI", "/public/index.html")
+
+			// ensure status code 403
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusForbidden, w.Code)
+			}
+		},
+		"path traversal": func(t *testing.T) {
+			w := verify(t, userService, id, "X-Original-URI", "/private/../admin/index.html")
+
+			// ensure status code 403
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusForbidden, w.Code)
+			}
+		},
+		"missing header": func(t *testing.T) {
+			w := verify(t, userService, id, "", "")
+
+			// ensure status code 400
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusBadRequest, w.Code)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
@@ -0,0 +1,197 @@
+// Package i18n provides message catalogs and negotiates the language from the Accept-Language header.
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Catalog maps message keys to messages. Messages may contain fmt verbs.
+type Catalog map[string]string
+
+// Bundle holds the catalogs of all languages.
+type Bundle struct {
+	defaultLanguage string
+
+	mu       sync.RWMutex
+	catalogs map[string]Catalog
+}
+
+// NewBundle returns a bundle with the built-in catalogs. Missing messages are taken from the default language.
+func NewBundle(defaultLanguage string) *Bundle {
+	bundle := &Bundle{defaultLanguage: normalize(defaultLanguage), catalogs: map[string]Catalog{}}
+	for lang, catalog := range builtin {
+		bundle.Add(lang, catalog)
+	}
+	return bundle
+}
+
+// Add adds the messages to the language's catalog replacing existing ones with the same key.
+func (bundle *Bundle) Add(lang string, catalog Catalog) {
+	lang = normalize(lang)
+
+	bundle.mu.Lock()
+	defer bundle.mu.Unlock()
+	if bundle.catalogs[lang] == nil {
+		bundle.catalogs[lang] = Catalog{}
+	}
+	for key, message := range catalog {
+		bundle.catalogs[lang][key] = message
+	}
+}
+
+// LoadDir adds the catalogs of the JSON files named after their language, e.g. "de.json" containing {"signin.title": "Anmelden"}.
+func (bundle *Bundle) LoadDir(dir string) error {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, filename := range filenames {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		var catalog Catalog
+		if err := json.Unmarshal(content, &catalog); err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+		bundle.Add(strings.TrimSuffix(filepath.Base(filename), ".json"), catalog)
+	}
+	return nil
+}
+
+// Languages returns the languages having a catalog.
+func (bundle *Bundle) Languages() []string {
+	bundle.mu.RLock()
+	defer bundle.mu.RUnlock()
+
+	langs := make([]string, 0, len(bundle.catalogs))
+	for lang := range bundle.catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Supports checks if there's a catalog for the language.
+func (bundle *Bundle) Supports(lang string) bool {
+	bundle.mu.RLock()
+	defer bundle.mu.RUnlock()
+	_, ok := bundle.catalogs[normalize(lang)]
+	return ok
+}
+
+// Match returns the language to use. The preferred language, e.g. from a cookie, wins if supported.
+// Otherwise the languages of the Accept-Language header are tried by quality, each also without its region.
+// The default language is returned if none matches.
+func (bundle *Bundle) Match(preferred, acceptLanguage string) string {
+	if preferred != "" && bundle.Supports(preferred) {
+		return normalize(preferred)
+	}
+	for _, lang := range parseAcceptLanguage(acceptLanguage) {
+		if bundle.Supports(lang) {
+			return lang
+		}
+		if i := strings.Index(lang, "-"); i > 0 && bundle.Supports(lang[:i]) {
+			return lang[:i]
+		}
+	}
+	return bundle.defaultLanguage
+}
+
+// Localizer returns the localizer for the language.
+func (bundle *Bundle) Localizer(lang string) *Localizer {
+	return &Localizer{Lang: normalize(lang), bundle: bundle}
+}
+
+// Localizer translates messages into one language.
+type Localizer struct {
+	Lang   string
+	bundle *Bundle
+}
+
+// T returns the message for the key formatted with the args.
+// It falls back to the default language and to the key if there's no message.
+func (localizer *Localizer) T(key string, args ...interface{}) string {
+	bundle := localizer.bundle
+	bundle.mu.RLock()
+	message, ok := bundle.catalogs[localizer.Lang][key]
+	if !ok {
+		message, ok = bundle.catalogs[bundle.defaultLanguage][key]
+	}
+	bundle.mu.RUnlock()
+
+	if !ok {
+		message = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// parseAcceptLanguage returns the languages of the header ordered by quality.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang    string
+		quality float64
+	}
+
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		lang := normalize(fields[0])
+		if lang == "" || lang == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			langs = append(langs, weighted{lang, quality})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].quality > langs[j].quality })
+
+	result := make([]string, len(langs))
+	for i, lang := range langs {
+		result[i] = lang.lang
+	}
+	return result
+}
+
+// normalize lowercases the language tag and uses hyphens, e.g. "en_US" becomes "en-us".
+func normalize(lang string) string {
+	return strings.Replace(strings.ToLower(strings.TrimSpace(lang)), "_", "-", -1)
+}
+
+type contextKey struct{}
+
+// Default is the localizer returned by FromContext if the context doesn't have one.
+var Default = NewBundle("en").Localizer("en")
+
+// NewContext returns a context carrying the localizer.
+func NewContext(ctx context.Context, localizer *Localizer) context.Context {
+	return context.WithValue(ctx, contextKey{}, localizer)
+}
+
+// FromContext returns the context's localizer or Default.
+func FromContext(ctx context.Context) *Localizer {
+	if localizer, ok := ctx.Value(contextKey{}).(*Localizer); ok {
+		return localizer
+	}
+	return Default
+}
@@ -0,0 +1,116 @@
+package i18n_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kschaper/auth-static/i18n"
+)
+
+func TestBundle_Match(t *testing.T) {
+	bundle := i18n.NewBundle("en")
+
+	cases := map[string]struct {
+		preferred      string
+		acceptLanguage string
+		expected       string
+	}{
+		"no header":           {"", "", "en"},
+		"exact":               {"", "de", "de"},
+		"region":              {"", "de-AT,en;q=0.5", "de"},
+		"quality":             {"", "en;q=0.4, de;q=0.8", "de"},
+		"unsupported":         {"", "fr, it;q=0.9", "en"},
+		"unsupported first":   {"", "fr, de;q=0.5", "de"},
+		"zero quality":        {"", "de;q=0, en;q=0.1", "en"},
+		"cookie":              {"de", "en", "de"},
+		"unsupported cookie":  {"fr", "de", "de"},
+		"underscore and case": {"", "DE_de", "de"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			if lang := bundle.Match(c.preferred, c.acceptLanguage); lang != c.expected {
+				t.Fatalf("expected language %q but got %q\n", c.expected, lang)
+			}
+		})
+	}
+}
+
+func TestLocalizer_T(t *testing.T) {
+	bundle := i18n.NewBundle("en")
+	bundle.Add("fr", i18n.Catalog{"signin.title": "connexion"})
+
+	cases := map[string]func(t *testing.T){
+		"translated": func(t *testing.T) {
+			if message := bundle.Localizer("fr").T("signin.title"); message != "connexion" {
+				t.Fatalf("expected message %q but got %q\n", "connexion", message)
+			}
+		},
+		"arguments": func(t *testing.T) {
+			expected := "hat mindestens 8 Zeichen"
+			if message := bundle.Localizer("de").T("password.min_length", 8); message != expected {
+				t.Fatalf("expected message %q but got %q\n", expected, message)
+			}
+		},
+		"default language fallback": func(t *testing.T) {
+			if message := bundle.Localizer("fr").T("signup.title"); message != "sign up" {
+				t.Fatalf("expected message %q but got %q\n", "sign up", message)
+			}
+		},
+		"key fallback": func(t *testing.T) {
+			if message := bundle.Localizer("de").T("unknown message"); message != "unknown message" {
+				t.Fatalf("expected message %q but got %q\n", "unknown message", message)
+			}
+		},
+		"context": func(t *testing.T) {
+			if localizer := i18n.FromContext(context.Background()); localizer != i18n.Default {
+				t.Fatal("expected the default localizer")
+			}
+			localizer := bundle.Localizer("de")
+			if l := i18n.FromContext(i18n.NewContext(context.Background(), localizer)); l != localizer {
+				t.Fatal("expected the context's localizer")
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestBundle_LoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "nl.json"), []byte(`{"signin.title": "inloggen"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// load the catalogs
+	bundle := i18n.NewBundle("en")
+	if err := bundle.LoadDir(dir); err != nil {
+		t.Fatalf("expected no error but got %q\n", err)
+	}
+
+	// ensure the language is supported
+	if !bundle.Supports("nl") {
+		t.Fatalf("expected nl to be supported but languages are %v\n", bundle.Languages())
+	}
+	if message := bundle.Localizer("nl").T("signin.title"); message != "inloggen" {
+		t.Fatalf("expected message %q but got %q\n", "inloggen", message)
+	}
+
+	// ensure invalid files are rejected
+	if err := ioutil.WriteFile(filepath.Join(dir, "it.json"), []byte(`{`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bundle.LoadDir(dir); err == nil {
+		t.Fatal("expected an error but got none")
+	}
+}
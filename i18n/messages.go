@@ -0,0 +1,269 @@
+package i18n
+
+// builtin are the catalogs included in every bundle.
+var builtin = map[string]Catalog{
+	"en": {
+		"signin.title":                  "sign in",
+		"signin.email":                  "email",
+		"signin.password":               "password",
+		"signin.submit":                 "sign in",
+		"signin.register":               "no account yet? ask for one",
+		"signup.title":                  "sign up",
+		"signup.password_rules":         "The password",
+		"signup.password":               "password",
+		"signup.confirmation":           "again",
+		"signup.submit":                 "sign up",
+		"error.signin_failed":           "email and/or password wrong",
+		"error.email_required":          "email required",
+		"error.password_too_short":      "password too short",
+		"error.password_not_confirmed":  "password doesn't match confirmation",
+		"error.unknown_code":            "code unknown",
+		"error.unknown_user":            "user unknown",
+		"error.password_too_long":       "password too long",
+		"error.password_too_simple":     "password needs more kinds of characters",
+		"error.password_contains_email": "password must not contain the email address",
+		"error.password_breached":       "password is known from a data breach, please choose another one",
+		"password.min_length":           "has at least %d characters",
+		"password.max_length":           "has at most %d bytes, i.e. fewer characters with umlauts and the like",
+		"password.min_classes":          "contains at least %d of: lowercase letters, uppercase letters, digits, other characters",
+		"password.no_email":             "doesn't contain your email address",
+		"password.not_breached":         "isn't known from data breaches",
+		"password_change.title":         "change password",
+		"password_change.current":       "current password",
+		"password_change.password":      "new password",
+		"password_change.confirmation":  "again",
+		"password_change.revoke":        "sign out on all other devices",
+		"password_change.submit":        "change password",
+		"password_change.changed":       "password changed",
+		"error.wrong_password":          "current password wrong",
+		"account.title":                 "account",
+		"account.email":                 "email",
+		"account.created_at":            "created",
+		"account.last_signin_at":        "last sign in",
+		"account.never":                 "never",
+		"account.sessions":              "signed in devices",
+		"account.device":                "device",
+		"account.ip":                    "IP address",
+		"account.signed_in_at":          "signed in",
+		"account.last_seen_at":          "last seen",
+		"account.this_device":           "this device",
+		"email_change.title":            "change email",
+		"email_change.current":          "The current email is %s.",
+		"email_change.email":            "new email",
+		"email_change.submit":           "send verification link",
+		"email_change.sent":             "A link has been sent to the new email. The email is changed when the link is followed within 24 hours.",
+		"email_change.confirm":          "Change the email to %s?",
+		"email_change.confirm_submit":   "change email",
+		"email_change.changed":          "email changed",
+		"email_change.verify_subject":   "%s: please verify your new email",
+		"email_change.verify_body":      "Hello,\n\nthe user with the email %s wants to use this email from now on. To confirm follow this link within 24 hours:\n\n%s\n\nIf you didn't ask for this just ignore this email.\n",
+		"email_change.notify_subject":   "%s: your email has been changed",
+		"email_change.notify_body":      "Hello,\n\nthe email of your account has been changed to %s. If you didn't do this please contact us.\n",
+		"error.email_unchanged":         "the new email is the current one",
+		"error.email_taken":             "email already taken",
+		"error.email_invalid":           "email invalid",
+		"error.domain_not_allowed":      "emails of this domain aren't allowed",
+		"error.domain_denied":           "emails of this domain are denied",
+		"registration.title":            "ask for an account",
+		"registration.intro":            "An admin reviews your request. If it's approved you get an email with a link to set your password.",
+		"registration.email":            "email",
+		"registration.reason":           "why do you need an account?",
+		"registration.submit":           "send request",
+		"registration.sent":             "Thank you, your request will be reviewed.",
+		"registration.approved_subject": "%s: your account has been approved",
+		"registration.approved_body":    "Hello,\n\nyour request for an account has been approved. Please set your password here:\n\n%s\n",
+		"error.reason_too_long":         "reason too long",
+		"error.unknown_registration":    "registration unknown",
+		"error.too_many_registrations":  "too many pending requests, please try again later",
+		"admin.users":                   "users",
+		"admin.registrations":           "registrations",
+		"admin.rules":                   "access rules",
+		"admin.sessions":                "active sessions",
+		"admin.audit":                   "audit log",
+		"admin.search":                  "search",
+		"admin.search_submit":           "search",
+		"admin.email":                   "email",
+		"admin.name":                    "name",
+		"admin.groups":                  "groups",
+		"admin.groups_hint":             "groups, separated by spaces",
+		"admin.groups_submit":           "save groups",
+		"admin.groups_saved":            "Groups saved.",
+		"admin.status":                  "status",
+		"admin.status_active":           "active",
+		"admin.status_pending":          "invited",
+		"admin.status_disabled":         "disabled",
+		"admin.admin":                   "admin",
+		"admin.invite":                  "invite a user",
+		"admin.invite_submit":           "invite",
+		"admin.invite_subject":          "%s: you've been invited",
+		"admin.invite_body":             "Hello,\n\nyou've been invited. Please set your password here:\n\n%s\n",
+		"admin.invited":                 "Invitation sent.",
+		"admin.resend_invite":           "resend invitation",
+		"admin.grant_admin":             "make admin",
+		"admin.revoke_admin":            "revoke admin",
+		"admin.signout":                 "sign out on all devices",
+		"admin.signed_out":              "Signed out on all devices.",
+		"admin.disable":                 "disable",
+		"admin.enable":                  "enable",
+		"admin.delete":                  "delete",
+		"admin.delete_confirm":          "really delete",
+		"admin.deleted":                 "User deleted.",
+		"admin.saved":                   "Saved.",
+		"admin.rules_intro":             "A path with rules and everything below it is only accessible to the members of its groups. The rules of the longest matching path apply. Paths without rules are accessible to all users.",
+		"admin.path":                    "path",
+		"admin.group":                   "group",
+		"admin.rule_add":                "add rule",
+		"admin.since":                   "from",
+		"admin.until":                   "until",
+		"admin.time":                    "time",
+		"admin.event":                   "event",
+		"admin.detail":                  "detail",
+		"admin.approve":                 "approve",
+		"admin.reject":                  "reject",
+		"admin.approved":                "Registration approved.",
+		"admin.rejected":                "Registration rejected.",
+		"error.name_too_long":           "name too long",
+		"error.group_invalid":           "group name invalid",
+		"error.user_active":             "user has already set a password",
+		"error.user_exists":             "user already exists",
+		"error.user_disabled":           "user is disabled",
+		"error.self":                    "you can't do this to your own account",
+		"error.path_invalid":            "path invalid",
+		"error.invite_not_sent":         "invitation couldn't be sent",
+		"error.not_confirmed":           "please confirm",
+		"error.unknown_action":          "action unknown",
+		"error.date_invalid":            "date invalid, e.g. 2018-06-30",
+	},
+	"de": {
+		"signin.title":                  "Anmelden",
+		"signin.email":                  "E-Mail",
+		"signin.password":               "Passwort",
+		"signin.submit":                 "Anmelden",
+		"signin.register":               "Noch kein Konto? Hier beantragen",
+		"signup.title":                  "Registrieren",
+		"signup.password_rules":         "Das Passwort",
+		"signup.password":               "Passwort",
+		"signup.confirmation":           "Wiederholung",
+		"signup.submit":                 "Registrieren",
+		"error.signin_failed":           "E-Mail und/oder Passwort falsch",
+		"error.email_required":          "E-Mail erforderlich",
+		"error.password_too_short":      "Passwort zu kurz",
+		"error.password_not_confirmed":  "Passwort und Wiederholung stimmen nicht überein",
+		"error.unknown_code":            "Code unbekannt",
+		"error.unknown_user":            "Benutzer unbekannt",
+		"error.password_too_long":       "Passwort zu lang",
+		"error.password_too_simple":     "Passwort braucht mehr verschiedene Zeichenarten",
+		"error.password_contains_email": "Passwort darf die E-Mail-Adresse nicht enthalten",
+		"error.password_breached":       "Passwort ist aus einem Datenleck bekannt, bitte ein anderes wählen",
+		"password.min_length":           "hat mindestens %d Zeichen",
+		"password.max_length":           "hat höchstens %d Bytes, also weniger Zeichen bei Umlauten und ähnlichen",
+		"password.min_classes":          "enthält mindestens %d von: Kleinbuchstaben, Großbuchstaben, Ziffern, anderen Zeichen",
+		"password.no_email":             "enthält nicht die E-Mail-Adresse",
+		"password.not_breached":         "ist nicht aus Datenlecks bekannt",
+		"password_change.title":         "Passwort ändern",
+		"password_change.current":       "aktuelles Passwort",
+		"password_change.password":      "neues Passwort",
+		"password_change.confirmation":  "Wiederholung",
+		"password_change.revoke":        "auf allen anderen Geräten abmelden",
+		"password_change.submit":        "Passwort ändern",
+		"password_change.changed":       "Passwort geändert",
+		"error.wrong_password":          "aktuelles Passwort falsch",
+		"account.title":                 "Konto",
+		"account.email":                 "E-Mail",
+		"account.created_at":            "angelegt",
+		"account.last_signin_at":        "letzte Anmeldung",
+		"account.never":                 "nie",
+		"account.sessions":              "angemeldete Geräte",
+		"account.device":                "Gerät",
+		"account.ip":                    "IP-Adresse",
+		"account.signed_in_at":          "angemeldet",
+		"account.last_seen_at":          "zuletzt aktiv",
+		"account.this_device":           "dieses Gerät",
+		"email_change.title":            "E-Mail ändern",
+		"email_change.current":          "Die aktuelle E-Mail-Adresse ist %s.",
+		"email_change.email":            "neue E-Mail-Adresse",
+		"email_change.submit":           "Bestätigungslink senden",
+		"email_change.sent":             "Ein Link wurde an die neue E-Mail-Adresse gesendet. Die Adresse wird geändert, wenn er innerhalb von 24 Stunden aufgerufen wird.",
+		"email_change.confirm":          "E-Mail-Adresse auf %s ändern?",
+		"email_change.confirm_submit":   "E-Mail ändern",
+		"email_change.changed":          "E-Mail-Adresse geändert",
+		"email_change.verify_subject":   "%s: Bitte die neue E-Mail-Adresse bestätigen",
+		"email_change.verify_body":      "Hallo,\n\nder Benutzer mit der E-Mail-Adresse %s möchte ab jetzt diese Adresse verwenden. Zur Bestätigung bitte innerhalb von 24 Stunden diesem Link folgen:\n\n%s\n\nFalls das nicht gewünscht ist, kann diese E-Mail ignoriert werden.\n",
+		"email_change.notify_subject":   "%s: Die E-Mail-Adresse wurde geändert",
+		"email_change.notify_body":      "Hallo,\n\ndie E-Mail-Adresse des Kontos wurde auf %s geändert. Falls das nicht gewünscht war, bitte Kontakt aufnehmen.\n",
+		"error.email_unchanged":         "die neue E-Mail-Adresse ist die aktuelle",
+		"error.email_taken":             "E-Mail-Adresse bereits vergeben",
+		"error.email_invalid":           "E-Mail-Adresse ungültig",
+		"error.domain_not_allowed":      "E-Mail-Adressen dieser Domain sind nicht zugelassen",
+		"error.domain_denied":           "E-Mail-Adressen dieser Domain sind gesperrt",
+		"registration.title":            "Konto beantragen",
+		"registration.intro":            "Ein Administrator prüft den Antrag. Wird er angenommen, kommt eine E-Mail mit einem Link zum Setzen des Passworts.",
+		"registration.email":            "E-Mail",
+		"registration.reason":           "Wofür wird das Konto benötigt?",
+		"registration.submit":           "Antrag senden",
+		"registration.sent":             "Danke, der Antrag wird geprüft.",
+		"registration.approved_subject": "%s: Das Konto wurde freigeschaltet",
+		"registration.approved_body":    "Hallo,\n\nder Antrag auf ein Konto wurde angenommen. Bitte hier das Passwort setzen:\n\n%s\n",
+		"error.reason_too_long":         "Begründung zu lang",
+		"error.unknown_registration":    "Antrag unbekannt",
+		"error.too_many_registrations":  "zu viele offene Anträge, bitte später erneut versuchen",
+		"admin.users":                   "Benutzer",
+		"admin.registrations":           "Anträge",
+		"admin.rules":                   "Zugriffsregeln",
+		"admin.sessions":                "aktive Sitzungen",
+		"admin.audit":                   "Protokoll",
+		"admin.search":                  "Suche",
+		"admin.search_submit":           "Suchen",
+		"admin.email":                   "E-Mail",
+		"admin.name":                    "Name",
+		"admin.groups":                  "Gruppen",
+		"admin.groups_hint":             "Gruppen, durch Leerzeichen getrennt",
+		"admin.groups_submit":           "Gruppen speichern",
+		"admin.groups_saved":            "Gruppen gespeichert.",
+		"admin.status":                  "Status",
+		"admin.status_active":           "aktiv",
+		"admin.status_pending":          "eingeladen",
+		"admin.status_disabled":         "gesperrt",
+		"admin.admin":                   "Administrator",
+		"admin.invite":                  "Benutzer einladen",
+		"admin.invite_submit":           "Einladen",
+		"admin.invite_subject":          "%s: Einladung",
+		"admin.invite_body":             "Hallo,\n\nfür diese E-Mail-Adresse wurde ein Konto angelegt. Bitte hier das Passwort setzen:\n\n%s\n",
+		"admin.invited":                 "Einladung verschickt.",
+		"admin.resend_invite":           "Einladung erneut senden",
+		"admin.grant_admin":             "zum Administrator machen",
+		"admin.revoke_admin":            "Administratorrechte entziehen",
+		"admin.signout":                 "auf allen Geräten abmelden",
+		"admin.signed_out":              "Auf allen Geräten abgemeldet.",
+		"admin.disable":                 "sperren",
+		"admin.enable":                  "entsperren",
+		"admin.delete":                  "löschen",
+		"admin.delete_confirm":          "wirklich löschen",
+		"admin.deleted":                 "Benutzer gelöscht.",
+		"admin.saved":                   "Gespeichert.",
+		"admin.rules_intro":             "Ein Pfad mit Regeln und alles darunter ist nur für die Mitglieder seiner Gruppen zugänglich. Es gelten die Regeln des längsten passenden Pfads. Pfade ohne Regeln sind für alle Benutzer zugänglich.",
+		"admin.path":                    "Pfad",
+		"admin.group":                   "Gruppe",
+		"admin.rule_add":                "Regel hinzufügen",
+		"admin.since":                   "von",
+		"admin.until":                   "bis",
+		"admin.time":                    "Zeit",
+		"admin.event":                   "Ereignis",
+		"admin.detail":                  "Details",
+		"admin.approve":                 "annehmen",
+		"admin.reject":                  "ablehnen",
+		"admin.approved":                "Antrag angenommen.",
+		"admin.rejected":                "Antrag abgelehnt.",
+		"error.name_too_long":           "Name zu lang",
+		"error.group_invalid":           "Gruppenname ungültig",
+		"error.user_active":             "Benutzer hat bereits ein Passwort gesetzt",
+		"error.user_exists":             "Benutzer existiert bereits",
+		"error.user_disabled":           "Benutzer ist gesperrt",
+		"error.self":                    "beim eigenen Konto nicht möglich",
+		"error.path_invalid":            "Pfad ungültig",
+		"error.invite_not_sent":         "Einladung konnte nicht verschickt werden",
+		"error.not_confirmed":           "bitte bestätigen",
+		"error.unknown_action":          "Aktion unbekannt",
+		"error.date_invalid":            "Datum ungültig, z. B. 2018-06-30",
+	},
+}
@@ -0,0 +1,190 @@
+// Package logging provides a leveled logger with structured output as logfmt or JSON.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+// Levels in ascending severity.
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the level's name.
+func (level Level) String() string {
+	if level < Debug || level > Error {
+		return strconv.Itoa(int(level))
+	}
+	return levelNames[level]
+}
+
+// ParseLevel returns the level with the given name.
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown log level %q", name)
+}
+
+// Format is the output format.
+type Format string
+
+// Output formats.
+const (
+	Logfmt = Format("logfmt")
+	JSON   = Format("json")
+)
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case Logfmt, JSON:
+		return format, nil
+	}
+	return Logfmt, fmt.Errorf("unknown log format %q", name)
+}
+
+// Logger writes log entries with a time, level, message and key value pairs.
+// It's safe for concurrent use.
+type Logger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  Level
+	format Format
+	fields []interface{} // key value pairs added to every entry
+}
+
+// New returns a logger writing entries of at least the given level to out.
+func New(out io.Writer, level Level, format Format) *Logger {
+	return &Logger{
+		mu:     &sync.Mutex{},
+		out:    out,
+		level:  level,
+		format: format,
+	}
+}
+
+// Default is the logger used if there's none in the context.
+var Default = New(os.Stderr, Info, Logfmt)
+
+// With returns a logger adding the given key value pairs to every entry.
+func (logger *Logger) With(keyvals ...interface{}) *Logger {
+	child := *logger
+	child.fields = append(append([]interface{}{}, logger.fields...), keyvals...)
+	return &child
+}
+
+// Debug logs at level Debug.
+func (logger *Logger) Debug(msg string, keyvals ...interface{}) {
+	logger.log(Debug, msg, keyvals)
+}
+
+// Info logs at level Info.
+func (logger *Logger) Info(msg string, keyvals ...interface{}) {
+	logger.log(Info, msg, keyvals)
+}
+
+// Warn logs at level Warn.
+func (logger *Logger) Warn(msg string, keyvals ...interface{}) {
+	logger.log(Warn, msg, keyvals)
+}
+
+// Error logs at level Error.
+func (logger *Logger) Error(msg string, keyvals ...interface{}) {
+	logger.log(Error, msg, keyvals)
+}
+
+// log writes the entry if the level is enabled.
+func (logger *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if level < logger.level {
+		return
+	}
+
+	all := append([]interface{}{"time", time.Now().UTC().Format(time.RFC3339), "level", level.String(), "msg", msg}, logger.fields...)
+	all = append(all, keyvals...)
+	if len(all)%2 != 0 {
+		all = append(all, "(MISSING)")
+	}
+
+	var line []byte
+	if logger.format == JSON {
+		line = formatJSON(all)
+	} else {
+		line = formatLogfmt(all)
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.out.Write(line)
+}
+
+// formatJSON returns the key value pairs as a JSON object followed by a newline.
+func formatJSON(keyvals []interface{}) []byte {
+	entry := map[string]interface{}{}
+	for i := 0; i < len(keyvals); i += 2 {
+		value := keyvals[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[fmt.Sprint(keyvals[i])] = value
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{"msg": "unable to marshal log entry", "error": err.Error()})
+	}
+	return append(line, '\n')
+}
+
+// formatLogfmt returns the key value pairs as `key=value` separated by spaces followed by a newline.
+func formatLogfmt(keyvals []interface{}) []byte {
+	var b strings.Builder
+	for i := 0; i < len(keyvals); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(fmt.Sprint(keyvals[i]))
+		b.WriteByte('=')
+
+		value := fmt.Sprint(keyvals[i+1])
+		if value == "" || strings.ContainsAny(value, " =\"\t\r\n") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the logger.
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger of the context or Default if there's none.
+func FromContext(ctx context.Context) *Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return logger
+	}
+	return Default
+}
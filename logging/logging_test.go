@@ -0,0 +1,91 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kschaper/auth-static/logging"
+)
+
+func TestLogger(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"logfmt": func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := logging.New(&buf, logging.Info, logging.Logfmt).With("request_id", "abc")
+
+			logger.Error("signin failed", "error", errors.New("database is locked"), "status", 500)
+
+			line := buf.String()
+			for _, expected := range []string{` level=error `, ` msg="signin failed" `, ` request_id=abc `, ` error="database is locked" `, ` status=500` + "\n"} {
+				if !strings.Contains(line, expected) {
+					t.Fatalf("expected line to contain %q but didn't: %s", expected, line)
+				}
+			}
+		},
+		"json": func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := logging.New(&buf, logging.Info, logging.JSON).With("request_id", "abc")
+
+			logger.Info("request", "status", 200, "error", errors.New("none"))
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("expected JSON but got %q: %s", err, buf.String())
+			}
+			expected := map[string]interface{}{"level": "info", "msg": "request", "request_id": "abc", "status": float64(200), "error": "none"}
+			for key, value := range expected {
+				if entry[key] != value {
+					t.Fatalf("expected %s to be %v but got %v\n", key, value, entry[key])
+				}
+			}
+		},
+		"level": func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := logging.New(&buf, logging.Warn, logging.Logfmt)
+
+			logger.Debug("debug")
+			logger.Info("info")
+			if buf.Len() != 0 {
+				t.Fatalf("expected no output below level warn but got %q", buf.String())
+			}
+
+			logger.Warn("warn")
+			if !strings.Contains(buf.String(), "level=warn") {
+				t.Fatalf("expected warn entry but got %q", buf.String())
+			}
+		},
+		"context": func(t *testing.T) {
+			if logger := logging.FromContext(context.Background()); logger != logging.Default {
+				t.Fatal("expected default logger for context without logger")
+			}
+
+			logger := logging.New(&bytes.Buffer{}, logging.Info, logging.Logfmt)
+			ctx := logging.NewContext(context.Background(), logger)
+			if logging.FromContext(ctx) != logger {
+				t.Fatal("expected logger from context")
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := logging.ParseLevel("WARN")
+	if err != nil {
+		t.Fatalf("expected no error but got %q", err)
+	}
+	if level != logging.Warn {
+		t.Fatalf("expected level %s but got %s\n", logging.Warn, level)
+	}
+
+	if _, err := logging.ParseLevel("verbose"); err == nil {
+		t.Fatal("expected error but got none")
+	}
+}
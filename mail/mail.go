@@ -0,0 +1,88 @@
+// Package mail sends the app's emails, e.g. the verification of a new email address.
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"time"
+
+	"github.com/kschaper/auth-static/logging"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer sends emails via an SMTP server. STARTTLS is used if the server supports it.
+type SMTPMailer struct {
+	Addr     string // host:port, e.g. "localhost:25"
+	From     string
+	Username string // PLAIN authentication if not empty, requires TLS unless the server is localhost
+	Password string
+}
+
+// Send sends the message.
+func (mailer *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if mailer.Username != "" {
+		host, _, err := net.SplitHostPort(mailer.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", mailer.Username, mailer.Password, host)
+	}
+
+	data, err := format(mailer.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(mailer.Addr, auth, mailer.From, []string{msg.To}, data)
+}
+
+// LogMailer logs the emails instead of sending them, e.g. while developing.
+type LogMailer struct {
+	Logger *logging.Logger // logging.Default if nil
+}
+
+// Send logs the message.
+func (mailer *LogMailer) Send(msg Message) error {
+	logger := mailer.Logger
+	if logger == nil {
+		logger = logging.Default
+	}
+	logger.Info("sending email", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// format returns the message with headers and a quoted-printable body as sent via SMTP.
+func format(from string, msg Message, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(msg.Body)); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,114 @@
+package mail_test
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/kschaper/auth-static/logging"
+	authmail "github.com/kschaper/auth-static/mail"
+)
+
+// smtpServer accepts one SMTP session without TLS and authentication and sends the received data to the channel.
+func smtpServer(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 1)
+
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 ok")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := smtpServer(t)
+	mailer := &authmail.SMTPMailer{Addr: addr, From: "auth@example.com"}
+
+	err := mailer.Send(authmail.Message{To: "me@example.com", Subject: "Bestätigung", Body: "Bitte bestätigen: https://example.com/x"})
+	if err != nil {
+		t.Fatalf("expected no error but got %q\n", err)
+	}
+
+	// parse the received message
+	msg, err := mail.ReadMessage(strings.NewReader(<-received))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to := msg.Header.Get("To"); to != "me@example.com" {
+		t.Fatalf("expected To %q but got %q\n", "me@example.com", to)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Bestätigung" {
+		t.Fatalf("expected subject %q but got %q\n", "Bestätigung", subject)
+	}
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bytes.TrimSpace(body)) != "Bitte bestätigen: https://example.com/x" {
+		t.Fatalf("expected body %q but got %q\n", "Bitte bestätigen: https://example.com/x", body)
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := &authmail.LogMailer{Logger: logging.New(&buf, logging.Info, logging.Logfmt)}
+
+	if err := mailer.Send(authmail.Message{To: "me@example.com", Subject: "subject", Body: "body"}); err != nil {
+		t.Fatalf("expected no error but got %q\n", err)
+	}
+	if !strings.Contains(buf.String(), "to=me@example.com") {
+		t.Fatalf("expected the email to be logged but got %q\n", buf.String())
+	}
+}
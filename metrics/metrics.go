@@ -0,0 +1,300 @@
+// Package metrics provides counters, histograms and gauges exposed in the Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets in seconds suited for request latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector is a metric which can be registered.
+type Collector interface {
+	// write writes the metric in the text exposition format.
+	write(w io.Writer) error
+}
+
+// Registry holds the metrics to expose.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// Default is the registry used by the package level Register.
+var Default = &Registry{}
+
+// Register adds the collectors to the default registry.
+func Register(collectors ...Collector) {
+	Default.Register(collectors...)
+}
+
+// Register adds the collectors to the registry.
+func (registry *Registry) Register(collectors ...Collector) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.collectors = append(registry.collectors, collectors...)
+}
+
+// Write writes all metrics in the text exposition format.
+func (registry *Registry) Write(w io.Writer) error {
+	registry.mu.Lock()
+	collectors := append([]Collector{}, registry.collectors...)
+	registry.mu.Unlock()
+
+	for _, collector := range collectors {
+		if err := collector.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the metrics of the registry.
+func (registry *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := registry.Write(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		buf.WriteTo(w)
+	})
+}
+
+// desc describes a metric.
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+// header writes the HELP and TYPE lines.
+func (d *desc) header(w io.Writer, typ string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, strings.Replace(d.help, "\n", " ", -1), d.name, typ)
+	return err
+}
+
+// key joins the label values to a map key. It panics if the number of values doesn't match the labels.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values but got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs returns the labels of the key in the format `{name="value",...}`, with the extra pair appended if given.
+func (d *desc) labelPairs(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+"="+quote(value))
+		}
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+"="+quote(extra[1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// quote quotes a label value.
+func quote(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return `"` + value + `"`
+}
+
+// formatFloat formats the value as Prometheus expects it.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sortedKeys returns the map's keys in ascending order.
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec returns a counter with the given label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		desc:   desc{name: name, help: help, labels: labels},
+		values: map[string]float64{},
+	}
+}
+
+// Inc increments the counter for the given label values by 1.
+func (counter *CounterVec) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+// Add increments the counter for the given label values.
+func (counter *CounterVec) Add(value float64, labelValues ...string) {
+	key := counter.key(labelValues)
+	counter.mu.Lock()
+	counter.values[key] += value
+	counter.mu.Unlock()
+}
+
+// Value returns the counter's value for the given label values.
+func (counter *CounterVec) Value(labelValues ...string) float64 {
+	key := counter.key(labelValues)
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	return counter.values[key]
+}
+
+func (counter *CounterVec) write(w io.Writer) error {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	if err := counter.header(w, "counter"); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(counter.values) {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", counter.name, counter.labelPairs(key), formatFloat(counter.values[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogram
+}
+
+// histogram holds the observations for one set of label values.
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec returns a histogram with the given upper bucket bounds and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{
+		desc:    desc{name: name, help: help, labels: labels},
+		buckets: buckets,
+		series:  map[string]*histogram{},
+	}
+}
+
+// Observe adds the value for the given label values.
+func (hist *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := hist.key(labelValues)
+	hist.mu.Lock()
+	defer hist.mu.Unlock()
+
+	series, ok := hist.series[key]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(hist.buckets))}
+		hist.series[key] = series
+	}
+	if i := sort.SearchFloat64s(hist.buckets, value); i < len(hist.buckets) {
+		series.counts[i]++
+	}
+	series.sum += value
+	series.count++
+}
+
+// Count returns the number of observations for the given label values.
+func (hist *HistogramVec) Count(labelValues ...string) uint64 {
+	key := hist.key(labelValues)
+	hist.mu.Lock()
+	defer hist.mu.Unlock()
+	if series, ok := hist.series[key]; ok {
+		return series.count
+	}
+	return 0
+}
+
+func (hist *HistogramVec) write(w io.Writer) error {
+	hist.mu.Lock()
+	defer hist.mu.Unlock()
+
+	if err := hist.header(w, "histogram"); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(hist.series))
+	for key := range hist.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		series := hist.series[key]
+		var cumulative uint64
+		for i, bound := range hist.buckets {
+			cumulative += series.counts[i]
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", hist.name, hist.labelPairs(key, "le", formatFloat(bound)), cumulative); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			hist.name, hist.labelPairs(key, "le", "+Inf"), series.count,
+			hist.name, hist.labelPairs(key), formatFloat(series.sum),
+			hist.name, hist.labelPairs(key), series.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GaugeFunc is a gauge whose value is determined when the metrics are collected.
+type GaugeFunc struct {
+	desc
+	fn func() (float64, error)
+}
+
+// NewGaugeFunc returns a gauge calling fn for its value.
+func NewGaugeFunc(name, help string, fn func() (float64, error)) *GaugeFunc {
+	return &GaugeFunc{desc: desc{name: name, help: help}, fn: fn}
+}
+
+func (gauge *GaugeFunc) write(w io.Writer) error {
+	value, err := gauge.fn()
+	if err != nil {
+		return fmt.Errorf("collecting %s: %s", gauge.name, err)
+	}
+	if err := gauge.header(w, "gauge"); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s %s\n", gauge.name, formatFloat(value))
+	return err
+}
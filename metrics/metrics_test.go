@@ -0,0 +1,141 @@
+package metrics_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kschaper/auth-static/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"counter": func(t *testing.T) {
+			registry := &metrics.Registry{}
+			counter := metrics.NewCounterVec("signins_total", "Signins.", "result")
+			registry.Register(counter)
+
+			counter.Inc("success")
+			counter.Inc("success")
+			counter.Add(3, `fail"ure`)
+
+			// ensure the value is counted
+			if value := counter.Value("success"); value != 2 {
+				t.Fatalf("expected value 2 but got %v\n", value)
+			}
+
+			// ensure the exposition format
+			var buf bytes.Buffer
+			if err := registry.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			expected := "# HELP signins_total Signins.\n" +
+				"# TYPE signins_total counter\n" +
+				"signins_total{result=\"fail\\\"ure\"} 3\n" +
+				"signins_total{result=\"success\"} 2\n"
+			if buf.String() != expected {
+				t.Fatalf("expected %q but got %q\n", expected, buf.String())
+			}
+		},
+		"counter without labels": func(t *testing.T) {
+			registry := &metrics.Registry{}
+			counter := metrics.NewCounterVec("signups_total", "Signups.")
+			registry.Register(counter)
+			counter.Inc()
+
+			var buf bytes.Buffer
+			if err := registry.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(buf.String(), "\nsignups_total 1\n") {
+				t.Fatalf("expected an unlabeled sample but got %q\n", buf.String())
+			}
+		},
+		"histogram": func(t *testing.T) {
+			registry := &metrics.Registry{}
+			hist := metrics.NewHistogramVec("duration_seconds", "Duration.", []float64{1, 0.1}, "handler")
+			registry.Register(hist)
+
+			hist.Observe(0.05, "signin")
+			hist.Observe(0.5, "signin")
+			hist.Observe(2, "signin")
+
+			// ensure the observations are counted
+			if count := hist.Count("signin"); count != 3 {
+				t.Fatalf("expected count 3 but got %d\n", count)
+			}
+
+			// ensure the buckets are sorted and cumulative
+			var buf bytes.Buffer
+			if err := registry.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			expected := "# HELP duration_seconds Duration.\n" +
+				"# TYPE duration_seconds histogram\n" +
+				"duration_seconds_bucket{handler=\"signin\",le=\"0.1\"} 1\n" +
+				"duration_seconds_bucket{handler=\"signin\",le=\"1\"} 2\n" +
+				"duration_seconds_bucket{handler=\"signin\",le=\"+Inf\"} 3\n" +
+				"duration_seconds_sum{handler=\"signin\"} 2.55\n" +
+				"duration_seconds_count{handler=\"signin\"} 3\n"
+			if buf.String() != expected {
+				t.Fatalf("expected %q but got %q\n", expected, buf.String())
+			}
+		},
+		"gauge func": func(t *testing.T) {
+			registry := &metrics.Registry{}
+			registry.Register(metrics.NewGaugeFunc("pending", "Pending.", func() (float64, error) {
+				return 7, nil
+			}))
+
+			var buf bytes.Buffer
+			if err := registry.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(buf.String(), "# TYPE pending gauge\npending 7\n") {
+				t.Fatalf("expected gauge sample but got %q\n", buf.String())
+			}
+		},
+		"gauge func error": func(t *testing.T) {
+			registry := &metrics.Registry{}
+			registry.Register(metrics.NewGaugeFunc("pending", "Pending.", func() (float64, error) {
+				return 0, errors.New("database closed")
+			}))
+
+			// ensure the handler responds with 500
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			registry.Handler().ServeHTTP(w, req)
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusInternalServerError, w.Code)
+			}
+		},
+		"handler": func(t *testing.T) {
+			registry := &metrics.Registry{}
+			counter := metrics.NewCounterVec("signups_total", "Signups.")
+			registry.Register(counter)
+			counter.Inc()
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			registry.Handler().ServeHTTP(w, req)
+
+			// ensure status code 200 and the text format's content type
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code %d but got %d\n", http.StatusOK, w.Code)
+			}
+			if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+				t.Fatalf("expected text format content type but got %q\n", contentType)
+			}
+			if !strings.Contains(w.Body.String(), "signups_total 1\n") {
+				t.Fatalf("expected body to contain the counter but got %q\n", w.Body.String())
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
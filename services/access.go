@@ -0,0 +1,124 @@
+package services
+
+import (
+	"path"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// CreateTableAccessRules is the SQL statement to create the access_rules table.
+const CreateTableAccessRules = `CREATE TABLE IF NOT EXISTS access_rules (
+	path				TEXT NOT NULL,
+	group_name	TEXT NOT NULL,
+	PRIMARY KEY (path, group_name)
+)`
+
+// ErrPathInvalid is returned when the path of an access rule is empty or contains ".." segments.
+const ErrPathInvalid = Error("path invalid")
+
+// AccessRule restricts a path of the protected area and everything below it to the members of a group.
+// A path with several rules is open to the members of any of their groups.
+type AccessRule struct {
+	Path  string // relative to the protected area without leading and trailing slashes, e.g. "reports/2018"
+	Group string
+}
+
+// AccessRules returns all rules sorted by path and group.
+func (service *UserService) AccessRules() ([]AccessRule, error) {
+	rows, err := service.DB.Query("SELECT path, group_name FROM access_rules ORDER BY path, group_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []AccessRule
+	for rows.Next() {
+		var rule AccessRule
+		if err := rows.Scan(&rule.Path, &rule.Group); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// AddAccessRule adds the rule. Existing rules are ignored.
+// It returns ErrPathInvalid or ErrGroupInvalid for invalid rules.
+func (service *UserService) AddAccessRule(rule AccessRule) error {
+	rule, err := checkAccessRule(rule)
+	if err != nil {
+		return err
+	}
+	_, err = service.DB.Exec("INSERT INTO access_rules (path, group_name) VALUES (?, ?) ON CONFLICT(path, group_name) DO NOTHING", rule.Path, rule.Group)
+	return err
+}
+
+// DeleteAccessRule deletes the rule. Unknown rules are ignored.
+func (service *UserService) DeleteAccessRule(rule AccessRule) error {
+	_, err := service.DB.Exec("DELETE FROM access_rules WHERE path = ? AND group_name = ?", strings.Trim(rule.Path, "/"), rule.Group)
+	return err
+}
+
+// Allowed checks if the user may access the path relative to the protected area, e.g. "reports/2018/q1.pdf".
+// The rules of the longest matching path apply. Paths without rules are open to all users.
+func (service *UserService) Allowed(userID uuid.UUID, rel string) (bool, error) {
+	rules, err := service.AccessRules()
+	if err != nil {
+		return false, err
+	}
+
+	// groups of the most specific path
+	rel = strings.Trim(rel, "/")
+	var (
+		longest = -1
+		groups  []string
+	)
+	for _, rule := range rules {
+		if rel != rule.Path && !strings.HasPrefix(rel, rule.Path+"/") {
+			continue
+		}
+		if len(rule.Path) > longest {
+			longest, groups = len(rule.Path), nil
+		}
+		if len(rule.Path) == longest {
+			groups = append(groups, rule.Group)
+		}
+	}
+	if longest < 0 {
+		return true, nil
+	}
+
+	member, err := service.Groups(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, group := range groups {
+		for _, m := range member {
+			if group == m {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// checkAccessRule returns the rule with a cleaned path or ErrPathInvalid or ErrGroupInvalid.
+func checkAccessRule(rule AccessRule) (AccessRule, error) {
+	p := strings.TrimSpace(rule.Path)
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return rule, ErrPathInvalid
+		}
+	}
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return rule, ErrPathInvalid
+	}
+
+	groups, err := checkGroups([]string{rule.Group})
+	if err != nil {
+		return rule, err
+	}
+	return AccessRule{Path: p, Group: groups[0]}, nil
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// AddColumnUsersAdmin is the SQL statement to add the admin flag to the users table.
+const AddColumnUsersAdmin = `ALTER TABLE users ADD COLUMN admin INTEGER NOT NULL DEFAULT 0`
+
+// AddColumnUsersDisabledAt is the SQL statement to add the time a user was disabled to the users table.
+const AddColumnUsersDisabledAt = `ALTER TABLE users ADD COLUMN disabled_at TEXT`
+
+const (
+	// ErrUserActive is returned when an invitation is resent to a user who has already set a password.
+	ErrUserActive = Error("user already active")
+	// ErrUserDisabled is returned when a disabled user is re-invited.
+	ErrUserDisabled = Error("user disabled")
+	// ErrSelf is returned when admins try to disable, delete or demote themselves.
+	ErrSelf = Error("admins can't do this to themselves")
+)
+
+// UserSession is a session with its user's email.
+type UserSession struct {
+	Session
+	Email string
+}
+
+// FindUsers returns the users whose email or name contains the query ignoring case, sorted by email.
+// All users are returned for an empty query.
+func (service *UserService) FindUsers(query string) ([]User, error) {
+	users, err := service.Users()
+	if err != nil || query == "" {
+		return users, err
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	var found []User
+	for _, user := range users {
+		if strings.Contains(strings.ToLower(user.Email), query) || strings.Contains(strings.ToLower(user.Name), query) {
+			found = append(found, user)
+		}
+	}
+	return found, nil
+}
+
+// SetAdmin grants or revokes the user's access to the admin pages.
+func (service *UserService) SetAdmin(id uuid.UUID, admin bool) error {
+	return service.updateUser(id, "UPDATE users SET admin = ?, updated_at = DATETIME('now') WHERE id = ?", admin, id)
+}
+
+// IsAdmin checks if the user may use the admin pages.
+func (service *UserService) IsAdmin(id uuid.UUID) (bool, error) {
+	var admin bool
+	err := service.DB.QueryRow("SELECT admin FROM users WHERE id = ? AND disabled_at IS NULL", id).Scan(&admin)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return admin, err
+}
+
+// Disable prevents the user from signing in or signing up and deletes the user's sessions.
+// An unused invitation becomes invalid, so pending users need a new one after Enable.
+func (service *UserService) Disable(id uuid.UUID) error {
+	exists, err := service.Exists(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUnknownUser
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET disabled_at = DATETIME('now'), code = '', updated_at = DATETIME('now') "+
+		"WHERE id = ? AND disabled_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Enable lets a disabled user sign in again.
+func (service *UserService) Enable(id uuid.UUID) error {
+	return service.updateUser(id, "UPDATE users SET disabled_at = NULL, updated_at = DATETIME('now') WHERE id = ?", id)
+}
+
+// Delete deletes the user with the user's sessions, groups and pending email change.
+// The audit log keeps the user's events.
+func (service *UserService) Delete(id uuid.UUID) error {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"sessions", "user_groups", "email_changes"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", id); err != nil {
+			return err
+		}
+	}
+	result, err := tx.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUnknownUser
+	}
+	return tx.Commit()
+}
+
+// ResendInvite replaces the code of a user who hasn't set a password yet and returns the email and the new code.
+// It returns ErrUserActive for users with a password and ErrUserDisabled for disabled users.
+func (service *UserService) ResendInvite(id uuid.UUID) (string, string, error) {
+	user, err := service.Get(id)
+	if err != nil {
+		return "", "", err
+	}
+	if user.Active {
+		return "", "", ErrUserActive
+	}
+	if user.Disabled {
+		return "", "", ErrUserDisabled
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return "", "", err
+	}
+	result, err := service.DB.Exec("UPDATE users SET code = ?, updated_at = DATETIME('now') WHERE id = ? AND disabled_at IS NULL", code, id)
+	if err != nil {
+		return "", "", err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return "", "", err
+	} else if n == 0 {
+		return "", "", ErrUserDisabled
+	}
+	return user.Email, code, nil
+}
+
+// ActiveSessions returns the sessions of all users used within SessionMaxIdle, the most recently used first.
+func (service *UserService) ActiveSessions() ([]UserSession, error) {
+	rows, err := service.DB.Query("SELECT s.id, s.user_id, u.email, s.created_at, s.last_seen_at, s.ip, s.user_agent "+
+		"FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.last_seen_at >= ? "+
+		"ORDER BY s.last_seen_at DESC, s.created_at DESC", sessionCutoff())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []UserSession
+	for rows.Next() {
+		var (
+			session    UserSession
+			userID     string
+			createdAt  string
+			lastSeenAt string
+			ip         sql.NullString
+			userAgent  sql.NullString
+		)
+		if err := rows.Scan(&session.ID, &userID, &session.Email, &createdAt, &lastSeenAt, &ip, &userAgent); err != nil {
+			return nil, err
+		}
+		if session.UserID, err = uuid.FromString(userID); err != nil {
+			return nil, err
+		}
+		if session.CreatedAt, err = time.Parse(timeFormat, createdAt); err != nil {
+			return nil, err
+		}
+		if session.LastSeenAt, err = time.Parse(timeFormat, lastSeenAt); err != nil {
+			return nil, err
+		}
+		session.IP = ip.String
+		session.UserAgent = userAgent.String
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// updateUser executes the update of a user and returns ErrUnknownUser if there's no user with the ID.
+func (service *UserService) updateUser(id uuid.UUID, query string, args ...interface{}) error {
+	if _, err := service.DB.Exec(query, args...); err != nil {
+		return err
+	}
+	exists, err := service.Exists(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUnknownUser
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestUserService_Admin(t *testing.T) {
+	password := strings.Repeat("x", services.PasswordMinLen)
+
+	// setup creates a user who has set a password.
+	setup := func(t *testing.T) (*services.UserService, uuid.UUID) {
+		userService := &services.UserService{DB: db(t)}
+		code, err := userService.Create("me@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := userService.GetIDByCode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := userService.UpdatePassword(id, password, password); err != nil {
+			t.Fatal(err)
+		}
+		return userService, id
+	}
+
+	cases := map[string]func(t *testing.T){
+		"disable and enable": func(t *testing.T) {
+			userService, id := setup(t)
+			if err := userService.SetAdmin(id, true); err != nil {
+				t.Fatal(err)
+			}
+			sessionID, err := userService.CreateSession(id, "127.0.0.1", "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := userService.Disable(id); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if ok, err := userService.Authenticate("me@example.com", password); err != nil || ok {
+				t.Fatalf("expected disabled user not to authenticate but got %t, %v\n", ok, err)
+			}
+			if userID, err := userService.SessionUserID(sessionID); err != nil || userID != uuid.Nil {
+				t.Fatalf("expected session to be deleted but got %s, %v\n", userID, err)
+			}
+			if admin, err := userService.IsAdmin(id); err != nil || admin {
+				t.Fatalf("expected disabled admin not to be admin but got %t, %v\n", admin, err)
+			}
+
+			if err := userService.Enable(id); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if ok, err := userService.Authenticate("me@example.com", password); err != nil || !ok {
+				t.Fatalf("expected enabled user to authenticate but got %t, %v\n", ok, err)
+			}
+			if admin, err := userService.IsAdmin(id); err != nil || !admin {
+				t.Fatalf("expected enabled admin to be admin but got %t, %v\n", admin, err)
+			}
+		},
+		"delete": func(t *testing.T) {
+			userService, id := setup(t)
+			if err := userService.SetGroups(id, []string{"staff"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := userService.Delete(id); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if exists, err := userService.Exists(id); err != nil || exists {
+				t.Fatalf("expected user to be deleted but got %t, %v\n", exists, err)
+			}
+			if err := userService.Delete(id); err != services.ErrUnknownUser {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUnknownUser, err)
+			}
+		},
+		"resend invite": func(t *testing.T) {
+			userService, id := setup(t)
+			if _, _, err := userService.ResendInvite(id); err != services.ErrUserActive {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUserActive, err)
+			}
+
+			code, err := userService.Create("you@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			pendingID, err := userService.GetIDByCode(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			email, newCode, err := userService.ResendInvite(pendingID)
+			if err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if email != "you@example.com" || newCode == code {
+				t.Fatalf("expected a new code for %q but got %q, %q\n", "you@example.com", email, newCode)
+			}
+			if _, err := userService.GetIDByCode(code); err != services.ErrUnknownCode {
+				t.Fatalf("expected old code to be invalid but got %v\n", err)
+			}
+
+			// ensure disabled users aren't invited
+			if err := userService.Disable(pendingID); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := userService.ResendInvite(pendingID); err != services.ErrUserDisabled {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUserDisabled, err)
+			}
+		},
+		"find users": func(t *testing.T) {
+			userService, _ := setup(t)
+			if _, err := userService.Create("you@example.org"); err != nil {
+				t.Fatal(err)
+			}
+
+			users, err := userService.FindUsers("EXAMPLE.ORG")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != 1 || users[0].Email != "you@example.org" {
+				t.Fatalf("expected %q but got %+v\n", "you@example.org", users)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestUserService_Allowed(t *testing.T) {
+	userService := &services.UserService{DB: db(t)}
+	code, err := userService.Create("me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := userService.GetIDByCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := userService.SetGroups(id, []string{"staff"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range []services.AccessRule{
+		{Path: "/reports/", Group: "staff"},
+		{Path: "reports/board", Group: "board"},
+	} {
+		if err := userService.AddAccessRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for rel, expected := range map[string]bool{
+		"index.html":               true,
+		"reports-old/q1.pdf":       true,
+		"reports/q1.pdf":           true,
+		"reports/board/q1.pdf":     false,
+		"reports/boardroom/a.html": true,
+	} {
+		allowed, err := userService.Allowed(id, rel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != expected {
+			t.Fatalf("expected %s to be allowed %t but got %t\n", rel, expected, allowed)
+		}
+	}
+
+	for _, rule := range []services.AccessRule{
+		{Path: "../reports", Group: "staff"},
+		{Path: "/", Group: "staff"},
+		{Path: "reports", Group: "staff team"},
+	} {
+		if err := userService.AddAccessRule(rule); err != services.ErrPathInvalid && err != services.ErrGroupInvalid {
+			t.Fatalf("expected rule %+v to be invalid but got %v\n", rule, err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// CreateTableAuditEvents is the SQL statement to create the audit_events table.
+const CreateTableAuditEvents = `CREATE TABLE IF NOT EXISTS audit_events (
+	id					INTEGER PRIMARY KEY AUTOINCREMENT,
+	time				TEXT NOT NULL,
+	type				TEXT NOT NULL,
+	user_id			TEXT,
+	email				TEXT,
+	path				TEXT,
+	ip					TEXT,
+	user_agent	TEXT
+)`
+
+// AddColumnAuditEventsDetail is the SQL statement to add details like changed groups to the audit_events table.
+const AddColumnAuditEventsDetail = `ALTER TABLE audit_events ADD COLUMN detail TEXT`
+
+// AuditEventType is the kind of an audit event.
+type AuditEventType string
+
+const (
+	// AuditSigninSuccess is recorded when a user signed in.
+	AuditSigninSuccess = AuditEventType("signin_success")
+	// AuditSigninFailure is recorded when email and/or password were wrong.
+	AuditSigninFailure = AuditEventType("signin_failure")
+	// AuditSignup is recorded when a user set the initial password.
+	AuditSignup = AuditEventType("signup")
+	// AuditPasswordChange is recorded when a signed-in user changed the password.
+	AuditPasswordChange = AuditEventType("password_change")
+	// AuditEmailChange is recorded when a user confirmed a new email. The event's email is the new one.
+	AuditEmailChange = AuditEventType("email_change")
+	// AuditRegistration is recorded when a visitor asked for an account. The event's email is the given one.
+	AuditRegistration = AuditEventType("registration")
+	// AuditRegistrationApproved is recorded when an admin approved a registration and the user was created.
+	AuditRegistrationApproved = AuditEventType("registration_approved")
+	// AuditRegistrationRejected is recorded when an admin rejected a registration.
+	AuditRegistrationRejected = AuditEventType("registration_rejected")
+	// AuditAdminInvite is recorded when an admin invited a user. Like all admin events its user is the admin,
+	// its email the one of the user the admin acted on.
+	AuditAdminInvite = AuditEventType("admin_invite")
+	// AuditAdminResendInvite is recorded when an admin sent a pending user a new invitation.
+	AuditAdminResendInvite = AuditEventType("admin_resend_invite")
+	// AuditAdminDisable is recorded when an admin disabled a user.
+	AuditAdminDisable = AuditEventType("admin_disable")
+	// AuditAdminEnable is recorded when an admin enabled a disabled user.
+	AuditAdminEnable = AuditEventType("admin_enable")
+	// AuditAdminDelete is recorded when an admin deleted a user.
+	AuditAdminDelete = AuditEventType("admin_delete")
+	// AuditAdminSignout is recorded when an admin signed a user out on all devices.
+	AuditAdminSignout = AuditEventType("admin_signout")
+	// AuditAdminGroups is recorded when an admin changed a user's groups. The detail lists the new groups.
+	AuditAdminGroups = AuditEventType("admin_groups")
+	// AuditAdminRole is recorded when an admin granted or revoked a user's admin access. The detail is "granted" or "revoked".
+	AuditAdminRole = AuditEventType("admin_role")
+	// AuditAdminAccessRule is recorded when an admin added or deleted an access rule. The detail describes the change.
+	AuditAdminAccessRule = AuditEventType("admin_access_rule")
+	// AuditSignout is recorded when a user signed out.
+	AuditSignout = AuditEventType("signout")
+	// AuditFileAccess is recorded when a signed-in user requested a protected file.
+	AuditFileAccess = AuditEventType("file_access")
+	// AuditAccessDenied is recorded when a protected file was requested without a valid session
+	// or by a user whose groups may not access it.
+	AuditAccessDenied = AuditEventType("access_denied")
+)
+
+// AuditEvent is an entry of the audit log.
+type AuditEvent struct {
+	Time      time.Time      `json:"time"`
+	Type      AuditEventType `json:"type"`
+	UserID    uuid.UUID      `json:"user_id"`         // uuid.Nil if unknown
+	Email     string         `json:"email,omitempty"` // e.g. the email given on a failed signin
+	Path      string         `json:"path,omitempty"`
+	IP        string         `json:"ip,omitempty"`
+	UserAgent string         `json:"user_agent,omitempty"`
+	Detail    string         `json:"detail,omitempty"` // e.g. the new groups of an AuditAdminGroups event
+}
+
+// AuditSink records audit events.
+type AuditSink interface {
+	Record(event AuditEvent) error
+}
+
+// AuditSinks records events in each of the sinks.
+type AuditSinks []AuditSink
+
+// Record records the event in all sinks and returns the first error.
+func (sinks AuditSinks) Record(event AuditEvent) error {
+	var first error
+	for _, sink := range sinks {
+		if err := sink.Record(event); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close closes the sinks which are an io.Closer and returns the first error.
+func (sinks AuditSinks) Close() error {
+	var first error
+	for _, sink := range sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// JSONAuditSink writes events as JSON lines.
+type JSONAuditSink struct {
+	mu sync.Mutex
+	W  io.Writer
+}
+
+// Record writes the event as a line of JSON.
+func (sink *JSONAuditSink) Record(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	_, err = sink.W.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes W if it's an io.Closer, e.g. a file.
+func (sink *JSONAuditSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if closer, ok := sink.W.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// AuditService stores audit events in the audit_events table and queries them.
+type AuditService struct {
+	DB *sql.DB
+}
+
+// Record stores the event.
+func (service *AuditService) Record(event AuditEvent) error {
+	var userID sql.NullString
+	if event.UserID != uuid.Nil {
+		userID = sql.NullString{String: event.UserID.String(), Valid: true}
+	}
+
+	_, err := service.DB.Exec("INSERT INTO audit_events (time, type, user_id, email, path, ip, user_agent, detail) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		event.Time.UTC().Format(timeFormat), string(event.Type), userID, event.Email, event.Path, event.IP, event.UserAgent, event.Detail)
+	return err
+}
+
+// AuditFilter restricts the events returned by AuditService.Query. Zero values don't restrict.
+type AuditFilter struct {
+	UserID     uuid.UUID
+	Email      string
+	PathPrefix string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Latest     bool // return the latest Limit events, newest first
+}
+
+// Query returns the events matching the filter ordered by time, newest first if filter.Latest is set.
+// UserID and Email match events having either of them.
+func (service *AuditService) Query(filter AuditFilter) ([]AuditEvent, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+
+	switch {
+	case filter.UserID != uuid.Nil && filter.Email != "":
+		where = append(where, "(user_id = ? OR email = ?)")
+		args = append(args, filter.UserID.String(), filter.Email)
+	case filter.UserID != uuid.Nil:
+		where = append(where, "user_id = ?")
+		args = append(args, filter.UserID.String())
+	case filter.Email != "":
+		where = append(where, "email = ?")
+		args = append(args, filter.Email)
+	}
+	if filter.PathPrefix != "" {
+		where = append(where, "SUBSTR(path, 1, ?) = ?")
+		args = append(args, len(filter.PathPrefix), filter.PathPrefix)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, filter.Since.UTC().Format(timeFormat))
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, filter.Until.UTC().Format(timeFormat))
+	}
+
+	query := "SELECT time, type, user_id, email, path, ip, user_agent, detail FROM audit_events"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if filter.Latest {
+		query += " ORDER BY time DESC, id DESC"
+	} else {
+		query += " ORDER BY time, id"
+	}
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := service.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []AuditEvent
+	for rows.Next() {
+		var (
+			event     AuditEvent
+			eventTime string
+			eventType string
+			userID    sql.NullString
+			email     sql.NullString
+			path      sql.NullString
+			ip        sql.NullString
+			userAgent sql.NullString
+			detail    sql.NullString
+		)
+		if err := rows.Scan(&eventTime, &eventType, &userID, &email, &path, &ip, &userAgent, &detail); err != nil {
+			return nil, err
+		}
+
+		if event.Time, err = time.Parse(timeFormat, eventTime); err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			if event.UserID, err = uuid.FromString(userID.String); err != nil {
+				return nil, err
+			}
+		}
+		event.Type = AuditEventType(eventType)
+		event.Email = email.String
+		event.Path = path.String
+		event.IP = ip.String
+		event.UserAgent = userAgent.String
+		event.Detail = detail.String
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
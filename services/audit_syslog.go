@@ -0,0 +1,43 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package services
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// SyslogAuditSink sends events as JSON to syslog.
+type SyslogAuditSink struct {
+	Writer *syslog.Writer
+}
+
+// NewSyslogAuditSink connects to the local syslog daemon.
+func NewSyslogAuditSink(tag string) (*SyslogAuditSink, error) {
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogAuditSink{Writer: writer}, nil
+}
+
+// Record sends the event with priority notice for failures and info otherwise.
+func (sink *SyslogAuditSink) Record(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case AuditSigninFailure, AuditAccessDenied:
+		return sink.Writer.Notice(string(line))
+	default:
+		return sink.Writer.Info(string(line))
+	}
+}
+
+// Close closes the connection to the syslog daemon.
+func (sink *SyslogAuditSink) Close() error {
+	return sink.Writer.Close()
+}
@@ -0,0 +1,143 @@
+package services_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestAuditService_Query(t *testing.T) {
+	var (
+		db           = db(t)
+		auditService = &services.AuditService{DB: db}
+		userID       = uuid.NewV4()
+		otherID      = uuid.NewV4()
+		now          = time.Now().UTC().Truncate(time.Second)
+	)
+
+	// record events
+	events := []services.AuditEvent{
+		{Time: now.Add(-3 * time.Hour), Type: services.AuditSigninFailure, Email: "me@example.com", IP: "10.0.0.1"},
+		{Time: now.Add(-2 * time.Hour), Type: services.AuditSigninSuccess, UserID: userID, Email: "me@example.com", UserAgent: "curl"},
+		{Time: now.Add(-1 * time.Hour), Type: services.AuditFileAccess, UserID: userID, Path: "/private/main.html"},
+		{Time: now, Type: services.AuditFileAccess, UserID: otherID, Path: "/private/images/deers.jpg"},
+	}
+	for _, event := range events {
+		if err := auditService.Record(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := map[string]func(t *testing.T){
+		"all": func(t *testing.T) {
+			result, err := auditService.Query(services.AuditFilter{})
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+			if len(result) != len(events) {
+				t.Fatalf("expected %d events but got %d\n", len(events), len(result))
+			}
+
+			// ensure fields are stored
+			if result[1] != events[1] {
+				t.Fatalf("expected event %+v but got %+v\n", events[1], result[1])
+			}
+		},
+		"by user id and email": func(t *testing.T) {
+			result, err := auditService.Query(services.AuditFilter{UserID: userID, Email: "me@example.com"})
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+			if len(result) != 3 {
+				t.Fatalf("expected 3 events but got %d\n", len(result))
+			}
+		},
+		"by path prefix": func(t *testing.T) {
+			result, err := auditService.Query(services.AuditFilter{PathPrefix: "/private/images/"})
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+			if len(result) != 1 || result[0].UserID != otherID {
+				t.Fatalf("expected the event of the other user but got %+v\n", result)
+			}
+		},
+		"by time range": func(t *testing.T) {
+			result, err := auditService.Query(services.AuditFilter{Since: now.Add(-2 * time.Hour), Until: now})
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+			if len(result) != 2 {
+				t.Fatalf("expected 2 events but got %d\n", len(result))
+			}
+			if result[0].Type != services.AuditSigninSuccess || result[1].Type != services.AuditFileAccess {
+				t.Fatalf("expected events ordered by time but got %+v\n", result)
+			}
+		},
+		"limit": func(t *testing.T) {
+			result, err := auditService.Query(services.AuditFilter{Limit: 1})
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+			if len(result) != 1 {
+				t.Fatalf("expected 1 event but got %d\n", len(result))
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestJSONAuditSink_Record(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		sink = &services.JSONAuditSink{W: &buf}
+	)
+
+	// record events
+	for _, typ := range []services.AuditEventType{services.AuditSignup, services.AuditSignout} {
+		if err := sink.Record(services.AuditEvent{Time: time.Now(), Type: typ, UserID: uuid.NewV4()}); err != nil {
+			t.Fatalf("expected no error but got %q", err)
+		}
+	}
+
+	// ensure one JSON object per line
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines but got %d: %s\n", len(lines), buf.String())
+	}
+	var event services.AuditEvent
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != services.AuditSignout {
+		t.Fatalf("expected type %q but got %q\n", services.AuditSignout, event.Type)
+	}
+}
+
+func TestAuditSinks_Close(t *testing.T) {
+	file, err := ioutil.TempFile("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	sinks := services.AuditSinks{&services.AuditService{DB: db(t)}, &services.JSONAuditSink{W: file}}
+
+	if err := sinks.Close(); err != nil {
+		t.Fatalf("expected no error but got %q\n", err)
+	}
+
+	// ensure the file is closed
+	if _, err := file.Write([]byte("{}\n")); err == nil {
+		t.Fatal("expected an error writing to the closed file but got none")
+	}
+}
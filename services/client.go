@@ -1,7 +1,11 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
 )
 
 // CreateTableUsers is the SQL statement to create the users table.
@@ -15,20 +19,103 @@ const CreateTableUsers = `CREATE TABLE IF NOT EXISTS users (
 	CONSTRAINT unique_email UNIQUE (email)
 )`
 
+// AddColumnUsersLastSigninAt is the SQL statement to add the time of the last signin to the users table.
+const AddColumnUsersLastSigninAt = `ALTER TABLE users ADD COLUMN last_signin_at TEXT`
+
+// timeFormat is the format of the time columns, the same as SQLite's DATETIME().
+const timeFormat = "2006-01-02 15:04:05"
+
+// migrations are the statements to bring the schema from version i to i+1.
+// Databases created before versioning have version 0, so the first ones must be idempotent.
+var migrations = []string{
+	CreateTableUsers,
+	CreateTableAuditEvents,
+	CreateTableSessions,
+	AddColumnUsersLastSigninAt,
+	CreateTableEmailChanges,
+	CreateIndexUsersEmailNocase,
+	CreateTableRegistrations,
+	AddColumnUsersName,
+	CreateTableUserGroups,
+	AddColumnUsersAdmin,
+	AddColumnUsersDisabledAt,
+	CreateTableAccessRules,
+	AddColumnAuditEventsDetail,
+}
+
+// migrationFuncs convert data in Go, in the same transaction right before the migration with the statement.
+var migrationFuncs = map[string]func(tx *sql.Tx) error{
+	CreateIndexUsersEmailNocase: normalizeStoredEmails,
+}
+
+// SchemaVersion is the schema version the code expects.
+var SchemaVersion = len(migrations)
+
 // DatabaseClient creates tables and handles the database connection. It only supports SQLite.
 type DatabaseClient struct {
 	DSN string // data source name e.g. db filename or ":memory:"
 }
 
-// Open creates the database and tables and returns the database connection.
+// Open creates the database, migrates the schema and returns the database connection.
+// The duration of the statements is measured for the metrics.
 func (client *DatabaseClient) Open() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", client.DSN)
-	if err != nil {
-		return nil, err
-	}
+	db := sql.OpenDB(&instrumentedConnector{driver: &sqlite3.SQLiteDriver{}, dsn: client.DSN})
 
-	if _, err := db.Exec(CreateTableUsers); err != nil {
+	if err := migrate(db); err != nil {
 		return nil, err
 	}
 	return db, nil
 }
+
+// migrate runs the migrations the database hasn't seen yet, each in a transaction with the version update.
+func migrate(db *sql.DB) error {
+	version, err := CurrentSchemaVersion(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if convert, ok := migrationFuncs[migrations[i]]; ok {
+			if err := convert(tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migrating schema to version %d: %s", i+1, err)
+			}
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrating schema to version %d: %s", i+1, err)
+		}
+		// PRAGMA doesn't support parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CurrentSchemaVersion returns the schema version of the database.
+func CurrentSchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// CheckSchema returns an error if the database's schema version isn't SchemaVersion.
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	version, err := CurrentSchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if version != SchemaVersion {
+		return fmt.Errorf("schema version is %d but expected %d", version, SchemaVersion)
+	}
+	return nil
+}
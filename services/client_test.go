@@ -0,0 +1,88 @@
+package services_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestDatabaseClient_Open(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"current schema": func(t *testing.T) {
+			db := db(t)
+
+			// ensure the schema version is current
+			version, err := services.CurrentSchemaVersion(context.Background(), db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != services.SchemaVersion {
+				t.Fatalf("expected schema version %d but got %d\n", services.SchemaVersion, version)
+			}
+			if err := services.CheckSchema(context.Background(), db); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+		},
+		"reopen": func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "auth-static")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			client := &services.DatabaseClient{DSN: filepath.Join(dir, "test.db")}
+
+			// open twice
+			for i := 0; i < 2; i++ {
+				db, err := client.Open()
+				if err != nil {
+					t.Fatalf("expected no error but got %q\n", err)
+				}
+				if err := services.CheckSchema(context.Background(), db); err != nil {
+					t.Fatalf("expected no error but got %q\n", err)
+				}
+				db.Close()
+			}
+		},
+		"canceled query": func(t *testing.T) {
+			db := db(t)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			// ensure the context interrupts a long running query
+			var (
+				count int
+				start = time.Now()
+			)
+			err := db.QueryRowContext(ctx, `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 100000000)
+				SELECT count(*) FROM c`).Scan(&count)
+			if err == nil {
+				t.Fatalf("expected an error but got count %d\n", count)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("expected the query to be interrupted but it took %s\n", elapsed)
+			}
+		},
+		"outdated schema": func(t *testing.T) {
+			db := db(t)
+			db.SetMaxOpenConns(1) // keep the in-memory database
+
+			if _, err := db.Exec("PRAGMA user_version = 0"); err != nil {
+				t.Fatal(err)
+			}
+
+			// ensure the check fails
+			if err := services.CheckSchema(context.Background(), db); err == nil {
+				t.Fatal("expected an error but got none")
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/net/idna"
+)
+
+// CreateIndexUsersEmailNocase is the SQL statement adding a case-insensitive unique index on the email.
+// Before, normalizeStoredEmails normalizes the domain of the stored emails. It fails if emails only differ
+// in case or in the form of the domain, DuplicateEmails lists them.
+const CreateIndexUsersEmailNocase = `CREATE UNIQUE INDEX users_email_nocase ON users (email COLLATE NOCASE)`
+
+// normalizeStoredEmails normalizes the domain of the stored emails like NormalizeEmail
+// which SQLite can't do, e.g. "Me@Bücher.example" to "Me@xn--bcher-kva.example".
+func normalizeStoredEmails(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, email FROM users")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	changed := map[string]string{}
+	for rows.Next() {
+		var id, email string
+		if err := rows.Scan(&id, &email); err != nil {
+			return err
+		}
+		if normalized := NormalizeEmail(email, false); normalized != email {
+			changed[id] = normalized
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, email := range changed {
+		if _, err := tx.Exec("UPDATE users SET email = ? WHERE id = ?", email, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NormalizeEmail trims the email, lowercases its domain and converts an internationalized domain
+// to its ASCII form, e.g. "Me@Bücher.example" to "Me@xn--bcher-kva.example".
+// With lowercase the local part is lowercased as well although it's case-sensitive by the standard.
+func NormalizeEmail(email string, lowercase bool) string {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		if lowercase {
+			return strings.ToLower(email)
+		}
+		return email
+	}
+
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+	if lowercase {
+		local = strings.ToLower(local)
+	}
+	if ascii, err := idna.Lookup.ToASCII(domain); err == nil {
+		domain = ascii
+	}
+	return local + "@" + domain
+}
+
+// normalizeEmail normalizes the email with the service's LowercaseEmails setting.
+func (service *UserService) normalizeEmail(email string) string {
+	return NormalizeEmail(email, service.LowercaseEmails)
+}
+
+// DuplicateUser is a user whose email equals another user's after normalization.
+type DuplicateUser struct {
+	ID        uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	Active    bool // has set a password
+}
+
+// DuplicateEmails returns the groups of users whose emails are equal after trimming, lowercasing
+// and converting the domain, sorted by the normalized email and within a group by creation.
+// They have to be merged or deleted before CreateIndexUsersEmailNocase can be applied.
+// Only the users table is read, so it also works for databases whose migration failed.
+func (service *UserService) DuplicateEmails() ([][]DuplicateUser, error) {
+	rows, err := service.DB.Query("SELECT id, email, created_at, hash FROM users ORDER BY created_at, email")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := map[string][]DuplicateUser{}
+	for rows.Next() {
+		var (
+			user      DuplicateUser
+			id        string
+			createdAt string
+			hash      sql.NullString
+		)
+		if err := rows.Scan(&id, &user.Email, &createdAt, &hash); err != nil {
+			return nil, err
+		}
+		if user.ID, err = uuid.FromString(id); err != nil {
+			return nil, err
+		}
+		if user.CreatedAt, err = time.Parse(timeFormat, createdAt); err != nil {
+			return nil, err
+		}
+		user.Active = hash.String != ""
+
+		key := NormalizeEmail(user.Email, true)
+		groups[key] = append(groups[key], user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key, users := range groups {
+		if len(users) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var duplicates [][]DuplicateUser
+	for _, key := range keys {
+		duplicates = append(duplicates, groups[key])
+	}
+	return duplicates, nil
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// CreateTableEmailChanges is the SQL statement to create the email_changes table.
+const CreateTableEmailChanges = `CREATE TABLE IF NOT EXISTS email_changes (
+	code				TEXT NOT NULL PRIMARY KEY,
+	user_id			TEXT NOT NULL,
+	new_email		TEXT NOT NULL,
+	created_at	TEXT NOT NULL,
+	CONSTRAINT unique_user_id UNIQUE (user_id)
+)`
+
+// EmailChangeMaxAge is how long the verification link of an email change is valid.
+const EmailChangeMaxAge = 24 * time.Hour
+
+const (
+	// ErrEmailUnchanged is returned when the new email is the current one.
+	ErrEmailUnchanged = Error("email unchanged")
+	// ErrEmailTaken is returned when another user has the new email.
+	ErrEmailTaken = Error("email already taken")
+)
+
+// EmailChange is a confirmed change of a user's email.
+type EmailChange struct {
+	UserID   uuid.UUID
+	OldEmail string
+	NewEmail string
+}
+
+// RequestEmailChange stores the user's new email and returns a code for the verification link
+// sent to it. A previous request of the user is replaced.
+func (service *UserService) RequestEmailChange(id uuid.UUID, newEmail string) (string, error) {
+	newEmail = service.normalizeEmail(newEmail)
+	if err := service.EmailPolicy().Check(newEmail); err != nil {
+		return "", err
+	}
+
+	// compare with current email
+	email, err := service.GetEmailByID(id)
+	if err != nil {
+		return "", err
+	}
+	if strings.EqualFold(newEmail, email) {
+		return "", ErrEmailUnchanged
+	}
+	if err := ensureEmailFree(service.DB, newEmail); err != nil {
+		return "", err
+	}
+
+	// generate new code
+	code, err := generateCode()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = service.DB.Exec("INSERT INTO email_changes (code, user_id, new_email, created_at) VALUES (?, ?, ?, DATETIME('now')) "+
+		"ON CONFLICT(user_id) DO UPDATE SET code = ?, new_email = ?, created_at = DATETIME('now')", code, id, newEmail, code, newEmail)
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// PendingEmailChange returns the new email of the code's request. It returns ErrUnknownCode
+// if there's no such request or it's older than EmailChangeMaxAge.
+func (service *UserService) PendingEmailChange(code string) (string, error) {
+	var newEmail string
+	err := service.DB.QueryRow("SELECT new_email FROM email_changes WHERE code = ? AND created_at >= ?",
+		code, emailChangeCutoff()).Scan(&newEmail)
+	if err == sql.ErrNoRows {
+		return "", ErrUnknownCode
+	}
+	return newEmail, err
+}
+
+// ConfirmEmailChange sets the new email of the code's request and deletes the request.
+// It returns ErrUnknownCode if there's no such request or it's older than EmailChangeMaxAge,
+// and ErrEmailTaken if another user got the email in the meantime.
+func (service *UserService) ConfirmEmailChange(code string) (*EmailChange, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// get request
+	var (
+		change EmailChange
+		userID string
+	)
+	err = tx.QueryRow("SELECT c.user_id, u.email, c.new_email FROM email_changes c JOIN users u ON u.id = c.user_id "+
+		"WHERE c.code = ? AND c.created_at >= ?", code, emailChangeCutoff()).Scan(&userID, &change.OldEmail, &change.NewEmail)
+	if err == sql.ErrNoRows {
+		return nil, ErrUnknownCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	if change.UserID, err = uuid.FromString(userID); err != nil {
+		return nil, err
+	}
+
+	// update user
+	if err := ensureEmailFree(tx, change.NewEmail); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE users SET email = ?, updated_at = DATETIME('now') WHERE id = ?", change.NewEmail, change.UserID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM email_changes WHERE user_id = ?", change.UserID); err != nil {
+		return nil, err
+	}
+	return &change, tx.Commit()
+}
+
+// queryRower is implemented by *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// ensureEmailFree returns ErrEmailTaken if a user has the email.
+func ensureEmailFree(db queryRower, email string) error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(id) FROM users WHERE email = ? COLLATE NOCASE", email).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// emailChangeCutoff returns the created_at before which email change requests are expired.
+func emailChangeCutoff() string {
+	return time.Now().UTC().Add(-EmailChangeMaxAge).Format(timeFormat)
+}
@@ -0,0 +1,126 @@
+package services_test
+
+import (
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestUserService_EmailChange(t *testing.T) {
+	// setup creates a user.
+	setup := func(t *testing.T) (*services.UserService, uuid.UUID) {
+		userService := &services.UserService{DB: db(t)}
+		code, err := userService.Create("old@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := userService.GetIDByCode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return userService, id
+	}
+
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			userService, id := setup(t)
+
+			code, err := userService.RequestEmailChange(id, " new@example.com ")
+			if err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+
+			// email isn't changed before the confirmation
+			if email, err := userService.GetEmailByID(id); err != nil || email != "old@example.com" {
+				t.Fatalf("expected email %q but got %q, %v\n", "old@example.com", email, err)
+			}
+			if newEmail, err := userService.PendingEmailChange(code); err != nil || newEmail != "new@example.com" {
+				t.Fatalf("expected pending email %q but got %q, %v\n", "new@example.com", newEmail, err)
+			}
+
+			change, err := userService.ConfirmEmailChange(code)
+			if err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			expected := services.EmailChange{UserID: id, OldEmail: "old@example.com", NewEmail: "new@example.com"}
+			if *change != expected {
+				t.Fatalf("expected %+v but got %+v\n", expected, *change)
+			}
+			if email, err := userService.GetEmailByID(id); err != nil || email != "new@example.com" {
+				t.Fatalf("expected email %q but got %q, %v\n", "new@example.com", email, err)
+			}
+
+			// code can't be used twice
+			if _, err := userService.ConfirmEmailChange(code); err != services.ErrUnknownCode {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUnknownCode, err)
+			}
+		},
+		"new request replaces old one": func(t *testing.T) {
+			userService, id := setup(t)
+
+			first, err := userService.RequestEmailChange(id, "first@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := userService.RequestEmailChange(id, "second@example.com"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := userService.ConfirmEmailChange(first); err != services.ErrUnknownCode {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUnknownCode, err)
+			}
+		},
+		"expired": func(t *testing.T) {
+			userService, id := setup(t)
+
+			code, err := userService.RequestEmailChange(id, "new@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := userService.DB.Exec("UPDATE email_changes SET created_at = DATETIME('now', '-25 hours')"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := userService.ConfirmEmailChange(code); err != services.ErrUnknownCode {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUnknownCode, err)
+			}
+		},
+		"errors": func(t *testing.T) {
+			userService, id := setup(t)
+			if _, err := userService.Create("other@example.com"); err != nil {
+				t.Fatal(err)
+			}
+
+			for email, expected := range map[string]error{
+				"":                  services.ErrEmailRequired,
+				"old@example.com":   services.ErrEmailUnchanged,
+				"other@example.com": services.ErrEmailTaken,
+			} {
+				if _, err := userService.RequestEmailChange(id, email); err != expected {
+					t.Fatalf("expected error %q for %q but got %v\n", expected, email, err)
+				}
+			}
+		},
+		"taken in the meantime": func(t *testing.T) {
+			userService, id := setup(t)
+
+			code, err := userService.RequestEmailChange(id, "new@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := userService.Create("new@example.com"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := userService.ConfirmEmailChange(code); err != services.ErrEmailTaken {
+				t.Fatalf("expected error %q but got %v\n", services.ErrEmailTaken, err)
+			}
+			if email, err := userService.GetEmailByID(id); err != nil || email != "old@example.com" {
+				t.Fatalf("expected email %q but got %q, %v\n", "old@example.com", email, err)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	// ErrEmailInvalid is returned when the email isn't a valid RFC 5322 address like "me@example.com".
+	ErrEmailInvalid = Error("email invalid")
+	// ErrEmailDomainNotAllowed is returned when EmailPolicy.AllowedDomains is set and doesn't contain the email's domain.
+	ErrEmailDomainNotAllowed = Error("email domain not allowed")
+	// ErrEmailDomainDenied is returned when EmailPolicy.DeniedDomains contains the email's domain.
+	ErrEmailDomainDenied = Error("email domain denied")
+)
+
+// EmailPolicy holds the rules for the emails of new users and email changes.
+// The domains are matched with their subdomains, e.g. "example.com" matches "mail.example.com".
+// No DNS lookups are made.
+type EmailPolicy struct {
+	AllowedDomains []string // any domain if empty
+	DeniedDomains  []string // take precedence over AllowedDomains
+}
+
+// DefaultEmailPolicy is used by UserService if it doesn't have a policy. It only checks the syntax.
+var DefaultEmailPolicy = &EmailPolicy{}
+
+// Check returns the first rule the normalized email breaks or nil.
+func (policy *EmailPolicy) Check(email string) error {
+	if email == "" {
+		return ErrEmailRequired
+	}
+
+	// addr-spec only, without display name, comments or angle brackets
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.String() != "<"+email+">" {
+		return ErrEmailInvalid
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if strings.HasPrefix(domain, "[") {
+		// domain literals like [192.0.2.1] aren't used for real users
+		return ErrEmailInvalid
+	}
+
+	if matchDomain(domain, policy.DeniedDomains) {
+		return ErrEmailDomainDenied
+	}
+	if len(policy.AllowedDomains) > 0 && !matchDomain(domain, policy.AllowedDomains) {
+		return ErrEmailDomainNotAllowed
+	}
+	return nil
+}
+
+// matchDomain checks if the domain is one of the list or a subdomain of one.
+func matchDomain(domain string, list []string) bool {
+	for _, entry := range list {
+		entry = strings.Trim(strings.ToLower(strings.TrimSpace(entry)), ".")
+		if ascii, err := idna.Lookup.ToASCII(entry); err == nil {
+			entry = ascii
+		}
+		if entry != "" && (domain == entry || strings.HasSuffix(domain, "."+entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// EmailPolicy returns the policy for the emails of new users and email changes.
+func (service *UserService) EmailPolicy() *EmailPolicy {
+	if service.Emails == nil {
+		return DefaultEmailPolicy
+	}
+	return service.Emails
+}
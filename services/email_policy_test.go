@@ -0,0 +1,75 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestEmailPolicy_Check(t *testing.T) {
+	policy := &services.EmailPolicy{
+		AllowedDomains: []string{"example.com", " Bücher.example "},
+		DeniedDomains:  []string{"spam.example.com"},
+	}
+
+	cases := map[string]error{
+		"me@example.com":                  nil,
+		"me@mail.example.com":             nil,
+		"first.last+tag@example.com":      nil,
+		"\"quoted local\"@example.com":    nil,
+		"me@xn--bcher-kva.example":        nil,
+		"":                                services.ErrEmailRequired,
+		"no-at-sign":                      services.ErrEmailInvalid,
+		"me@":                             services.ErrEmailInvalid,
+		"@example.com":                    services.ErrEmailInvalid,
+		"two@at@example.com":              services.ErrEmailInvalid,
+		"me@example..com":                 services.ErrEmailInvalid,
+		"Me <me@example.com>":             services.ErrEmailInvalid,
+		"<me@example.com>":                services.ErrEmailInvalid,
+		"me@[192.0.2.1]":                  services.ErrEmailInvalid,
+		"me@notexample.com":               services.ErrEmailDomainNotAllowed,
+		"me@example.org":                  services.ErrEmailDomainNotAllowed,
+		"me@spam.example.com":             services.ErrEmailDomainDenied,
+		"me@bulk.spam.example.com":        services.ErrEmailDomainDenied,
+		"me@xn--bcher-kva.example.spam":   services.ErrEmailDomainNotAllowed,
+		"me@example.com.attacker.invalid": services.ErrEmailDomainNotAllowed,
+	}
+
+	for email, expected := range cases {
+		if err := policy.Check(email); err != expected {
+			t.Fatalf("expected %v for %q but got %v\n", expected, email, err)
+		}
+	}
+
+	// ensure the default policy only checks the syntax
+	if err := services.DefaultEmailPolicy.Check("me@example.org"); err != nil {
+		t.Fatalf("expected no error but got %q\n", err)
+	}
+}
+
+func TestUserService_EmailPolicy(t *testing.T) {
+	userService := &services.UserService{
+		DB:     db(t),
+		Emails: &services.EmailPolicy{DeniedDomains: []string{"example.org"}},
+	}
+
+	// ensure Create checks the normalized email
+	for email, expected := range map[string]error{
+		" Me@Example.COM ": nil,
+		"me@EXAMPLE.org":   services.ErrEmailDomainDenied,
+		"me":               services.ErrEmailInvalid,
+	} {
+		if _, err := userService.Create(email); err != expected {
+			t.Fatalf("expected %v for %q but got %v\n", expected, email, err)
+		}
+	}
+
+	// ensure email changes are checked as well
+	id, err := userService.GetIDByEmail("me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := userService.RequestEmailChange(id, "me@example.org"); err != services.ErrEmailDomainDenied {
+		t.Fatalf("expected error %q but got %v\n", services.ErrEmailDomainDenied, err)
+	}
+}
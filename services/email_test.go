@@ -0,0 +1,159 @@
+package services_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	cases := []struct {
+		email     string
+		lowercase bool
+		expected  string
+	}{
+		{" Me@Example.COM ", false, "Me@example.com"},
+		{" Me@Example.COM ", true, "me@example.com"},
+		{"me@bücher.example", false, "me@xn--bcher-kva.example"},
+		{"me@MÜNCHEN.de", false, "me@xn--mnchen-3ya.de"},
+		{"me@例え.テスト", false, "me@xn--r8jz45g.xn--zckzah"},
+		{"\"a@b\"@example.com", false, "\"a@b\"@example.com"},
+		{"no-at-sign", false, "no-at-sign"},
+		{"", false, ""},
+	}
+
+	for _, c := range cases {
+		if normalized := services.NormalizeEmail(c.email, c.lowercase); normalized != c.expected {
+			t.Fatalf("expected %q to be normalized to %q but got %q\n", c.email, c.expected, normalized)
+		}
+	}
+}
+
+func TestUserService_CaseInsensitiveEmail(t *testing.T) {
+	var (
+		db          = db(t)
+		userService = &services.UserService{DB: db}
+		password    = strings.Repeat("x", services.PasswordMinLen)
+	)
+
+	// create user
+	code, err := userService.Create(" Me@Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := userService.GetIDByCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := userService.UpdatePassword(id, password, password); err != nil {
+		t.Fatal(err)
+	}
+	if email, err := userService.GetEmailByID(id); err != nil || email != "Me@example.com" {
+		t.Fatalf("expected email %q but got %q, %v\n", "Me@example.com", email, err)
+	}
+
+	// ensure lookups ignore case
+	if found, err := userService.GetIDByEmail("me@EXAMPLE.com"); err != nil || found != id {
+		t.Fatalf("expected user %s but got %s, %v\n", id, found, err)
+	}
+	if ok, err := userService.Authenticate("ME@example.com", password); err != nil || !ok {
+		t.Fatalf("expected user to be authenticated but got %t, %v\n", ok, err)
+	}
+
+	// ensure creating the email in another case finds the user
+	if _, err := userService.Create("me@example.com"); err != services.ErrUserExists {
+		t.Fatalf("expected error %q but got %v\n", services.ErrUserExists, err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(id) FROM users").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 user but got %d\n", count)
+	}
+}
+
+func TestUserService_DuplicateEmails(t *testing.T) {
+	// the database's schema version is before the case-insensitive index
+	dir, err := ioutil.TempDir("", "auth-static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dsn := filepath.Join(dir, "test.db")
+	raw, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	statements := []string{
+		services.CreateTableUsers,
+		"INSERT INTO users (id, email, hash, created_at) VALUES " +
+			"('6ba7b810-9dad-11d1-80b4-00c04fd430c8', 'Me@EXAMPLE.com', 'hash', '2018-01-01 00:00:00'), " +
+			"('6ba7b811-9dad-11d1-80b4-00c04fd430c8', 'me@example.com', '', '2018-01-02 00:00:00'), " +
+			"('6ba7b812-9dad-11d1-80b4-00c04fd430c8', 'you@example.com', '', '2018-01-03 00:00:00'), " +
+			"('6ba7b813-9dad-11d1-80b4-00c04fd430c8', 'me@Bücher.example', '', '2018-01-04 00:00:00')",
+	}
+	for _, statement := range statements {
+		if _, err := raw.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// ensure the migration fails
+	client := &services.DatabaseClient{DSN: dsn}
+	if _, err := client.Open(); err == nil {
+		t.Fatal("expected an error but got none")
+	}
+
+	// ensure the duplicates are found
+	userService := &services.UserService{DB: raw}
+	groups, err := userService.DuplicateEmails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0]) != 2 {
+		t.Fatalf("expected 1 group of 2 users but got %+v\n", groups)
+	}
+	if groups[0][0].Email != "Me@EXAMPLE.com" || !groups[0][0].Active || groups[0][1].Active {
+		t.Fatalf("expected the active user first but got %+v\n", groups[0])
+	}
+
+	// ensure the migration normalizes the domains once the duplicate is deleted
+	if _, err := raw.Exec("DELETE FROM users WHERE id = '6ba7b811-9dad-11d1-80b4-00c04fd430c8'"); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.Open()
+	if err != nil {
+		t.Fatalf("expected no error but got %q\n", err)
+	}
+	defer db.Close()
+	var email string
+	if err := db.QueryRow("SELECT email FROM users WHERE id = '6ba7b810-9dad-11d1-80b4-00c04fd430c8'").Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+	if email != "Me@example.com" {
+		t.Fatalf("expected email %q but got %q\n", "Me@example.com", email)
+	}
+
+	// ensure users with internationalized domains are found
+	userService = &services.UserService{DB: db}
+	if id, err := userService.GetIDByEmail("me@bücher.example"); err != nil || id.String() != "6ba7b813-9dad-11d1-80b4-00c04fd430c8" {
+		t.Fatalf("expected user %s but got %s, %v\n", "6ba7b813-9dad-11d1-80b4-00c04fd430c8", id, err)
+	}
+	if _, err := userService.Create("me@BÜCHER.example"); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(id) FROM users").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("expected 3 users but got %d\n", count)
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"database/sql"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// AddColumnUsersName is the SQL statement to add the user's display name to the users table.
+const AddColumnUsersName = `ALTER TABLE users ADD COLUMN name TEXT NOT NULL DEFAULT ''`
+
+// CreateTableUserGroups is the SQL statement to create the user_groups table.
+const CreateTableUserGroups = `CREATE TABLE IF NOT EXISTS user_groups (
+	user_id		TEXT NOT NULL,
+	name			TEXT NOT NULL,
+	PRIMARY KEY (user_id, name)
+)`
+
+// NameMaxLen is the maximum length of a user's name in characters.
+const NameMaxLen = 200
+
+const (
+	// ErrNameTooLong is returned when the user's name is longer than NameMaxLen.
+	ErrNameTooLong = Error("name too long")
+	// ErrGroupInvalid is returned when a group name isn't made of letters, digits, ".", "_" and "-".
+	ErrGroupInvalid = Error("group name invalid")
+)
+
+// groupPattern is the syntax of group names.
+var groupPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// checkName trims the user's name and checks its length.
+func checkName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > NameMaxLen {
+		return "", ErrNameTooLong
+	}
+	return name, nil
+}
+
+// checkGroups returns the sorted group names without duplicates or ErrGroupInvalid.
+func checkGroups(groups []string) ([]string, error) {
+	seen := map[string]bool{}
+	var checked []string
+	for _, group := range groups {
+		group = strings.TrimSpace(group)
+		if !groupPattern.MatchString(group) {
+			return nil, ErrGroupInvalid
+		}
+		if !seen[group] {
+			seen[group] = true
+			checked = append(checked, group)
+		}
+	}
+	sort.Strings(checked)
+	return checked, nil
+}
+
+// Groups returns the names of the user's groups, sorted.
+func (service *UserService) Groups(id uuid.UUID) ([]string, error) {
+	rows, err := service.DB.Query("SELECT name FROM user_groups WHERE user_id = ? ORDER BY name", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []string
+	for rows.Next() {
+		var group string
+		if err := rows.Scan(&group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// SetGroups replaces the user's groups. It returns ErrGroupInvalid if a name is invalid.
+func (service *UserService) SetGroups(id uuid.UUID, groups []string) error {
+	groups, err := checkGroups(groups)
+	if err != nil {
+		return err
+	}
+
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := setGroups(tx, id, groups); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setGroups replaces the user's groups with the checked ones.
+func setGroups(db execer, id uuid.UUID, groups []string) error {
+	if _, err := db.Exec("DELETE FROM user_groups WHERE user_id = ?", id); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if _, err := db.Exec("INSERT INTO user_groups (user_id, name) VALUES (?, ?)", id, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PasswordHasher hashes new passwords.
+// Hashes are encoded in the PHC string format, bcrypt in its own modular crypt format,
+// so they carry the algorithm and parameters for verifying them later.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of the password.
+	Hash(password string) (string, error)
+	// NeedsRehash checks if the encoded hash was made with another algorithm or other parameters.
+	NeedsRehash(encoded string) bool
+}
+
+// DefaultPasswordHasher is used by UserService if it doesn't have a hasher.
+var DefaultPasswordHasher PasswordHasher = &BcryptHasher{Cost: bcrypt.DefaultCost}
+
+// saltLen is the length of the salts of argon2id and scrypt in bytes.
+const saltLen = 16
+
+// b64 encodes salts and keys of PHC strings.
+var b64 = base64.RawStdEncoding
+
+// BcryptHasher hashes with bcrypt.
+type BcryptHasher struct {
+	Cost int
+}
+
+// Hash returns a bcrypt hash like "$2a$10$...".
+func (hasher *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), hasher.Cost)
+	return string(hash), err
+}
+
+// NeedsRehash checks if the hash isn't bcrypt or has another cost.
+func (hasher *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != hasher.Cost
+}
+
+// Argon2idHasher hashes with argon2id.
+type Argon2idHasher struct {
+	Time    uint32 // iterations
+	Memory  uint32 // in KiB
+	Threads uint8
+	KeyLen  uint32
+}
+
+// Hash returns an argon2id hash like "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>".
+func (hasher *Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, hasher.Time, hasher.Memory, hasher.Threads, hasher.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, hasher.Memory, hasher.Time, hasher.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// NeedsRehash checks if the hash isn't argon2id or has other parameters.
+func (hasher *Argon2idHasher) NeedsRehash(encoded string) bool {
+	var (
+		version, memory, time uint32
+		threads               uint8
+	)
+	params, _, key, err := parsePHC(encoded, "argon2id")
+	if err == nil {
+		_, err = fmt.Sscanf(params, "v=%d$m=%d,t=%d,p=%d", &version, &memory, &time, &threads)
+	}
+	return err != nil || version != argon2.Version || memory != hasher.Memory || time != hasher.Time ||
+		threads != hasher.Threads || uint32(len(key)) != hasher.KeyLen
+}
+
+// ScryptHasher hashes with scrypt.
+type ScryptHasher struct {
+	LogN   uint8 // CPU/memory cost N as power of 2
+	R      int   // block size
+	P      int   // parallelization
+	KeyLen int
+}
+
+// Hash returns a scrypt hash like "$scrypt$ln=15,r=8,p=1$<salt>$<key>".
+func (hasher *ScryptHasher) Hash(password string) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<hasher.LogN, hasher.R, hasher.P, hasher.KeyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		hasher.LogN, hasher.R, hasher.P, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// NeedsRehash checks if the hash isn't scrypt or has other parameters.
+func (hasher *ScryptHasher) NeedsRehash(encoded string) bool {
+	var (
+		logN uint8
+		r, p int
+	)
+	params, _, key, err := parsePHC(encoded, "scrypt")
+	if err == nil {
+		_, err = fmt.Sscanf(params, "ln=%d,r=%d,p=%d", &logN, &r, &p)
+	}
+	return err != nil || logN != hasher.LogN || r != hasher.R || p != hasher.P || len(key) != hasher.KeyLen
+}
+
+// verifyPassword checks the password against an encoded hash of any of the supported algorithms.
+func verifyPassword(encoded, password string) (bool, error) {
+	start := time.Now()
+	defer observeSince(passwordHashDuration, start, "compare")
+
+	switch {
+	case strings.HasPrefix(encoded, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		var (
+			version, memory, time uint32
+			threads               uint8
+		)
+		params, salt, key, err := parsePHC(encoded, "argon2id")
+		if err != nil {
+			return false, err
+		}
+		if _, err := fmt.Sscanf(params, "v=%d$m=%d,t=%d,p=%d", &version, &memory, &time, &threads); err != nil {
+			return false, fmt.Errorf("invalid argon2id parameters %q", params)
+		}
+		if version != argon2.Version {
+			return false, fmt.Errorf("unsupported argon2 version %d", version)
+		}
+		actual := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(actual, key) == 1, nil
+
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		var (
+			logN uint8
+			r, p int
+		)
+		params, salt, key, err := parsePHC(encoded, "scrypt")
+		if err != nil {
+			return false, err
+		}
+		if _, err := fmt.Sscanf(params, "ln=%d,r=%d,p=%d", &logN, &r, &p); err != nil {
+			return false, fmt.Errorf("invalid scrypt parameters %q", params)
+		}
+		actual, err := scrypt.Key([]byte(password), salt, 1<<logN, r, p, len(key))
+		if err != nil {
+			return false, err
+		}
+		return subtle.ConstantTimeCompare(actual, key) == 1, nil
+	}
+	return false, fmt.Errorf("unknown password hash format")
+}
+
+// parsePHC splits "$<id>$<params>$<salt>$<key>" into the params, which may contain "$" like argon2's version,
+// and the decoded salt and key.
+func parsePHC(encoded, id string) (string, []byte, []byte, error) {
+	prefix := "$" + id + "$"
+	if !strings.HasPrefix(encoded, prefix) {
+		return "", nil, nil, fmt.Errorf("not a %s hash", id)
+	}
+	parts := strings.Split(encoded[len(prefix):], "$")
+	if len(parts) < 3 {
+		return "", nil, nil, fmt.Errorf("invalid %s hash", id)
+	}
+	salt, err := b64.DecodeString(parts[len(parts)-2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid %s salt: %s", id, err)
+	}
+	key, err := b64.DecodeString(parts[len(parts)-1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid %s key: %s", id, err)
+	}
+	return strings.Join(parts[:len(parts)-2], "$"), salt, key, nil
+}
+
+// newSalt returns random bytes for a salt.
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltLen)
+	_, err := rand.Read(salt)
+	return salt, err
+}
@@ -0,0 +1,106 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+// cheap hashers for the tests
+var (
+	bcryptHasher   = &services.BcryptHasher{Cost: bcrypt.MinCost}
+	argon2idHasher = &services.Argon2idHasher{Time: 1, Memory: 64, Threads: 1, KeyLen: 32}
+	scryptHasher   = &services.ScryptHasher{LogN: 4, R: 8, P: 1, KeyLen: 32}
+)
+
+func TestPasswordHasher(t *testing.T) {
+	cases := map[string]struct {
+		hasher services.PasswordHasher
+		prefix string
+		other  services.PasswordHasher // same algorithm, other parameters
+	}{
+		"bcrypt":   {bcryptHasher, "$2a$04$", &services.BcryptHasher{Cost: 5}},
+		"argon2id": {argon2idHasher, "$argon2id$v=19$m=64,t=1,p=1$", &services.Argon2idHasher{Time: 2, Memory: 64, Threads: 1, KeyLen: 32}},
+		"scrypt":   {scryptHasher, "$scrypt$ln=4,r=8,p=1$", &services.ScryptHasher{LogN: 5, R: 8, P: 1, KeyLen: 32}},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			hash, err := c.hasher.Hash("secret password")
+			if err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+
+			// ensure the format
+			if !strings.HasPrefix(hash, c.prefix) {
+				t.Fatalf("expected hash to start with %q but got %q\n", c.prefix, hash)
+			}
+
+			// ensure rehash is only needed for other parameters and algorithms
+			if c.hasher.NeedsRehash(hash) {
+				t.Fatal("expected no rehash with the same parameters")
+			}
+			if !c.other.NeedsRehash(hash) {
+				t.Fatal("expected rehash with other parameters")
+			}
+			for m, other := range cases {
+				if m != n && !other.hasher.NeedsRehash(hash) {
+					t.Fatalf("expected rehash with %s\n", m)
+				}
+			}
+		})
+	}
+}
+
+func TestUserService_Authenticate_Hashers(t *testing.T) {
+	for _, from := range []services.PasswordHasher{bcryptHasher, argon2idHasher, scryptHasher} {
+		for _, to := range []services.PasswordHasher{bcryptHasher, argon2idHasher, scryptHasher} {
+			var (
+				db          = db(t)
+				userService = &services.UserService{DB: db, Hasher: from}
+				email       = "me@example.com"
+				password    = strings.Repeat("x", services.PasswordMinLen)
+			)
+
+			// create user with the first hasher
+			code, err := userService.Create(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := userService.GetIDByCode(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := userService.UpdatePassword(id, password, password); err != nil {
+				t.Fatal(err)
+			}
+
+			// ensure a wrong password fails
+			userService.Hasher = to
+			if ok, err := userService.Authenticate(email, "wrong password"); ok || err != nil {
+				t.Fatalf("expected wrong password to fail without error but got %v, %v\n", ok, err)
+			}
+
+			// authenticate with the second hasher
+			if ok, err := userService.Authenticate(email, password); !ok || err != nil {
+				t.Fatalf("expected authentication to succeed but got %v, %v\n", ok, err)
+			}
+
+			// ensure the hash has been upgraded and still works
+			var hash string
+			if err := db.QueryRow("SELECT hash FROM users WHERE id = ?", id).Scan(&hash); err != nil {
+				t.Fatal(err)
+			}
+			if to.NeedsRehash(hash) {
+				t.Fatalf("expected hash to be upgraded but got %q\n", hash)
+			}
+			if ok, err := userService.Authenticate(email, password); !ok || err != nil {
+				t.Fatalf("expected authentication with upgraded hash to succeed but got %v, %v\n", ok, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"database/sql"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ImportUser is a row of a user import.
+type ImportUser struct {
+	Row    int // row in the import file for the report
+	Email  string
+	Name   string
+	Groups []string
+}
+
+// ImportResult is the outcome of a row of a user import.
+type ImportResult struct {
+	Row   int
+	Email string // normalized
+	Code  string // for the signup URL, empty if the row failed
+	Err   error  // a services.Error like ErrEmailInvalid or ErrEmailTaken
+}
+
+// Import creates the users with their names and groups in one transaction and returns a result for each row.
+// Rows are rejected if the email breaks the email policy or belongs to an existing user or an earlier row.
+// Nothing is stored if a row is rejected or dryRun is set. Only unexpected errors are returned as error.
+func (service *UserService) Import(users []ImportUser, dryRun bool) ([]ImportResult, error) {
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		results = make([]ImportResult, 0, len(users))
+		failed  bool
+	)
+	for _, user := range users {
+		result := ImportResult{Row: user.Row, Email: service.normalizeEmail(user.Email)}
+		result.Code, result.Err = service.importUser(tx, result.Email, user.Name, user.Groups)
+		if result.Err != nil {
+			if _, ok := result.Err.(Error); !ok {
+				return nil, result.Err
+			}
+			failed = true
+		}
+		results = append(results, result)
+	}
+
+	if failed || dryRun {
+		return results, nil
+	}
+	return results, tx.Commit()
+}
+
+// importUser creates the user within the transaction and returns the code for the signup URL.
+func (service *UserService) importUser(tx *sql.Tx, email, name string, groups []string) (string, error) {
+	// validate
+	if err := service.EmailPolicy().Check(email); err != nil {
+		return "", err
+	}
+	name, err := checkName(name)
+	if err != nil {
+		return "", err
+	}
+	if groups, err = checkGroups(groups); err != nil {
+		return "", err
+	}
+	if err := ensureEmailFree(tx, email); err != nil {
+		return "", err
+	}
+
+	// create
+	code, err := generateCode()
+	if err != nil {
+		return "", err
+	}
+	id := uuid.NewV4()
+	_, err = tx.Exec("INSERT INTO users (id, email, name, code, created_at) VALUES (?, ?, ?, ?, DATETIME('now'))", id, email, name, code)
+	if err != nil {
+		return "", err
+	}
+	if err := setGroups(tx, id, groups); err != nil {
+		return "", err
+	}
+	return code, nil
+}
@@ -0,0 +1,133 @@
+package services_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestUserService_Import(t *testing.T) {
+	users := []services.ImportUser{
+		{Row: 2, Email: " Me@Example.com", Name: "Me Myself", Groups: []string{"staff", "sales", "staff"}},
+		{Row: 3, Email: "you@example.com"},
+	}
+
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+
+			results, err := userService.Import(users, false)
+			if err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if len(results) != 2 || results[0].Row != 2 || results[0].Email != "Me@example.com" || results[0].Err != nil {
+				t.Fatalf("expected 2 results without errors but got %+v\n", results)
+			}
+
+			// ensure the users can sign up and have their names and groups
+			id, err := userService.GetIDByCode(results[0].Code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			user, err := userService.Get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Email != "Me@example.com" || user.Name != "Me Myself" || !reflect.DeepEqual(user.Groups, []string{"sales", "staff"}) || user.Active {
+				t.Fatalf("expected the imported user but got %+v\n", user)
+			}
+
+			// ensure Users lists both
+			all, err := userService.Users()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(all) != 2 || all[0].Email != "Me@example.com" || len(all[0].Groups) != 2 || all[1].Email != "you@example.com" || len(all[1].Groups) != 0 {
+				t.Fatalf("expected 2 users but got %+v\n", all)
+			}
+		},
+		"dry run": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+
+			results, err := userService.Import(users, true)
+			if err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if len(results) != 2 || results[0].Err != nil || results[1].Err != nil {
+				t.Fatalf("expected 2 results without errors but got %+v\n", results)
+			}
+			if all, err := userService.Users(); err != nil || len(all) != 0 {
+				t.Fatalf("expected no users but got %+v, %v\n", all, err)
+			}
+		},
+		"rejected rows": func(t *testing.T) {
+			userService := &services.UserService{
+				DB:     db(t),
+				Emails: &services.EmailPolicy{DeniedDomains: []string{"example.org"}},
+			}
+			if _, err := userService.Create("taken@example.com"); err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := userService.Import([]services.ImportUser{
+				{Row: 1, Email: "new@example.com"},
+				{Row: 2, Email: "bad"},
+				{Row: 3, Email: "me@example.org"},
+				{Row: 4, Email: "TAKEN@example.com"},
+				{Row: 5, Email: "new@EXAMPLE.com"},
+				{Row: 6, Email: "group@example.com", Groups: []string{"no spaces"}},
+				{Row: 7, Email: "name@example.com", Name: strings.Repeat("x", services.NameMaxLen+1)},
+			}, false)
+			if err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			expected := []error{
+				nil,
+				services.ErrEmailInvalid,
+				services.ErrEmailDomainDenied,
+				services.ErrEmailTaken,
+				services.ErrEmailTaken,
+				services.ErrGroupInvalid,
+				services.ErrNameTooLong,
+			}
+			for i, result := range results {
+				if result.Row != i+1 || result.Err != expected[i] {
+					t.Fatalf("expected error %v for row %d but got %+v\n", expected[i], i+1, result)
+				}
+			}
+
+			// ensure nothing has been created
+			if all, err := userService.Users(); err != nil || len(all) != 1 {
+				t.Fatalf("expected 1 user but got %+v, %v\n", all, err)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestUserService_SetGroups(t *testing.T) {
+	userService := &services.UserService{DB: db(t)}
+	code, err := userService.Create("me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := userService.GetIDByCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := userService.SetGroups(id, []string{"staff", " sales "}); err != nil {
+		t.Fatalf("expected no error but got %q\n", err)
+	}
+	if err := userService.SetGroups(id, []string{"staff", ""}); err != services.ErrGroupInvalid {
+		t.Fatalf("expected error %q but got %v\n", services.ErrGroupInvalid, err)
+	}
+	if groups, err := userService.Groups(id); err != nil || !reflect.DeepEqual(groups, []string{"sales", "staff"}) {
+		t.Fatalf("expected groups %v but got %v, %v\n", []string{"sales", "staff"}, groups, err)
+	}
+}
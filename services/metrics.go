@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kschaper/auth-static/metrics"
+)
+
+var (
+	// passwordHashDuration measures the time bcrypt takes to hash and compare passwords.
+	passwordHashDuration = metrics.NewHistogramVec("auth_static_password_hash_duration_seconds",
+		"Time spent hashing and comparing passwords.", metrics.DefBuckets, "operation")
+
+	// queryDuration measures the time database statements take.
+	queryDuration = metrics.NewHistogramVec("auth_static_db_query_duration_seconds",
+		"Time spent executing database statements by SQL verb.", metrics.DefBuckets, "verb")
+)
+
+func init() {
+	metrics.Register(passwordHashDuration, queryDuration)
+}
+
+// observeSince adds the time since start to the histogram.
+func observeSince(hist *metrics.HistogramVec, start time.Time, labelValues ...string) {
+	hist.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// instrumentedConnector opens connections measuring the statements' duration.
+type instrumentedConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (connector *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := connector.driver.Open(connector.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn}, nil
+}
+
+func (connector *instrumentedConnector) Driver() driver.Driver {
+	return connector.driver
+}
+
+// instrumentedConn wraps the driver's connection.
+// The optional interfaces of database/sql/driver are forwarded so that contexts are still honored.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (conn *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := conn.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, verb: verb(query)}, nil
+}
+
+func (conn *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	preparer, ok := conn.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return conn.Prepare(query)
+	}
+	stmt, err := preparer.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, verb: verb(query)}, nil
+}
+
+// ExecContext executes the query with the driver's connection which, unlike a prepared statement,
+// runs all statements of a query like the migrations. It falls back to Prepare if unsupported.
+func (conn *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := conn.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer observeSince(queryDuration, time.Now(), verb(query))
+	return execer.ExecContext(ctx, query, args)
+}
+
+// QueryContext queries with the driver's connection. It falls back to Prepare if unsupported.
+func (conn *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := conn.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer observeSince(queryDuration, time.Now(), verb(query))
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (conn *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := conn.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return conn.Conn.Begin()
+}
+
+// Ping checks the connection if the driver supports it.
+func (conn *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := conn.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return ctx.Err()
+}
+
+// instrumentedStmt measures Exec and Query.
+type instrumentedStmt struct {
+	driver.Stmt
+	verb string
+}
+
+func (stmt *instrumentedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	defer observeSince(queryDuration, time.Now(), stmt.verb)
+	return stmt.Stmt.Exec(args)
+}
+
+func (stmt *instrumentedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	defer observeSince(queryDuration, time.Now(), stmt.verb)
+	return stmt.Stmt.Query(args)
+}
+
+func (stmt *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := stmt.Stmt.(driver.StmtExecContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return stmt.Exec(values)
+	}
+	defer observeSince(queryDuration, time.Now(), stmt.verb)
+	return execer.ExecContext(ctx, args)
+}
+
+func (stmt *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := stmt.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return stmt.Query(values)
+	}
+	defer observeSince(queryDuration, time.Now(), stmt.verb)
+	return queryer.QueryContext(ctx, args)
+}
+
+// namedValuesToValues converts the arguments for drivers without context support like database/sql does.
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("services: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+// verb returns the lowercased first word of the SQL statement, e.g. "select".
+func verb(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
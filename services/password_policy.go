@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordMaxBytes is the maximum password length in bytes with bcrypt which ignores everything after it.
+// It's the default of PasswordPolicy.MaxLength.
+const PasswordMaxBytes = 72
+
+const (
+	// ErrPasswordTooLong is returned when the password is longer than PasswordPolicy.MaxLength.
+	ErrPasswordTooLong = Error("password too long")
+	// ErrPasswordTooSimple is returned when the password has less than PasswordPolicy.MinClasses character classes.
+	ErrPasswordTooSimple = Error("password needs more kinds of characters")
+	// ErrPasswordContainsEmail is returned when the password contains the user's email address.
+	ErrPasswordContainsEmail = Error("password must not contain the email address")
+	// ErrPasswordBreached is returned when the password is in the list of breached passwords.
+	ErrPasswordBreached = Error("password is known from a data breach")
+)
+
+// PasswordPolicy holds the rules new passwords must follow. Zero values disable a rule.
+type PasswordPolicy struct {
+	MinLength   int                // in characters
+	MaxLength   int                // in bytes, PasswordMaxBytes if zero, at most PasswordMaxBytes with bcrypt
+	MinClasses  int                // of lowercase letters, uppercase letters, digits and other characters
+	RejectEmail bool               // reject passwords containing the email address or its local part
+	Breached    *BreachedPasswords // reject passwords known from data breaches
+}
+
+// DefaultPasswordPolicy is used by UserService if it doesn't have a policy.
+var DefaultPasswordPolicy = &PasswordPolicy{
+	MinLength: PasswordMinLen,
+	MaxLength: PasswordMaxBytes,
+}
+
+// PasswordRule is a rule of the policy as message key and arguments for the signup page.
+type PasswordRule struct {
+	Key  string
+	Args []interface{}
+}
+
+// Rules returns the active rules.
+func (policy *PasswordPolicy) Rules() []PasswordRule {
+	var rules []PasswordRule
+	if policy.MinLength > 0 {
+		rules = append(rules, PasswordRule{"password.min_length", []interface{}{policy.MinLength}})
+	}
+	rules = append(rules, PasswordRule{"password.max_length", []interface{}{policy.maxLength()}})
+	if policy.MinClasses > 1 {
+		rules = append(rules, PasswordRule{"password.min_classes", []interface{}{policy.MinClasses}})
+	}
+	if policy.RejectEmail {
+		rules = append(rules, PasswordRule{"password.no_email", nil})
+	}
+	if policy.Breached != nil {
+		rules = append(rules, PasswordRule{"password.not_breached", nil})
+	}
+	return rules
+}
+
+// Check returns an Error if the password of the user with the email breaks a rule.
+func (policy *PasswordPolicy) Check(password, email string) error {
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > policy.maxLength() {
+		return ErrPasswordTooLong
+	}
+	if policy.MinClasses > 1 && characterClasses(password) < policy.MinClasses {
+		return ErrPasswordTooSimple
+	}
+	if policy.RejectEmail && containsEmail(password, email) {
+		return ErrPasswordContainsEmail
+	}
+	if policy.Breached != nil {
+		breached, err := policy.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return ErrPasswordBreached
+		}
+	}
+	return nil
+}
+
+// maxLength returns MaxLength or PasswordMaxBytes if it isn't set.
+func (policy *PasswordPolicy) maxLength() int {
+	if policy.MaxLength <= 0 {
+		return PasswordMaxBytes
+	}
+	return policy.MaxLength
+}
+
+// characterClasses returns the number of character classes in the password.
+func characterClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// containsEmail checks if the password contains the email or its local part of at least 3 characters, ignoring case.
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+	local := email
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		local = email[:i]
+	}
+	return len(local) >= 3 && strings.Contains(password, local)
+}
+
+// BreachedPasswords looks up passwords in an offline copy of a breached password list in the k-anonymity range format
+// of Have I Been Pwned: the directory has a file for each 5 character prefix of the uppercase SHA-1 hex hashes,
+// e.g. "5BAA6", with lines of the remaining 35 characters optionally followed by ":" and a count.
+type BreachedPasswords struct {
+	Dir string
+}
+
+// Contains checks if the password is in the list. A missing range file means no password of the range is known.
+func (breached *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	file, err := os.Open(filepath.Join(breached.Dir, hash[:5]))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, ":"); i >= 0 {
+			line = line[:i]
+		}
+		if strings.EqualFold(line, hash[5:]) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,133 @@
+package services_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+// breachedDir creates a breached password list with the passwords.
+func breachedDir(t *testing.T, passwords ...string) string {
+	dir, err := ioutil.TempDir("", "breached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		file, err := os.OpenFile(filepath.Join(dir, hash[:5]), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.WriteString("0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" + hash[5:] + ":42\r\n"); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+	return dir
+}
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	dir := breachedDir(t, "password123")
+	defer os.RemoveAll(dir)
+
+	policy := &services.PasswordPolicy{
+		MinLength:   8,
+		MaxLength:   20,
+		MinClasses:  2,
+		RejectEmail: true,
+		Breached:    &services.BreachedPasswords{Dir: dir},
+	}
+
+	cases := map[string]struct {
+		password string
+		email    string
+		expected error
+	}{
+		"valid":              {"correct horse 42", "me@example.com", nil},
+		"too short":          {"abc 12", "me@example.com", services.ErrPasswordTooShort},
+		"multibyte length":   {"äöüäöüäö", "me@example.com", services.ErrPasswordTooSimple},
+		"too long":           {strings.Repeat("ab1", 7), "me@example.com", services.ErrPasswordTooLong},
+		"one class":          {"correcthorse", "me@example.com", services.ErrPasswordTooSimple},
+		"contains email":     {"x-Me@Example.com", "me@example.com", services.ErrPasswordContainsEmail},
+		"contains localpart": {"webmaster 2000", "webmaster@example.com", services.ErrPasswordContainsEmail},
+		"breached":           {"password123", "me@example.com", services.ErrPasswordBreached},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			if err := policy.Check(c.password, c.email); err != c.expected {
+				t.Fatalf("expected error %v but got %v\n", c.expected, err)
+			}
+		})
+	}
+
+	// ensure the default maximum is bcrypt's limit and can be raised for other hashes
+	if err := (&services.PasswordPolicy{}).Check(strings.Repeat("x", services.PasswordMaxBytes+1), ""); err != services.ErrPasswordTooLong {
+		t.Fatalf("expected error %v but got %v\n", services.ErrPasswordTooLong, err)
+	}
+	if err := (&services.PasswordPolicy{MaxLength: 128}).Check(strings.Repeat("x", 100), ""); err != nil {
+		t.Fatalf("expected no error but got %v\n", err)
+	}
+}
+
+func TestPasswordPolicy_Rules(t *testing.T) {
+	cases := map[string]struct {
+		policy   *services.PasswordPolicy
+		expected []string
+	}{
+		"default": {services.DefaultPasswordPolicy, []string{"password.min_length", "password.max_length"}},
+		"all": {
+			&services.PasswordPolicy{MinLength: 10, MinClasses: 3, RejectEmail: true, Breached: &services.BreachedPasswords{}},
+			[]string{"password.min_length", "password.max_length", "password.min_classes", "password.no_email", "password.not_breached"},
+		},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			var keys []string
+			for _, rule := range c.policy.Rules() {
+				keys = append(keys, rule.Key)
+			}
+			if strings.Join(keys, ",") != strings.Join(c.expected, ",") {
+				t.Fatalf("expected rules %v but got %v\n", c.expected, keys)
+			}
+		})
+	}
+}
+
+func TestBreachedPasswords_Contains(t *testing.T) {
+	dir := breachedDir(t, "password123")
+	defer os.RemoveAll(dir)
+	breached := &services.BreachedPasswords{Dir: dir}
+
+	cases := map[string]struct {
+		password string
+		expected bool
+	}{
+		"listed":        {"password123", true},
+		"same range":    {"unlisted", false},
+		"missing range": {"correct horse battery staple", false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			contains, err := breached.Contains(c.password)
+			if err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if contains != c.expected {
+				t.Fatalf("expected %v but got %v\n", c.expected, contains)
+			}
+		})
+	}
+}
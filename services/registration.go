@@ -0,0 +1,170 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+	"unicode/utf8"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// CreateTableRegistrations is the SQL statement to create the registrations table.
+const CreateTableRegistrations = `CREATE TABLE IF NOT EXISTS registrations (
+	id					TEXT NOT NULL PRIMARY KEY,
+	email				TEXT NOT NULL COLLATE NOCASE,
+	reason			TEXT NOT NULL,
+	ip					TEXT NOT NULL,
+	created_at	TEXT NOT NULL,
+	CONSTRAINT unique_email UNIQUE (email)
+)`
+
+// RegistrationReasonMaxLen is the maximum length of a registration's reason in characters.
+const RegistrationReasonMaxLen = 1000
+
+// RegistrationMaxAge is how long a registration stays pending if admins neither approve nor reject it.
+const RegistrationMaxAge = 14 * 24 * time.Hour
+
+const (
+	// RegistrationMaxPendingPerIP is the maximum number of pending registrations from one IP address.
+	RegistrationMaxPendingPerIP = 3
+	// RegistrationMaxPending is the maximum number of pending registrations in total.
+	RegistrationMaxPending = 500
+)
+
+const (
+	// ErrReasonTooLong is returned when the reason is longer than RegistrationReasonMaxLen.
+	ErrReasonTooLong = Error("reason too long")
+	// ErrUnknownRegistration is returned when there's no pending registration with the given ID.
+	ErrUnknownRegistration = Error("registration unknown")
+	// ErrTooManyRegistrations is returned when RegistrationMaxPendingPerIP or RegistrationMaxPending is reached.
+	ErrTooManyRegistrations = Error("too many pending registrations")
+)
+
+// Registration is a visitor's pending request for an account.
+type Registration struct {
+	ID        uuid.UUID
+	Email     string
+	Reason    string
+	IP        string
+	CreatedAt time.Time
+}
+
+// Register stores a pending registration for the email. Nothing is stored if a user has the email
+// or it's already pending, so visitors can't find out which emails have accounts.
+// It returns ErrTooManyRegistrations if the IP address or all visitors have too many pending registrations.
+// Registrations older than RegistrationMaxAge are deleted on the way.
+func (service *UserService) Register(email, reason, ip string) error {
+	email = service.normalizeEmail(email)
+	if err := service.EmailPolicy().Check(email); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(reason) > RegistrationReasonMaxLen {
+		return ErrReasonTooLong
+	}
+
+	if _, err := service.DB.Exec("DELETE FROM registrations WHERE created_at < ?", registrationCutoff()); err != nil {
+		return err
+	}
+
+	// the limits are checked first so they don't tell which emails have accounts either
+	var total, fromIP int
+	err := service.DB.QueryRow("SELECT COUNT(id), COALESCE(SUM(ip = ?), 0) FROM registrations", ip).Scan(&total, &fromIP)
+	if err != nil {
+		return err
+	}
+	if total >= RegistrationMaxPending || fromIP >= RegistrationMaxPendingPerIP {
+		return ErrTooManyRegistrations
+	}
+
+	if err := ensureEmailFree(service.DB, email); err == ErrEmailTaken {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = service.DB.Exec("INSERT INTO registrations (id, email, reason, ip, created_at) VALUES (?, ?, ?, ?, DATETIME('now')) "+
+		"ON CONFLICT(email) DO NOTHING", uuid.NewV4().String(), email, reason, ip)
+	return err
+}
+
+// Registrations returns the pending registrations younger than RegistrationMaxAge, oldest first.
+func (service *UserService) Registrations() ([]Registration, error) {
+	rows, err := service.DB.Query("SELECT id, email, reason, ip, created_at FROM registrations WHERE created_at >= ? "+
+		"ORDER BY created_at, email", registrationCutoff())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var registrations []Registration
+	for rows.Next() {
+		var (
+			registration Registration
+			id           string
+			createdAt    string
+		)
+		if err := rows.Scan(&id, &registration.Email, &registration.Reason, &registration.IP, &createdAt); err != nil {
+			return nil, err
+		}
+		if registration.ID, err = uuid.FromString(id); err != nil {
+			return nil, err
+		}
+		if registration.CreatedAt, err = time.Parse(timeFormat, createdAt); err != nil {
+			return nil, err
+		}
+		registrations = append(registrations, registration)
+	}
+	return registrations, rows.Err()
+}
+
+// ApproveRegistration creates the user of the pending registration, deletes the registration
+// and returns the email and the code for the signup URL. It returns ErrUnknownRegistration
+// if there's no such registration or it's expired and ErrEmailTaken if a user got the email in the meantime.
+func (service *UserService) ApproveRegistration(id uuid.UUID) (string, string, error) {
+	email, err := service.registrationEmail(id)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Create would renew the code of a user who hasn't set a password yet
+	if err := ensureEmailFree(service.DB, email); err != nil {
+		return "", "", err
+	}
+	code, err := service.Create(email)
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, err := service.DB.Exec("DELETE FROM registrations WHERE id = ?", id); err != nil {
+		return "", "", err
+	}
+	return email, code, nil
+}
+
+// RejectRegistration deletes the pending registration and returns its email.
+// It returns ErrUnknownRegistration if there's no such registration.
+func (service *UserService) RejectRegistration(id uuid.UUID) (string, error) {
+	email, err := service.registrationEmail(id)
+	if err != nil {
+		return "", err
+	}
+	if _, err := service.DB.Exec("DELETE FROM registrations WHERE id = ?", id); err != nil {
+		return "", err
+	}
+	return email, nil
+}
+
+// registrationEmail returns the email of the pending registration.
+func (service *UserService) registrationEmail(id uuid.UUID) (string, error) {
+	var email string
+	err := service.DB.QueryRow("SELECT email FROM registrations WHERE id = ? AND created_at >= ?", id, registrationCutoff()).Scan(&email)
+	if err == sql.ErrNoRows {
+		return "", ErrUnknownRegistration
+	}
+	return email, err
+}
+
+// registrationCutoff returns the created_at before which registrations are expired.
+func registrationCutoff() string {
+	return time.Now().UTC().Add(-RegistrationMaxAge).Format(timeFormat)
+}
@@ -0,0 +1,184 @@
+package services_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestUserService_Registration(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"approve": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+
+			if err := userService.Register(" Me@Example.com ", "I'm new here", "192.0.2.1"); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			// a second request for the email is ignored
+			if err := userService.Register("me@example.com", "again", "192.0.2.2"); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+
+			pending, err := userService.Registrations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pending) != 1 || pending[0].Email != "Me@example.com" || pending[0].Reason != "I'm new here" || pending[0].IP != "192.0.2.1" {
+				t.Fatalf("expected 1 registration of %q but got %+v\n", "Me@example.com", pending)
+			}
+
+			email, code, err := userService.ApproveRegistration(pending[0].ID)
+			if err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if email != "Me@example.com" {
+				t.Fatalf("expected email %q but got %q\n", "Me@example.com", email)
+			}
+
+			// ensure the user can sign up with the code
+			id, err := userService.GetIDByCode(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found, err := userService.GetIDByEmail("me@example.com"); err != nil || found != id {
+				t.Fatalf("expected user %s but got %s, %v\n", id, found, err)
+			}
+			if pending, err := userService.Registrations(); err != nil || len(pending) != 0 {
+				t.Fatalf("expected no registrations but got %+v, %v\n", pending, err)
+			}
+		},
+		"reject": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+
+			if err := userService.Register("me@example.com", "", "192.0.2.1"); err != nil {
+				t.Fatal(err)
+			}
+			pending, err := userService.Registrations()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if email, err := userService.RejectRegistration(pending[0].ID); err != nil || email != "me@example.com" {
+				t.Fatalf("expected email %q but got %q, %v\n", "me@example.com", email, err)
+			}
+			if _, err := userService.GetIDByEmail("me@example.com"); err == nil {
+				t.Fatal("expected no user but found one")
+			}
+			if _, _, err := userService.ApproveRegistration(pending[0].ID); err != services.ErrUnknownRegistration {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUnknownRegistration, err)
+			}
+		},
+		"existing user": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+			if _, err := userService.Create("me@example.com"); err != nil {
+				t.Fatal(err)
+			}
+
+			// nothing is stored, without telling the visitor
+			if err := userService.Register("ME@example.com", "", "192.0.2.1"); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if pending, err := userService.Registrations(); err != nil || len(pending) != 0 {
+				t.Fatalf("expected no registrations but got %+v, %v\n", pending, err)
+			}
+		},
+		"user created in the meantime": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+
+			if err := userService.Register("me@example.com", "", "192.0.2.1"); err != nil {
+				t.Fatal(err)
+			}
+			pending, err := userService.Registrations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := userService.Create("me@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := userService.ApproveRegistration(pending[0].ID); err != services.ErrEmailTaken {
+				t.Fatalf("expected error %q but got %v\n", services.ErrEmailTaken, err)
+			}
+			// ensure the existing user's code is unchanged
+			if _, err := userService.GetIDByCode(code); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+		},
+		"too many": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+			for i := 0; i < services.RegistrationMaxPendingPerIP; i++ {
+				if err := userService.Register(fmt.Sprintf("me%d@example.com", i), "", "192.0.2.1"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// ensure the IP address can't register more
+			if err := userService.Register("you@example.com", "", "192.0.2.1"); err != services.ErrTooManyRegistrations {
+				t.Fatalf("expected error %q but got %v\n", services.ErrTooManyRegistrations, err)
+			}
+			// ensure others can
+			if err := userService.Register("you@example.com", "", "192.0.2.2"); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+		},
+		"expired": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+			for i := 0; i < services.RegistrationMaxPendingPerIP; i++ {
+				if err := userService.Register(fmt.Sprintf("me%d@example.com", i), "", "192.0.2.1"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := userService.DB.Exec("UPDATE registrations SET created_at = DATETIME('now', '-15 days')"); err != nil {
+				t.Fatal(err)
+			}
+
+			// ensure expired registrations are neither listed nor counted
+			if pending, err := userService.Registrations(); err != nil || len(pending) != 0 {
+				t.Fatalf("expected no registrations but got %+v, %v\n", pending, err)
+			}
+			if err := userService.Register("you@example.com", "", "192.0.2.1"); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			var count int
+			if err := userService.DB.QueryRow("SELECT COUNT(id) FROM registrations").Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if count != 1 {
+				t.Fatalf("expected 1 registration but got %d\n", count)
+			}
+		},
+		"errors": func(t *testing.T) {
+			userService := &services.UserService{
+				DB:     db(t),
+				Emails: &services.EmailPolicy{AllowedDomains: []string{"example.com"}},
+			}
+
+			for _, c := range []struct {
+				email    string
+				reason   string
+				expected error
+			}{
+				{"", "", services.ErrEmailRequired},
+				{"me", "", services.ErrEmailInvalid},
+				{"me@example.org", "", services.ErrEmailDomainNotAllowed},
+				{"me@example.com", strings.Repeat("x", services.RegistrationReasonMaxLen+1), services.ErrReasonTooLong},
+			} {
+				if err := userService.Register(c.email, c.reason, "192.0.2.1"); err != c.expected {
+					t.Fatalf("expected error %q for %q but got %v\n", c.expected, c.email, err)
+				}
+			}
+			if _, err := userService.RejectRegistration(uuid.NewV4()); err != services.ErrUnknownRegistration {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUnknownRegistration, err)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
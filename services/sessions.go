@@ -0,0 +1,140 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// CreateTableSessions is the SQL statement to create the sessions table.
+const CreateTableSessions = `CREATE TABLE IF NOT EXISTS sessions (
+	id						TEXT NOT NULL PRIMARY KEY,
+	user_id				TEXT NOT NULL,
+	created_at		TEXT NOT NULL,
+	last_seen_at	TEXT NOT NULL,
+	ip						TEXT,
+	user_agent		TEXT
+);
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id)`
+
+// SessionMaxIdle is how long a session stays valid without being used.
+// It matches the default max age of the session cookie.
+const SessionMaxIdle = 30 * 24 * time.Hour
+
+// sessionTouchInterval limits the updates of last_seen_at to one per interval and session.
+const sessionTouchInterval = time.Minute
+
+// Session is a signin of a user on a device.
+type Session struct {
+	ID         string
+	UserID     uuid.UUID
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	IP         string
+	UserAgent  string
+}
+
+// CreateSession stores a new session for the user and returns the session's ID
+// for the session cookie. Sessions idle longer than SessionMaxIdle are deleted on the way.
+func (service *UserService) CreateSession(userID uuid.UUID, ip, userAgent string) (string, error) {
+	id, err := generateCode()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := service.DB.Exec("DELETE FROM sessions WHERE last_seen_at < ?", sessionCutoff()); err != nil {
+		return "", err
+	}
+
+	_, err = service.DB.Exec("INSERT INTO sessions (id, user_id, created_at, last_seen_at, ip, user_agent) "+
+		"VALUES (?, ?, DATETIME('now'), DATETIME('now'), ?, ?)", id, userID, ip, userAgent)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// SessionUserID returns the ID of the user the session belongs to and updates its last_seen_at.
+// It returns uuid.Nil if the session doesn't exist, is idle longer than SessionMaxIdle, or the user is gone or disabled.
+func (service *UserService) SessionUserID(id string) (uuid.UUID, error) {
+	var userID string
+	err := service.DB.QueryRow("SELECT s.user_id FROM sessions s JOIN users u ON u.id = s.user_id "+
+		"WHERE s.id = ? AND s.last_seen_at >= ? AND u.disabled_at IS NULL", id, sessionCutoff()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// touch the session at most once per interval
+	touched := time.Now().UTC().Add(-sessionTouchInterval).Format(timeFormat)
+	if _, err := service.DB.Exec("UPDATE sessions SET last_seen_at = DATETIME('now') WHERE id = ? AND last_seen_at < ?", id, touched); err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.FromString(userID)
+}
+
+// DeleteSession deletes the session. Unknown IDs are ignored.
+func (service *UserService) DeleteSession(id string) error {
+	_, err := service.DB.Exec("DELETE FROM sessions WHERE id = ?", id)
+	return err
+}
+
+// DeleteOtherSessions deletes the user's sessions except the one with the given ID
+// and returns the number of deleted sessions.
+func (service *UserService) DeleteOtherSessions(userID uuid.UUID, keepID string) (int64, error) {
+	result, err := service.DB.Exec("DELETE FROM sessions WHERE user_id = ? AND id != ?", userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Sessions returns the user's sessions used within SessionMaxIdle, the most recently used first.
+func (service *UserService) Sessions(userID uuid.UUID) ([]Session, error) {
+	rows, err := service.DB.Query("SELECT id, created_at, last_seen_at, ip, user_agent FROM sessions "+
+		"WHERE user_id = ? AND last_seen_at >= ? ORDER BY last_seen_at DESC, created_at DESC", userID, sessionCutoff())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var (
+			session    = Session{UserID: userID}
+			createdAt  string
+			lastSeenAt string
+			ip         sql.NullString
+			userAgent  sql.NullString
+		)
+		if err := rows.Scan(&session.ID, &createdAt, &lastSeenAt, &ip, &userAgent); err != nil {
+			return nil, err
+		}
+		if session.CreatedAt, err = time.Parse(timeFormat, createdAt); err != nil {
+			return nil, err
+		}
+		if session.LastSeenAt, err = time.Parse(timeFormat, lastSeenAt); err != nil {
+			return nil, err
+		}
+		session.IP = ip.String
+		session.UserAgent = userAgent.String
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// CountSessions returns the number of sessions used within SessionMaxIdle.
+func (service *UserService) CountSessions() (int, error) {
+	var count int
+	err := service.DB.QueryRow("SELECT COUNT(id) FROM sessions WHERE last_seen_at >= ?", sessionCutoff()).Scan(&count)
+	return count, err
+}
+
+// sessionCutoff returns the last_seen_at before which sessions are expired.
+func sessionCutoff() string {
+	return time.Now().UTC().Add(-SessionMaxIdle).Format(timeFormat)
+}
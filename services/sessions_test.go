@@ -0,0 +1,163 @@
+package services_test
+
+import (
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/kschaper/auth-static/services"
+)
+
+func TestUserService_Sessions(t *testing.T) {
+	// setup creates a user.
+	setup := func(t *testing.T) (*services.UserService, uuid.UUID) {
+		userService := &services.UserService{DB: db(t)}
+		code, err := userService.Create("me@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := userService.GetIDByCode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return userService, id
+	}
+
+	cases := map[string]func(t *testing.T){
+		"create and look up": func(t *testing.T) {
+			userService, id := setup(t)
+
+			sessionID, err := userService.CreateSession(id, "127.0.0.1", "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			userID, err := userService.SessionUserID(sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userID != id {
+				t.Fatalf("expected user id %s but got %s\n", id, userID)
+			}
+		},
+		"unknown session": func(t *testing.T) {
+			userService, _ := setup(t)
+
+			userID, err := userService.SessionUserID("unknown")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userID != uuid.Nil {
+				t.Fatalf("expected no user id but got %s\n", userID)
+			}
+		},
+		"unknown user": func(t *testing.T) {
+			userService, _ := setup(t)
+
+			sessionID, err := userService.CreateSession(uuid.NewV4(), "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			userID, err := userService.SessionUserID(sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userID != uuid.Nil {
+				t.Fatalf("expected no user id but got %s\n", userID)
+			}
+		},
+		"expired": func(t *testing.T) {
+			userService, id := setup(t)
+
+			sessionID, err := userService.CreateSession(id, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := userService.DB.Exec("UPDATE sessions SET last_seen_at = DATETIME('now', '-31 days')"); err != nil {
+				t.Fatal(err)
+			}
+			userID, err := userService.SessionUserID(sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userID != uuid.Nil {
+				t.Fatalf("expected no user id but got %s\n", userID)
+			}
+			if count, err := userService.CountSessions(); err != nil || count != 0 {
+				t.Fatalf("expected no active sessions but got %d, %v\n", count, err)
+			}
+		},
+		"list": func(t *testing.T) {
+			userService, id := setup(t)
+
+			for _, ua := range []string{"first", "second"} {
+				if _, err := userService.CreateSession(id, "127.0.0.1", ua); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := userService.CreateSession(uuid.NewV4(), "", "other user"); err != nil {
+				t.Fatal(err)
+			}
+
+			sessions, err := userService.Sessions(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sessions) != 2 {
+				t.Fatalf("expected 2 sessions but got %+v\n", sessions)
+			}
+			for _, session := range sessions {
+				if session.UserID != id || session.IP != "127.0.0.1" || session.CreatedAt.IsZero() || session.LastSeenAt.IsZero() {
+					t.Fatalf("expected session of user %s with IP and times but got %+v\n", id, session)
+				}
+			}
+		},
+		"delete": func(t *testing.T) {
+			userService, id := setup(t)
+
+			sessionID, err := userService.CreateSession(id, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := userService.DeleteSession(sessionID); err != nil {
+				t.Fatal(err)
+			}
+			userID, err := userService.SessionUserID(sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userID != uuid.Nil {
+				t.Fatalf("expected no user id but got %s\n", userID)
+			}
+		},
+		"delete others": func(t *testing.T) {
+			userService, id := setup(t)
+
+			var sessionIDs []string
+			for i := 0; i < 3; i++ {
+				sessionID, err := userService.CreateSession(id, "", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				sessionIDs = append(sessionIDs, sessionID)
+			}
+
+			deleted, err := userService.DeleteOtherSessions(id, sessionIDs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted != 2 {
+				t.Fatalf("expected 2 deleted sessions but got %d\n", deleted)
+			}
+			if count, err := userService.CountSessions(); err != nil || count != 1 {
+				t.Fatalf("expected 1 active session but got %d, %v\n", count, err)
+			}
+			if userID, err := userService.SessionUserID(sessionIDs[0]); err != nil || userID != id {
+				t.Fatalf("expected kept session of user %s but got %s, %v\n", id, userID, err)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"strings"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
-	"golang.org/x/crypto/bcrypt"
+
+	"github.com/kschaper/auth-static/logging"
 )
 
-// PasswordMinLen is the minimum password length.
+// PasswordMinLen is the default minimum password length.
 const PasswordMinLen = 8
 
 // Error represents an error returned on expected errors.
@@ -24,28 +26,78 @@ func (e Error) Error() string {
 const (
 	// ErrEmailRequired is returned when the email is empty
 	ErrEmailRequired = Error("email required")
-	// ErrPasswordTooShort is returned when the password is < PasswordMinLen.
+	// ErrPasswordTooShort is returned when the password is shorter than PasswordPolicy.MinLength.
 	ErrPasswordTooShort = Error("password too short")
 	// ErrPasswordNotConfirmed is return when password and confirmation don't match.
 	ErrPasswordNotConfirmed = Error("password and doesn't match confirmation")
 	// ErrUnknownCode is returned when the given code is not in db.
 	ErrUnknownCode = Error("code unknown")
+	// ErrUnknownUser is returned when there's no user with the given ID.
+	ErrUnknownUser = Error("user unknown")
+	// ErrWrongPassword is returned when the current password given to change it is wrong.
+	ErrWrongPassword = Error("current password wrong")
+	// ErrUserExists is returned when a user is created with the email of a user who has set a password or is disabled.
+	ErrUserExists = Error("user already exists")
 )
 
+// User is a user's account without secrets.
+type User struct {
+	ID           uuid.UUID
+	Email        string
+	Name         string
+	Groups       []string
+	Active       bool // has set a password
+	Admin        bool // may use the admin pages
+	Disabled     bool // can't sign in
+	CreatedAt    time.Time
+	LastSigninAt time.Time // zero if the user never signed in
+}
+
 // UserService manages users.
 type UserService struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Policy *PasswordPolicy // DefaultPasswordPolicy if nil
+	Hasher PasswordHasher  // DefaultPasswordHasher if nil
+	Emails *EmailPolicy    // DefaultEmailPolicy if nil
+
+	// LowercaseEmails stores emails completely lowercased instead of only their domain.
+	// Lookups are case-insensitive either way.
+	LowercaseEmails bool
+}
+
+// PasswordHasher returns the hasher for new passwords.
+func (service *UserService) PasswordHasher() PasswordHasher {
+	if service.Hasher == nil {
+		return DefaultPasswordHasher
+	}
+	return service.Hasher
+}
+
+// hash hashes the password with the current hasher.
+func (service *UserService) hash(password string) (string, error) {
+	defer observeSince(passwordHashDuration, time.Now(), "hash")
+	return service.PasswordHasher().Hash(password)
+}
+
+// PasswordPolicy returns the policy for new passwords.
+func (service *UserService) PasswordPolicy() *PasswordPolicy {
+	if service.Policy == nil {
+		return DefaultPasswordPolicy
+	}
+	return service.Policy
 }
 
 // Create creates a new user with the given email and a generated code which is then returned.
 // The code can be used for the signup URL: `https://example.com/signup/<code>`.
-// If a user with the given email already exists then it will be updated
-// with a new code, an empty password hash, and an updated updated_at.
-// All other fields won't get updated.
+// If a user with the given email who hasn't set a password yet exists then it will be updated
+// with a new code and an updated updated_at. All other fields won't get updated.
+// It returns ErrUserExists for users who have set a password or are disabled, see Reinvite.
 func (service *UserService) Create(email string) (string, error) {
-	// validate email length
-	if len(email) == 0 {
-		return "", ErrEmailRequired
+	email = service.normalizeEmail(email)
+
+	// validate email
+	if err := service.EmailPolicy().Check(email); err != nil {
+		return "", err
 	}
 
 	// generate new code
@@ -54,14 +106,72 @@ func (service *UserService) Create(email string) (string, error) {
 		return "", err
 	}
 
-	// create new user
+	// create new user or renew the code of a pending one
 	sql := "INSERT INTO users (id, email, code, created_at) VALUES (?, ?, ?, DATETIME('now')) " +
-		"ON CONFLICT(email) DO UPDATE SET code = ?, hash = '', updated_at = DATETIME('now')"
+		"ON CONFLICT(email COLLATE NOCASE) DO UPDATE SET code = ?, updated_at = DATETIME('now') " +
+		"WHERE COALESCE(users.hash, '') = '' AND users.disabled_at IS NULL"
 	stmt, err := service.DB.Prepare(sql)
 	if err != nil {
 		return "", err
 	}
-	if _, err := stmt.Exec(uuid.NewV4(), email, code, code); err != nil {
+	result, err := stmt.Exec(uuid.NewV4(), email, code, code)
+	if err != nil {
+		return "", err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return "", err
+	} else if n == 0 {
+		return "", ErrUserExists
+	}
+	return code, nil
+}
+
+// Reinvite gives the enabled user with the given email a new code which is then returned.
+// The password stays valid until the user sets a new one with the code. With reset the password
+// is deleted and the user's sessions end at once. It returns ErrUnknownUser or ErrUserDisabled.
+func (service *UserService) Reinvite(email string, reset bool) (string, error) {
+	email = service.normalizeEmail(email)
+
+	id, err := service.GetIDByEmail(email)
+	if err == ErrUnknownCode {
+		return "", ErrUnknownUser
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// generate new code
+	code, err := generateCode()
+	if err != nil {
+		return "", err
+	}
+
+	// update user, with reset together with the sessions so the user isn't left without password and code
+	tx, err := service.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE users SET code = ?, updated_at = DATETIME('now') WHERE id = ? AND disabled_at IS NULL"
+	if reset {
+		query = "UPDATE users SET code = ?, hash = '', updated_at = DATETIME('now') WHERE id = ? AND disabled_at IS NULL"
+	}
+	result, err := tx.Exec(query, code, id)
+	if err != nil {
+		return "", err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return "", err
+	} else if n == 0 {
+		return "", ErrUserDisabled
+	}
+	if reset {
+		if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", id); err != nil {
+			return "", err
+		}
+	}
+	if err := tx.Commit(); err != nil {
 		return "", err
 	}
 	return code, nil
@@ -96,15 +206,15 @@ func (service *UserService) GetIDByCode(code string) (uuid.UUID, error) {
 	return uuid.FromString(id)
 }
 
-// GetIDByEmail returns the user ID for the given email.
+// GetIDByEmail returns the user ID for the given email which is compared case-insensitively.
 func (service *UserService) GetIDByEmail(email string) (uuid.UUID, error) {
-	stmt, err := service.DB.Prepare("SELECT id FROM users WHERE email = ?")
+	stmt, err := service.DB.Prepare("SELECT id FROM users WHERE email = ? COLLATE NOCASE")
 	if err != nil {
 		return uuid.Nil, err
 	}
 
 	var id string
-	err = stmt.QueryRow(email).Scan(&id)
+	err = stmt.QueryRow(service.normalizeEmail(email)).Scan(&id)
 	if err == sql.ErrNoRows {
 		return uuid.Nil, ErrUnknownCode
 	}
@@ -115,14 +225,131 @@ func (service *UserService) GetIDByEmail(email string) (uuid.UUID, error) {
 	return uuid.FromString(id)
 }
 
-// UpdatePassword sets the hash and deletes the code.
+// GetEmailByID returns the email of the user with the given ID.
+func (service *UserService) GetEmailByID(id uuid.UUID) (string, error) {
+	var email string
+	err := service.DB.QueryRow("SELECT email FROM users WHERE id = ?", id).Scan(&email)
+	if err == sql.ErrNoRows {
+		return "", ErrUnknownUser
+	}
+	if err != nil {
+		return "", err
+	}
+	return email, nil
+}
+
+// Get returns the user with the given ID.
+func (service *UserService) Get(id uuid.UUID) (*User, error) {
+	user, err := scanUser(service.DB.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrUnknownUser
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Groups, err = service.Groups(id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Users returns all users with their groups, sorted by email.
+func (service *UserService) Users() ([]User, error) {
+	rows, err := service.DB.Query("SELECT " + userColumns + " FROM users ORDER BY email COLLATE NOCASE")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		users []User
+		index = map[string]int{} // by ID
+	)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[user.ID.String()] = len(users)
+		users = append(users, *user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// groups
+	groups, err := service.DB.Query("SELECT user_id, name FROM user_groups ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer groups.Close()
+	for groups.Next() {
+		var userID, group string
+		if err := groups.Scan(&userID, &group); err != nil {
+			return nil, err
+		}
+		if i, ok := index[userID]; ok {
+			users[i].Groups = append(users[i].Groups, group)
+		}
+	}
+	return users, groups.Err()
+}
+
+// userColumns are the columns read by scanUser.
+const userColumns = "id, email, name, hash, admin, disabled_at, created_at, last_signin_at"
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser reads the userColumns of a row into a user without groups.
+func scanUser(row scanner) (*User, error) {
+	var (
+		user         = &User{}
+		id           string
+		hash         sql.NullString
+		disabledAt   sql.NullString
+		createdAt    string
+		lastSigninAt sql.NullString
+	)
+	if err := row.Scan(&id, &user.Email, &user.Name, &hash, &user.Admin, &disabledAt, &createdAt, &lastSigninAt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if user.ID, err = uuid.FromString(id); err != nil {
+		return nil, err
+	}
+	user.Active = hash.String != ""
+	user.Disabled = disabledAt.Valid
+	if user.CreatedAt, err = time.Parse(timeFormat, createdAt); err != nil {
+		return nil, err
+	}
+	if lastSigninAt.Valid {
+		if user.LastSigninAt, err = time.Parse(timeFormat, lastSigninAt.String); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// UpdatePassword checks the password against the policy, sets the hash and deletes the code.
 func (service *UserService) UpdatePassword(id uuid.UUID, password, confirmation string) error {
 	password = strings.TrimSpace(password)
 	confirmation = strings.TrimSpace(confirmation)
 
-	// validate minimum password length
-	if len(password) < PasswordMinLen {
-		return ErrPasswordTooShort
+	// validate password against policy
+	policy := service.PasswordPolicy()
+	var email string
+	if policy.RejectEmail {
+		var err error
+		if email, err = service.GetEmailByID(id); err != nil {
+			return err
+		}
+	}
+	if err := policy.Check(password, email); err != nil {
+		return err
 	}
 
 	// validate password confirmation
@@ -131,7 +358,7 @@ func (service *UserService) UpdatePassword(id uuid.UUID, password, confirmation
 	}
 
 	// generate password hash
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := service.hash(password)
 	if err != nil {
 		return err
 	}
@@ -141,25 +368,47 @@ func (service *UserService) UpdatePassword(id uuid.UUID, password, confirmation
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(string(hash), id)
+	_, err = stmt.Exec(hash, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// ChangePassword sets a new password like UpdatePassword after checking the current one.
+// It returns ErrWrongPassword if the current password is wrong.
+func (service *UserService) ChangePassword(id uuid.UUID, current, password, confirmation string) error {
+	email, err := service.GetEmailByID(id)
+	if err != nil {
+		return err
+	}
+
+	// check current password
+	authenticated, err := service.Authenticate(email, current)
+	if err != nil {
+		return err
+	}
+	if !authenticated {
+		return ErrWrongPassword
+	}
+
+	return service.UpdatePassword(id, password, confirmation)
+}
+
 // Authenticate checks if there is a user for the given email and password.
+// After a successful check a hash made with another algorithm or other parameters than the hasher's
+// is replaced by a new one. If that fails it's tried again on the next call.
 func (service *UserService) Authenticate(email, password string) (bool, error) {
-	email = strings.TrimSpace(email)
+	email = service.normalizeEmail(email)
 	password = strings.TrimSpace(password)
 
-	// get the hashed password
-	stmt, err := service.DB.Prepare("SELECT hash FROM users WHERE email = ?")
+	// get the hashed password of an enabled user
+	stmt, err := service.DB.Prepare("SELECT hash FROM users WHERE email = ? COLLATE NOCASE AND disabled_at IS NULL")
 	if err != nil {
 		return false, err
 	}
 
-	var hash string
+	var hash sql.NullString
 	err = stmt.QueryRow(email).Scan(&hash)
 	if err == sql.ErrNoRows {
 		return false, nil
@@ -168,21 +417,37 @@ func (service *UserService) Authenticate(email, password string) (bool, error) {
 		return false, err
 	}
 
-	// compare hash and password
-	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-
-	// password wrong
-	if err == bcrypt.ErrMismatchedHashAndPassword {
+	// no password set yet
+	if hash.String == "" {
 		return false, nil
 	}
 
-	// some other error
-	if err != nil {
+	// compare hash and password
+	ok, err := verifyPassword(hash.String, password)
+	if err != nil || !ok {
 		return false, err
 	}
+
+	// upgrade hash unless it has been changed in the meantime
+	// failures are only logged since the password is correct anyway
+	if hasher := service.PasswordHasher(); hasher.NeedsRehash(hash.String) {
+		newHash, err := service.hash(password)
+		if err == nil {
+			_, err = service.DB.Exec("UPDATE users SET hash = ? WHERE email = ? COLLATE NOCASE AND hash = ?", newHash, email, hash.String)
+		}
+		if err != nil {
+			logging.Default.Error("upgrading password hash", "error", err)
+		}
+	}
 	return true, nil
 }
 
+// SetLastSignin sets the user's last_signin_at to now.
+func (service *UserService) SetLastSignin(id uuid.UUID) error {
+	_, err := service.DB.Exec("UPDATE users SET last_signin_at = DATETIME('now') WHERE id = ?", id)
+	return err
+}
+
 // Exists checks if the user with the given ID exists.
 func (service *UserService) Exists(id uuid.UUID) (bool, error) {
 	var count int
@@ -192,3 +457,10 @@ func (service *UserService) Exists(id uuid.UUID) (bool, error) {
 	}
 	return count == 1, nil
 }
+
+// CountPending returns the number of users who haven't used their signup code yet.
+func (service *UserService) CountPending() (int, error) {
+	var count int
+	err := service.DB.QueryRow("SELECT COUNT(id) FROM users WHERE code IS NOT NULL AND code != ''").Scan(&count)
+	return count, err
+}
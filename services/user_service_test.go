@@ -88,7 +88,7 @@ func TestUserService_Create(t *testing.T) {
 			}
 
 		},
-		"duplicate email": func(t *testing.T) {
+		"duplicate email of pending user": func(t *testing.T) {
 			var (
 				db          = db(t)
 				userService = &services.UserService{DB: db}
@@ -132,7 +132,7 @@ func TestUserService_Create(t *testing.T) {
 			var (
 				secondID        string
 				secondCode      string
-				secondHash      string
+				secondHash      sql.NullString
 				secondCreatedAt string
 				secondUpdatedAt sql.NullString
 			)
@@ -152,8 +152,8 @@ func TestUserService_Create(t *testing.T) {
 				t.Fatal("expected code to be updated but wasn't")
 			}
 
-			// ensure password hash has been deleted
-			if secondHash != "" {
+			// ensure there's still no password hash
+			if secondHash.String != "" {
 				t.Fatal("expected hash to be empty but wasn't")
 			}
 
@@ -167,6 +167,132 @@ func TestUserService_Create(t *testing.T) {
 				t.Fatal("expected updated_at not to be the same but was")
 			}
 		},
+		"duplicate email of active user": func(t *testing.T) {
+			var (
+				userService = &services.UserService{DB: db(t)}
+				email       = "me@example.com"
+				password    = strings.Repeat("x", services.PasswordMinLen)
+			)
+
+			// create user and set password
+			code, err := userService.Create(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := userService.GetIDByCode(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := userService.UpdatePassword(id, password, password); err != nil {
+				t.Fatal(err)
+			}
+
+			// create user again
+			if _, err := userService.Create(email); err != services.ErrUserExists {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUserExists, err)
+			}
+
+			// ensure the password is still valid
+			if ok, err := userService.Authenticate(email, password); err != nil || !ok {
+				t.Fatalf("expected user to be authenticated but got %t, %v\n", ok, err)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestUserService_Reinvite(t *testing.T) {
+	password := strings.Repeat("x", services.PasswordMinLen)
+
+	// setup creates a user who has set a password and is signed in.
+	setup := func(t *testing.T) (*services.UserService, uuid.UUID, string) {
+		userService := &services.UserService{DB: db(t)}
+		code, err := userService.Create("me@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := userService.GetIDByCode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := userService.UpdatePassword(id, password, password); err != nil {
+			t.Fatal(err)
+		}
+		sessionID, err := userService.CreateSession(id, "127.0.0.1", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return userService, id, sessionID
+	}
+
+	cases := map[string]func(t *testing.T){
+		"keep password": func(t *testing.T) {
+			userService, id, sessionID := setup(t)
+
+			code, err := userService.Reinvite("ME@example.com", false)
+			if err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if found, err := userService.GetIDByCode(code); err != nil || found != id {
+				t.Fatalf("expected code of user %s but got %s, %v\n", id, found, err)
+			}
+
+			// ensure the old password and the session stay valid
+			if ok, err := userService.Authenticate("me@example.com", password); err != nil || !ok {
+				t.Fatalf("expected user to be authenticated but got %t, %v\n", ok, err)
+			}
+			if userID, err := userService.SessionUserID(sessionID); err != nil || userID != id {
+				t.Fatalf("expected session of user %s but got %s, %v\n", id, userID, err)
+			}
+
+			// ensure the new password replaces the old one
+			newPassword := strings.Repeat("y", services.PasswordMinLen)
+			if err := userService.UpdatePassword(id, newPassword, newPassword); err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := userService.Authenticate("me@example.com", password); err != nil || ok {
+				t.Fatalf("expected old password to be invalid but got %t, %v\n", ok, err)
+			}
+		},
+		"reset": func(t *testing.T) {
+			userService, id, sessionID := setup(t)
+
+			if _, err := userService.Reinvite("me@example.com", true); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if ok, err := userService.Authenticate("me@example.com", password); err != nil || ok {
+				t.Fatalf("expected password to be deleted but got %t, %v\n", ok, err)
+			}
+			if userID, err := userService.SessionUserID(sessionID); err != nil || userID != uuid.Nil {
+				t.Fatalf("expected session to be deleted but got %s, %v\n", userID, err)
+			}
+			if exists, err := userService.Exists(id); err != nil || !exists {
+				t.Fatalf("expected user to exist but got %t, %v\n", exists, err)
+			}
+		},
+		"unknown user": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+
+			if _, err := userService.Reinvite("me@example.com", false); err != services.ErrUnknownUser {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUnknownUser, err)
+			}
+		},
+		"disabled user": func(t *testing.T) {
+			userService, id, _ := setup(t)
+			if err := userService.Disable(id); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := userService.Reinvite("me@example.com", false); err != services.ErrUserDisabled {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUserDisabled, err)
+			}
+			if _, err := userService.Create("me@example.com"); err != services.ErrUserExists {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUserExists, err)
+			}
+		},
 	}
 
 	for n, c := range cases {
@@ -263,6 +389,113 @@ func TestUserService_GetIDByEmail(t *testing.T) {
 	}
 }
 
+func TestUserService_GetEmailByID(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			var (
+				db          = db(t)
+				userService = &services.UserService{DB: db}
+				email       = "me@example.com"
+			)
+
+			// create user
+			code, err := userService.Create(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// get user id
+			id, err := userService.GetIDByCode(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// get email by id
+			storedEmail, err := userService.GetEmailByID(id)
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+			if storedEmail != email {
+				t.Fatalf("expected email %q but got %q\n", email, storedEmail)
+			}
+		},
+		"unknown id": func(t *testing.T) {
+			var (
+				db          = db(t)
+				userService = &services.UserService{DB: db}
+			)
+
+			// get email by unknown id
+			if _, err := userService.GetEmailByID(uuid.NewV4()); err != services.ErrUnknownUser {
+				t.Fatalf("expected error %q but got %q\n", services.ErrUnknownUser, err)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestUserService_Get(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			var (
+				db          = db(t)
+				userService = &services.UserService{DB: db}
+				email       = "me@example.com"
+			)
+
+			// create user
+			code, err := userService.Create(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := userService.GetIDByCode(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// never signed in
+			user, err := userService.Get(id)
+			if err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+			if user.ID != id || user.Email != email {
+				t.Fatalf("expected user %s with email %q but got %+v\n", id, email, user)
+			}
+			if time.Since(user.CreatedAt) > time.Minute {
+				t.Fatalf("expected created_at to be now but got %s\n", user.CreatedAt)
+			}
+			if !user.LastSigninAt.IsZero() {
+				t.Fatalf("expected no last signin but got %s\n", user.LastSigninAt)
+			}
+
+			// signed in
+			if err := userService.SetLastSignin(id); err != nil {
+				t.Fatal(err)
+			}
+			if user, err = userService.Get(id); err != nil {
+				t.Fatal(err)
+			}
+			if time.Since(user.LastSigninAt) > time.Minute {
+				t.Fatalf("expected last signin to be now but got %s\n", user.LastSigninAt)
+			}
+		},
+		"unknown user": func(t *testing.T) {
+			userService := &services.UserService{DB: db(t)}
+
+			if _, err := userService.Get(uuid.NewV4()); err != services.ErrUnknownUser {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUnknownUser, err)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
 func TestUserService_UpdatePassword(t *testing.T) {
 	cases := map[string]func(t *testing.T){
 		"success": func(t *testing.T) {
@@ -371,6 +604,32 @@ func TestUserService_UpdatePassword(t *testing.T) {
 				t.Fatalf("expected to get error %q but got %q\n", services.ErrPasswordNotConfirmed, err)
 			}
 		},
+		"password contains email": func(t *testing.T) {
+			var (
+				db          = db(t)
+				userService = &services.UserService{DB: db, Policy: &services.PasswordPolicy{MinLength: 8, RejectEmail: true}}
+				email       = "webmaster@example.com"
+				password    = "webmaster2000"
+			)
+
+			// create user
+			code, err := userService.Create(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// get user id
+			id, err := userService.GetIDByCode(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// update the password
+			err = userService.UpdatePassword(id, password, password)
+			if err != services.ErrPasswordContainsEmail {
+				t.Fatalf("expected to get error %q but got %q\n", services.ErrPasswordContainsEmail, err)
+			}
+		},
 	}
 
 	for n, c := range cases {
@@ -470,6 +729,76 @@ func TestUserService_Authenticate(t *testing.T) {
 	}
 }
 
+func TestUserService_ChangePassword(t *testing.T) {
+	var (
+		password    = strings.Repeat("x", services.PasswordMinLen)
+		newPassword = strings.Repeat("y", services.PasswordMinLen)
+	)
+
+	// setup creates a user with the password.
+	setup := func(t *testing.T) (*services.UserService, uuid.UUID) {
+		userService := &services.UserService{DB: db(t)}
+		code, err := userService.Create("me@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := userService.GetIDByCode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := userService.UpdatePassword(id, password, password); err != nil {
+			t.Fatal(err)
+		}
+		return userService, id
+	}
+
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			userService, id := setup(t)
+
+			if err := userService.ChangePassword(id, password, newPassword, newPassword); err != nil {
+				t.Fatalf("expected no error but got %q\n", err)
+			}
+
+			// ensure only the new password works
+			if ok, err := userService.Authenticate("me@example.com", newPassword); err != nil || !ok {
+				t.Fatalf("expected new password to work but got %t, %v\n", ok, err)
+			}
+			if ok, err := userService.Authenticate("me@example.com", password); err != nil || ok {
+				t.Fatalf("expected old password not to work but got %t, %v\n", ok, err)
+			}
+		},
+		"wrong current password": func(t *testing.T) {
+			userService, id := setup(t)
+
+			err := userService.ChangePassword(id, newPassword, newPassword, newPassword)
+			if err != services.ErrWrongPassword {
+				t.Fatalf("expected error %q but got %v\n", services.ErrWrongPassword, err)
+			}
+		},
+		"new password violates policy": func(t *testing.T) {
+			userService, id := setup(t)
+
+			err := userService.ChangePassword(id, password, "short", "short")
+			if err != services.ErrPasswordTooShort {
+				t.Fatalf("expected error %q but got %v\n", services.ErrPasswordTooShort, err)
+			}
+		},
+		"unknown user": func(t *testing.T) {
+			userService, _ := setup(t)
+
+			err := userService.ChangePassword(uuid.NewV4(), password, newPassword, newPassword)
+			if err != services.ErrUnknownUser {
+				t.Fatalf("expected error %q but got %v\n", services.ErrUnknownUser, err)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
 func TestUserService_Exists(t *testing.T) {
 	cases := map[string]func(t *testing.T){
 		"user does exist": func(t *testing.T) {
@@ -520,3 +849,36 @@ func TestUserService_Exists(t *testing.T) {
 		t.Run(n, c)
 	}
 }
+
+func TestUserService_CountPending(t *testing.T) {
+	var (
+		db          = db(t)
+		userService = &services.UserService{DB: db}
+		password    = strings.Repeat("x", services.PasswordMinLen)
+	)
+
+	// create two users and let one of them sign up
+	code, err := userService.Create("me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := userService.Create("you@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := userService.GetIDByCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := userService.UpdatePassword(id, password, password); err != nil {
+		t.Fatal(err)
+	}
+
+	// ensure only the other user is pending
+	count, err := userService.CountPending()
+	if err != nil {
+		t.Fatalf("expected no error but got %q\n", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 pending user but got %d\n", count)
+	}
+}
@@ -0,0 +1,142 @@
+package systemd_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kschaper/auth-static/systemd"
+)
+
+func TestNotify(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"success": func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "systemd")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			// listen on notify socket
+			addr := &net.UnixAddr{Name: filepath.Join(dir, "notify.sock"), Net: "unixgram"}
+			conn, err := net.ListenUnixgram(addr.Net, addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			os.Setenv("NOTIFY_SOCKET", addr.Name)
+			defer os.Unsetenv("NOTIFY_SOCKET")
+
+			// notify
+			sent, err := systemd.Notify("READY=1")
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+			if !sent {
+				t.Fatal("expected notification to be sent but wasn't")
+			}
+
+			// ensure state has been received
+			buf := make([]byte, 64)
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state := string(buf[:n]); state != "READY=1" {
+				t.Fatalf("expected state %q but got %q\n", "READY=1", state)
+			}
+		},
+		"no socket": func(t *testing.T) {
+			os.Unsetenv("NOTIFY_SOCKET")
+
+			sent, err := systemd.Notify("READY=1")
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+			if sent {
+				t.Fatal("expected notification not to be sent but was")
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestListeners(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"not activated": func(t *testing.T) {
+			os.Unsetenv("LISTEN_PID")
+			os.Unsetenv("LISTEN_FDS")
+
+			listeners, err := systemd.Listeners()
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+			if len(listeners) != 0 {
+				t.Fatalf("expected no listeners but got %d\n", len(listeners))
+			}
+		},
+		"other process": func(t *testing.T) {
+			os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+			os.Setenv("LISTEN_FDS", "1")
+			defer os.Unsetenv("LISTEN_PID")
+			defer os.Unsetenv("LISTEN_FDS")
+
+			listeners, err := systemd.Listeners()
+			if err != nil {
+				t.Fatalf("expected no error but got %q", err)
+			}
+			if len(listeners) != 0 {
+				t.Fatalf("expected no listeners but got %d\n", len(listeners))
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	cases := map[string]func(t *testing.T){
+		"enabled": func(t *testing.T) {
+			os.Setenv("WATCHDOG_USEC", "30000000")
+			os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+			defer os.Unsetenv("WATCHDOG_USEC")
+			defer os.Unsetenv("WATCHDOG_PID")
+
+			if interval := systemd.WatchdogInterval(); interval != 30*time.Second {
+				t.Fatalf("expected interval %s but got %s\n", 30*time.Second, interval)
+			}
+		},
+		"disabled": func(t *testing.T) {
+			os.Unsetenv("WATCHDOG_USEC")
+
+			if interval := systemd.WatchdogInterval(); interval != 0 {
+				t.Fatalf("expected interval 0 but got %s\n", interval)
+			}
+		},
+		"other process": func(t *testing.T) {
+			os.Setenv("WATCHDOG_USEC", "30000000")
+			os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+			defer os.Unsetenv("WATCHDOG_USEC")
+			defer os.Unsetenv("WATCHDOG_PID")
+
+			if interval := systemd.WatchdogInterval(); interval != 0 {
+				t.Fatalf("expected interval 0 but got %s\n", interval)
+			}
+		},
+	}
+
+	for n, c := range cases {
+		t.Run(n, c)
+	}
+}